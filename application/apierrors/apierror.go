@@ -69,3 +69,7 @@ func NewInternalServerApiError(message string, err error) ApiError {
 func NewUnauthorizedApiError() ApiError {
 	return apiErr{"You're not authorized to use this resource", "unauthorized", http.StatusUnauthorized, CauseList{}}
 }
+
+func NewForbiddenApiError(message string) ApiError {
+	return apiErr{message, "forbidden", http.StatusForbidden, CauseList{}}
+}
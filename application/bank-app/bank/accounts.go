@@ -0,0 +1,226 @@
+package bank
+
+import (
+	"errors"
+	"github.com/negarciacamilo/deuna_challenge/application/defines"
+	dbd "github.com/negarciacamilo/deuna_challenge/application/domain/database"
+	"github.com/negarciacamilo/deuna_challenge/application/logger"
+	"github.com/negarciacamilo/deuna_challenge/application/money"
+	"github.com/spf13/viper"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	errInvalidCard       = errors.New(defines.INVALID_CARD_HASH)
+	errInsufficientFunds = errors.New(defines.CLIENT_INVALID_BALANCE)
+	errLimitExceeded     = errors.New(defines.CLIENT_HAS_EXCEEDED_LIMIT)
+)
+
+// dayLayout is the layout of the day the daily spend belongs to, days are in UTC
+const dayLayout = "2006-01-02"
+
+// AccountConfig is how an account is opened, the amounts are decimal strings and a daily limit of 0 has no limit
+type AccountConfig struct {
+	Balance     string `mapstructure:"balance"`
+	CreditLimit string `mapstructure:"credit_limit"`
+	DailyLimit  string `mapstructure:"daily_limit"`
+	// Blocked cards are declined as invalid
+	Blocked bool `mapstructure:"blocked"`
+}
+
+// account is the card account of a client. Amounts of every currency are taken at face value, the simulator doesn't
+// convert them
+type account struct {
+	balance     money.Amount
+	creditLimit money.Amount
+	dailyLimit  money.Amount
+	blocked     bool
+	// spent is what was charged on the day
+	spent money.Amount
+	day   string
+}
+
+// accountStore keeps the accounts by card hash. The cards of BANK_ACCOUNTS are opened with their config and any other
+// card is opened with BANK_DEFAULT_ACCOUNT the first time it's used
+type accountStore struct {
+	mu       sync.Mutex
+	accounts map[string]*account
+	// What new accounts start with, by lowercased card hash
+	presets  map[string]account
+	defaults account
+	// Shared with the operations, they're stored together
+	changes *changes
+}
+
+func newAccountStore(changes *changes) *accountStore {
+	config := AccountConfig{}
+	if err := viper.UnmarshalKey("BANK_DEFAULT_ACCOUNT", &config); err != nil {
+		logger.Panic("invalid BANK_DEFAULT_ACCOUNT config", "new-account-store", err, nil)
+	}
+
+	// The keys of a config map are lowercased, so are the card hashes of the presets
+	configs := map[string]AccountConfig{}
+	if err := viper.UnmarshalKey("BANK_ACCOUNTS", &configs); err != nil {
+		logger.Panic("invalid BANK_ACCOUNTS config", "new-account-store", err, nil)
+	}
+
+	presets := make(map[string]account, len(configs))
+	for cardHash, c := range configs {
+		presets[cardHash] = newAccount(c)
+	}
+
+	return &accountStore{
+		accounts: make(map[string]*account),
+		presets:  presets,
+		defaults: newAccount(config),
+		changes:  changes,
+	}
+}
+
+// restore opens the stored accounts as they were left
+func (s *accountStore) restore(accounts []dbd.BankAccount) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, a := range accounts {
+		s.accounts[a.CardHash] = &account{
+			balance:     a.Balance,
+			creditLimit: a.CreditLimit,
+			dailyLimit:  a.DailyLimit,
+			blocked:     a.Blocked,
+			spent:       a.Spent,
+			day:         a.Day,
+		}
+	}
+}
+
+// changed returns the accounts that moved since they were last stored
+func (s *accountStore) changed() []dbd.BankAccount {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	accounts := make([]dbd.BankAccount, 0, len(s.changes.accounts))
+	for cardHash := range s.changes.accounts {
+		a := s.accounts[cardHash]
+		accounts = append(accounts, dbd.BankAccount{
+			CardHash:    cardHash,
+			Balance:     a.balance,
+			CreditLimit: a.creditLimit,
+			DailyLimit:  a.dailyLimit,
+			Blocked:     a.blocked,
+			Spent:       a.spent,
+			Day:         a.day,
+		})
+	}
+	return accounts
+}
+
+// reset closes every account, they're opened again the next time their card is used
+func (s *accountStore) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accounts = make(map[string]*account)
+}
+
+// debit charges the amount to the account of the card, the balance can go below zero down to the credit limit
+func (s *accountStore) debit(cardHash, operationID string, amount money.Amount) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acc := s.get(cardHash)
+	if acc.blocked {
+		return errInvalidCard
+	}
+
+	if amount > acc.balance+acc.creditLimit {
+		return errInsufficientFunds
+	}
+
+	acc.startDay()
+	if acc.dailyLimit > 0 && acc.spent+amount > acc.dailyLimit {
+		return errLimitExceeded
+	}
+
+	acc.balance -= amount
+	acc.spent += amount
+	s.record(cardHash, operationID, defines.LEDGER_CHARGE, amount)
+	return nil
+}
+
+// release gives back the amount of a charge that didn't happen (a reversal, a void or what's left of a capture). If it
+// was charged the same day, it's taken out of the daily spend as well
+func (s *accountStore) release(cardHash, operationID string, amount money.Amount, chargedAt time.Time) {
+	if amount == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acc := s.get(cardHash)
+	acc.balance += amount
+
+	acc.startDay()
+	if acc.day == chargedAt.UTC().Format(dayLayout) {
+		acc.spent = max(acc.spent-amount, 0)
+	}
+	s.record(cardHash, operationID, defines.LEDGER_RELEASE, amount)
+}
+
+// credit pays the amount into the account, a refund doesn't give back the daily spend
+func (s *accountStore) credit(cardHash, operationID string, amount money.Amount) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.get(cardHash).balance += amount
+	s.record(cardHash, operationID, defines.LEDGER_REFUND, amount)
+}
+
+// record must be called with the lock held, it writes the movement to the ledger with the balance it left
+func (s *accountStore) record(cardHash, operationID, movement string, amount money.Amount) {
+	s.changes.accounts[cardHash] = true
+	entry := dbd.BankLedgerEntry{CardHash: cardHash, OperationID: operationID, Type: movement, Amount: amount, Balance: s.accounts[cardHash].balance}
+	entry.CreatedAt = time.Now()
+	s.changes.entries = append(s.changes.entries, entry)
+}
+
+// get must be called with the lock held
+func (s *accountStore) get(cardHash string) *account {
+	if acc, ok := s.accounts[cardHash]; ok {
+		return acc
+	}
+
+	acc := s.defaults
+	if preset, ok := s.presets[strings.ToLower(cardHash)]; ok {
+		acc = preset
+	}
+	s.accounts[cardHash] = &acc
+	return &acc
+}
+
+// startDay resets the daily spend when the day changes
+func (a *account) startDay() {
+	today := time.Now().UTC().Format(dayLayout)
+	if a.day != today {
+		a.day = today
+		a.spent = 0
+	}
+}
+
+func newAccount(config AccountConfig) account {
+	return account{
+		balance:     configAmount(config.Balance, "balance"),
+		creditLimit: configAmount(config.CreditLimit, "credit_limit"),
+		dailyLimit:  configAmount(config.DailyLimit, "daily_limit"),
+		blocked:     config.Blocked,
+	}
+}
+
+func configAmount(value, name string) money.Amount {
+	if value == "" {
+		return 0
+	}
+
+	amount, err := money.Parse(value)
+	if err != nil {
+		logger.Panic("invalid amount in the account config", "new-account", err, nil, map[string]any{"field": name, "value": value})
+	}
+	return amount
+}
@@ -0,0 +1,87 @@
+package bank
+
+import (
+	"github.com/negarciacamilo/deuna_challenge/application/money"
+	d "github.com/negarciacamilo/deuna_challenge/application/payments-app/domain"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func setupAccounts(t *testing.T) *operationStore {
+	t.Cleanup(viper.Reset)
+	viper.Set("BANK_DEFAULT_ACCOUNT", map[string]any{"balance": "100", "daily_limit": "150"})
+	viper.Set("BANK_ACCOUNTS", map[string]any{
+		"credit-card":  map[string]any{"balance": "0", "credit_limit": "50"},
+		"blocked-card": map[string]any{"blocked": true},
+	})
+	return newOperationStore(memoryRepository{})
+}
+
+func payment(cardHash, amount string) d.PaymentRequest {
+	return d.PaymentRequest{CardHash: cardHash, Amount: money.MustParse(amount)}
+}
+
+func balance(s *operationStore, cardHash string) money.Amount {
+	s.accounts.mu.Lock()
+	defer s.accounts.mu.Unlock()
+	return s.accounts.get(cardHash).balance
+}
+
+func TestAccounts(t *testing.T) {
+	t.Run("Payments are declined by the state of the account", func(t *testing.T) {
+		s := setupAccounts(t)
+
+		require.NoError(t, s.add("1", payment("card", "60")))
+		require.ErrorIs(t, s.add("2", payment("card", "60")), errInsufficientFunds)
+		require.Equal(t, money.MustParse("40"), balance(s, "card"))
+
+		require.NoError(t, s.add("3", payment("Credit-Card", "50")))
+		require.ErrorIs(t, s.add("4", payment("Credit-Card", "0.01")), errInsufficientFunds)
+		require.Equal(t, money.MustParse("-50"), balance(s, "Credit-Card"))
+
+		require.ErrorIs(t, s.add("5", payment("blocked-card", "1")), errInvalidCard)
+		_, ok := s.operations["2"]
+		require.False(t, ok)
+	})
+
+	t.Run("The daily limit counts what was charged in the day", func(t *testing.T) {
+		s := setupAccounts(t)
+		s.accounts.defaults.balance = money.MustParse("1000")
+
+		require.NoError(t, s.add("1", payment("card", "100")))
+		require.ErrorIs(t, s.add("2", payment("card", "60")), errLimitExceeded)
+
+		// A reversal gives back the spend, a refund doesn't
+		require.NoError(t, s.reverse("1"))
+		require.NoError(t, s.add("3", payment("card", "150")))
+		require.NoError(t, s.refund("3", "", money.MustParse("150")))
+		require.ErrorIs(t, s.add("4", payment("card", "1")), errLimitExceeded)
+		require.Equal(t, money.MustParse("1000"), balance(s, "card"))
+
+		// A new day starts from zero
+		s.accounts.accounts["card"].day = time.Now().Add(-24 * time.Hour).UTC().Format(dayLayout)
+		require.NoError(t, s.add("5", payment("card", "150")))
+	})
+
+	t.Run("Refunds, reversals, voids and captures give the funds back", func(t *testing.T) {
+		s := setupAccounts(t)
+
+		require.NoError(t, s.add("1", payment("card", "30")))
+		require.NoError(t, s.refund("1", "", money.MustParse("10")))
+		require.NoError(t, s.reverse("1"))
+		require.ErrorIs(t, s.reverse("1"), errOperationReversed)
+		require.Equal(t, money.MustParse("100"), balance(s, "card"))
+
+		require.NoError(t, s.authorize("2", payment("card", "40"), time.Hour))
+		require.Equal(t, money.MustParse("60"), balance(s, "card"))
+		require.NoError(t, s.capture("2", money.MustParse("25")))
+		require.Equal(t, money.MustParse("75"), balance(s, "card"))
+
+		require.NoError(t, s.authorize("3", payment("card", "40"), time.Hour))
+		require.NoError(t, s.void("3"))
+		require.ErrorIs(t, s.reverse("3"), errOperationReversed)
+		require.Equal(t, money.MustParse("75"), balance(s, "card"))
+	})
+}
@@ -0,0 +1,87 @@
+package bank
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/negarciacamilo/deuna_challenge/application/apierrors"
+	"github.com/negarciacamilo/deuna_challenge/application/context"
+	"github.com/negarciacamilo/deuna_challenge/application/logger"
+	"github.com/negarciacamilo/deuna_challenge/application/response"
+	"net/http"
+	"slices"
+)
+
+// ScenarioRequest switches the scenario every payment of the bank gets, an empty one goes back to the normal flow
+type ScenarioRequest struct {
+	Scenario string `json:"scenario"`
+}
+
+// ListOperations returns what the bank processed, it can be filtered by status and card hash
+func (h *handler) ListOperations(c *gin.Context) {
+	ctx := context.GetContextInformation(c)
+	status, cardHash := c.Query("status"), c.Query("card_hash")
+
+	operations := make([]OperationView, 0)
+	for _, op := range h.operations.list() {
+		if (status == "" || op.Status == status) && (cardHash == "" || op.CardHash == cardHash) {
+			operations = append(operations, op)
+		}
+	}
+
+	response.Respond(ctx, response.New(http.StatusOK, operations), nil)
+}
+
+// InspectOperation returns an operation by id or payments app reference
+func (h *handler) InspectOperation(c *gin.Context) {
+	ctx := context.GetContextInformation(c)
+	op, err := h.operations.view(c.Param("operationID"))
+	if err != nil {
+		response.Respond(ctx, nil, operationApiError(err))
+		return
+	}
+
+	response.Respond(ctx, response.New(http.StatusOK, op), nil)
+}
+
+func (h *handler) GetScenario(c *gin.Context) {
+	ctx := context.GetContextInformation(c)
+	response.Respond(ctx, response.New(http.StatusOK, ScenarioRequest{Scenario: h.currentScenario()}), nil)
+}
+
+func (h *handler) SetScenario(c *gin.Context) {
+	ctx := context.GetContextInformation(c)
+	var scenarioRequest ScenarioRequest
+	if apierr := context.ShouldBindJSON(ctx, &scenarioRequest); apierr != nil {
+		response.Respond(ctx, nil, apierr)
+		return
+	}
+
+	if scenarioRequest.Scenario != "" && !slices.Contains(scenarios, scenarioRequest.Scenario) {
+		apierr := apierrors.NewBadRequestApiError(fmt.Sprintf("unknown scenario %s, it should be one of %v", scenarioRequest.Scenario, scenarios))
+		logger.Error(apierr.Message(), "set-scenario", apierr, ctx)
+		response.Respond(ctx, nil, apierr)
+		return
+	}
+
+	h.scenario.Store(scenarioRequest.Scenario)
+	logger.Info("scenario switched", "set-scenario", ctx, map[string]any{"bank_id": h.bankID, "scenario": scenarioRequest.Scenario})
+	response.Respond(ctx, response.New(http.StatusOK, scenarioRequest), nil)
+}
+
+// Reset forgets the operations and the accounts, and goes back to the normal flow
+func (h *handler) Reset() error {
+	h.paying.Lock()
+	defer h.paying.Unlock()
+	if err := h.operations.reset(); err != nil {
+		return err
+	}
+
+	h.scenario.Store("")
+	logger.Info("bank reset", "reset-bank", nil, map[string]any{"bank_id": h.bankID})
+	return nil
+}
+
+func (h *handler) currentScenario() string {
+	scenario, _ := h.scenario.Load().(string)
+	return scenario
+}
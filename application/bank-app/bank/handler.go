@@ -4,26 +4,59 @@ import (
 	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"github.com/negarciacamilo/deuna_challenge/application/apierrors"
+	"github.com/negarciacamilo/deuna_challenge/application/bank-app/database"
+	"github.com/negarciacamilo/deuna_challenge/application/bank-app/faults"
 	"github.com/negarciacamilo/deuna_challenge/application/context"
 	"github.com/negarciacamilo/deuna_challenge/application/defines"
 	"github.com/negarciacamilo/deuna_challenge/application/domain"
+	"github.com/negarciacamilo/deuna_challenge/application/money"
 	d "github.com/negarciacamilo/deuna_challenge/application/payments-app/domain"
 	"github.com/negarciacamilo/deuna_challenge/application/response"
 	"github.com/spf13/viper"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Handler interface {
+	// ListenISO serves the ISO 8583 link of the bank, it only returns if it can't listen anymore
+	ListenISO(address string) error
 	Pay(c *gin.Context)
 	PerformReversal(c *gin.Context)
 	RefundPayment(c *gin.Context)
+	Authorize(c *gin.Context)
+	Capture(c *gin.Context)
+	Void(c *gin.Context)
+	GetOperation(c *gin.Context)
+	ListOperations(c *gin.Context)
+	InspectOperation(c *gin.Context)
+	GetScenario(c *gin.Context)
+	SetScenario(c *gin.Context)
+	Reset() error
 }
 
 type handler struct {
+	// bankID is the bank this handler simulates
+	bankID     uint64
+	operations *operationStore
+	// faults of the answers of the ISO 8583 link, the HTTP API injects them in its router
+	faults *faults.Injector
+	// Payments are taken one at a time, so a repeated reference isn't charged twice
+	paying sync.Mutex
+	// scenario is the one set through the admin API, it comes before the ones of the payments
+	scenario atomic.Value
 }
 
-func NewHandler() Handler {
-	return &handler{}
+// NewHandler picks up the state the bank was left with in the database, without one the bank starts empty every time
+func NewHandler(bankID uint64, injector *faults.Injector, db database.Database) Handler {
+	return &handler{
+		bankID:     bankID,
+		operations: newOperationStore(newRepository(bankID, db)),
+		faults:     injector,
+	}
 }
 
 func (h *handler) Pay(c *gin.Context) {
@@ -36,41 +69,225 @@ func (h *handler) Pay(c *gin.Context) {
 		return
 	}
 
-	cardHashIsValid := viper.GetBool("CARD_HASH_IS_VALID")
-	enoughBalance := viper.GetBool("CLIENT_HAS_ENOUGH_BALANCE")
-	exceededLimit := viper.GetBool("CLIENT_HAS_EXCEEDED_LIMIT")
-	bankTxFailed := viper.GetBool("BANK_TX_FAILED")
+	id, bankErr := h.pay(clientHasEnoughBalanceRequest, false)
+	if bankErr != nil {
+		response.Respond(ctx, nil, bankErr)
+		return
+	}
+
+	response.Respond(ctx, response.New(200, domain.BankResponse{OperationID: id}), nil)
+}
+
+// pay charges the payment, or holds its funds, and returns the id of the operation. Both the HTTP API and the ISO 8583
+// link end up here. A payment reference the bank already answered gets the same answer, so a repeated payment isn't
+// charged twice. Test cards and magic amounts trigger their scenario
+func (h *handler) pay(payment d.PaymentRequest, hold bool) (string, *domain.BankError) {
+	// The delay is taken before the lock so it doesn't hold back the other payments
+	scenario := h.currentScenario()
+	if scenario == "" {
+		scenario = scenarioOf(payment)
+	}
+	time.Sleep(scenarioDelay(scenario))
+
+	h.paying.Lock()
+	defer h.paying.Unlock()
+	if id, bankErr, ok := h.operations.answer(payment.Reference); ok {
+		return id, bankErr
+	}
+
+	if bankErr := h.checkPayment(payment, scenario); bankErr != nil {
+		h.declined(payment, bankErr)
+		return "", bankErr
+	}
+
+	id, _ := uuid.NewV7()
+	var err error
+	if hold {
+		err = h.operations.authorize(id.String(), payment, viper.GetDuration("AUTHORIZATION_TTL"))
+	} else {
+		err = h.operations.add(id.String(), payment)
+	}
+
+	if err != nil {
+		bankErr := accountApiError(err)
+		h.declined(payment, bankErr)
+		return "", bankErr
+	}
+	return id.String(), nil
+}
 
-	if !cardHashIsValid {
-		response.Respond(ctx, nil, apierrors.NewBadRequestApiError(defines.INVALID_CARD_HASH))
+// checkPayment declines the payments the bank can't take and the ones of their scenario, forced with the admin API or
+// triggered by the payment. The rest are decided by the account of the card
+func (h *handler) checkPayment(payment d.PaymentRequest, scenario string) *domain.BankError {
+	if !supportsCurrency(h.bankID, payment.Currency) {
+		return domain.NewBankError(http.StatusBadRequest, defines.CURRENCY_NOT_SUPPORTED_DECLINE, defines.CURRENCY_NOT_SUPPORTED, false)
+	}
+
+	return scenarioError(scenario)
+}
+
+// declined remembers why a payment was declined. Failed transactions aren't stored, so the bank has no answer for them
+func (h *handler) declined(payment d.PaymentRequest, bankErr *domain.BankError) {
+	if bankErr.Status() < http.StatusInternalServerError {
+		h.operations.decline(payment, bankErr)
+	}
+}
+
+func (h *handler) PerformReversal(c *gin.Context) {
+	ctx := context.GetContextInformation(c)
+	if err := h.operations.reverse(c.Param("paymentID")); err != nil {
+		response.Respond(ctx, nil, operationApiError(err))
 		return
 	}
 
-	if !enoughBalance {
-		response.Respond(ctx, nil, apierrors.NewBadRequestApiError(defines.CLIENT_INVALID_BALANCE))
+	response.Respond(ctx, response.New(200, nil), nil)
+}
+
+func (h *handler) GetOperation(c *gin.Context) {
+	ctx := context.GetContextInformation(c)
+	op, err := h.operations.lookup(c.Param("reference"))
+	if err != nil {
+		response.Respond(ctx, nil, operationApiError(err))
 		return
 	}
 
-	if exceededLimit {
-		response.Respond(ctx, nil, apierrors.NewBadRequestApiError(defines.CLIENT_HAS_EXCEEDED_LIMIT))
+	response.Respond(ctx, response.New(200, op), nil)
+}
+
+func (h *handler) RefundPayment(c *gin.Context) {
+	ctx := context.GetContextInformation(c)
+	var refundRequest domain.BankRefundRequest
+
+	apierr := context.ShouldBindJSON(ctx, &refundRequest)
+	if apierr != nil {
+		response.Respond(ctx, nil, apierr)
 		return
 	}
 
-	if bankTxFailed {
-		response.Respond(ctx, nil, apierrors.NewInternalServerApiError(defines.BANK_TX_FAILED, errors.New("the operation couldn't be stored")))
+	var key string
+	if ctx.RequestInfo.IdempotencyKey != nil {
+		key = *ctx.RequestInfo.IdempotencyKey
+	}
+
+	if bankErr := h.refund(c.Param("paymentID"), key, refundRequest.Amount); bankErr != nil {
+		response.Respond(ctx, nil, bankErr)
 		return
 	}
 
-	id, _ := uuid.NewV7()
-	response.Respond(ctx, response.New(200, domain.BankResponse{OperationID: id.String()}), nil)
+	response.Respond(ctx, response.New(200, nil), nil)
 }
 
-func (h *handler) PerformReversal(c *gin.Context) {
+// refund pays back the amount of an operation, key is the idempotency key of the refund
+func (h *handler) refund(id, key string, amount money.Amount) *domain.BankError {
+	if amount <= 0 {
+		return domain.NewBankError(http.StatusBadRequest, defines.INVALID_AMOUNT_DECLINE, defines.INVALID_REFUND_AMOUNT, false)
+	}
+
+	if err := h.operations.refund(id, key, amount); err != nil {
+		return operationApiError(err)
+	}
+	return nil
+}
+
+func (h *handler) Authorize(c *gin.Context) {
 	ctx := context.GetContextInformation(c)
+	var authorizationRequest d.PaymentRequest
+
+	apierr := context.ShouldBindJSON(ctx, &authorizationRequest)
+	if apierr != nil {
+		response.Respond(ctx, nil, apierr)
+		return
+	}
+
+	id, bankErr := h.pay(authorizationRequest, true)
+	if bankErr != nil {
+		response.Respond(ctx, nil, bankErr)
+		return
+	}
+
+	response.Respond(ctx, response.New(200, domain.BankResponse{OperationID: id}), nil)
+}
+
+func (h *handler) Capture(c *gin.Context) {
+	ctx := context.GetContextInformation(c)
+	var captureRequest domain.BankCaptureRequest
+
+	apierr := context.ShouldBindJSON(ctx, &captureRequest)
+	if apierr != nil {
+		response.Respond(ctx, nil, apierr)
+		return
+	}
+
+	if err := h.operations.capture(c.Param("paymentID"), captureRequest.Amount); err != nil {
+		response.Respond(ctx, nil, operationApiError(err))
+		return
+	}
+
 	response.Respond(ctx, response.New(200, nil), nil)
 }
 
-func (h *handler) RefundPayment(c *gin.Context) {
+func (h *handler) Void(c *gin.Context) {
 	ctx := context.GetContextInformation(c)
+	if err := h.operations.void(c.Param("paymentID")); err != nil {
+		response.Respond(ctx, nil, operationApiError(err))
+		return
+	}
+
 	response.Respond(ctx, response.New(200, nil), nil)
 }
+
+func accountApiError(err error) *domain.BankError {
+	switch {
+	case errors.Is(err, errNotStored):
+		return notStoredApiError()
+	case errors.Is(err, errInvalidCard):
+		return domain.NewBankError(http.StatusBadRequest, defines.INVALID_CARD_DECLINE, err.Error(), false)
+	case errors.Is(err, errInsufficientFunds):
+		return domain.NewBankError(http.StatusBadRequest, defines.INSUFFICIENT_FUNDS_DECLINE, err.Error(), false)
+	default:
+		return domain.NewBankError(http.StatusBadRequest, defines.LIMIT_EXCEEDED_DECLINE, err.Error(), false)
+	}
+}
+
+// notStoredApiError is the error of an operation the bank couldn't write. It's retryable, a retry gets the answer of
+// the operation once it's written
+func notStoredApiError() *domain.BankError {
+	return domain.NewBankError(http.StatusInternalServerError, defines.TRANSACTION_FAILED_DECLINE, defines.BANK_TX_FAILED, true)
+}
+
+func operationApiError(err error) *domain.BankError {
+	switch {
+	case errors.Is(err, errNotStored):
+		return notStoredApiError()
+	case errors.Is(err, errOperationNotFound):
+		return domain.NewBankError(http.StatusNotFound, defines.OPERATION_NOT_FOUND_DECLINE, err.Error(), false)
+	case errors.Is(err, errOperationNotAuthorized):
+		return domain.NewBankError(http.StatusBadRequest, defines.OPERATION_NOT_AUTHORIZED_DECLINE, err.Error(), false)
+	case errors.Is(err, errAuthorizationExpired):
+		return domain.NewBankError(http.StatusBadRequest, defines.AUTHORIZATION_EXPIRED_DECLINE, err.Error(), false)
+	case errors.Is(err, errOperationReversed):
+		return domain.NewBankError(http.StatusConflict, defines.OPERATION_REVERSED_DECLINE, err.Error(), false)
+	case errors.Is(err, errOperationRefunded):
+		return domain.NewBankError(http.StatusConflict, defines.OPERATION_REFUNDED_DECLINE, err.Error(), false)
+	case errors.Is(err, errRefundExceedsAmount):
+		return domain.NewBankError(http.StatusBadRequest, defines.REFUND_EXCEEDS_AMOUNT_DECLINE, err.Error(), false)
+	default:
+		return domain.NewBankError(http.StatusBadRequest, defines.INVALID_AMOUNT_DECLINE, err.Error(), false)
+	}
+}
+
+// supportsCurrency checks the currencies each simulated bank works with. A bank that isn't configured accepts every currency
+func supportsCurrency(bankID uint64, currency string) bool {
+	supported := viper.GetStringMapStringSlice("BANK_SUPPORTED_CURRENCIES")
+	currencies, ok := supported[strconv.FormatUint(bankID, 10)]
+	if !ok {
+		return true
+	}
+
+	for _, c := range currencies {
+		if strings.EqualFold(c, currency) {
+			return true
+		}
+	}
+	return false
+}
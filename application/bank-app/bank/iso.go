@@ -0,0 +1,218 @@
+package bank
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/negarciacamilo/deuna_challenge/application/bank-app/faults"
+	"github.com/negarciacamilo/deuna_challenge/application/defines"
+	"github.com/negarciacamilo/deuna_challenge/application/domain"
+	"github.com/negarciacamilo/deuna_challenge/application/iso8583"
+	"github.com/negarciacamilo/deuna_challenge/application/logger"
+	"github.com/negarciacamilo/deuna_challenge/application/money"
+	d "github.com/negarciacamilo/deuna_challenge/application/payments-app/domain"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ListenISO serves the ISO 8583 link of the bank. A connection carries many messages at the same time, so every
+// message is handled on its own and the payments app matches the answers to its requests by their STAN
+func (h *handler) ListenISO(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go h.serveISO(conn)
+	}
+}
+
+func (h *handler) serveISO(conn net.Conn) {
+	defer conn.Close()
+	var writing sync.Mutex
+	tags := map[string]any{"bank_id": h.bankID, "remote_address": conn.RemoteAddr().String()}
+
+	for {
+		request, err := iso8583.ReadMessage(conn)
+		if err != nil {
+			// A message that can't be read leaves the connection out of sync, so it's closed
+			if !errors.Is(err, io.EOF) {
+				logger.Error("can't read the ISO 8583 message, closing the connection", "iso-listener", err, nil, tags)
+			}
+			return
+		}
+
+		go func() {
+			fault := h.faults.Pick(isoEndpoint(request), nil)
+			time.Sleep(fault.Delay)
+
+			var res *iso8583.Message
+			if fault.Kind == faults.ErrorFault {
+				bankErr := domain.NewBankError(http.StatusServiceUnavailable, defines.BANK_UNAVAILABLE_DECLINE, defines.BANK_UNAVAILABLE, true)
+				res = iso8583.NewResponse(request).
+					Set(iso8583.FieldActionCode, isoActionCode(bankErr)).
+					Set(iso8583.FieldAdditionalResponse, bankErr.DeclineCode)
+			} else {
+				res = h.handleISO(request)
+			}
+
+			writing.Lock()
+			defer writing.Unlock()
+			if err := writeISO(conn, res, fault.Kind); err != nil {
+				logger.Error("can't answer the ISO 8583 message", "iso-listener", err, nil, tags)
+			}
+		}()
+	}
+}
+
+// writeISO sends the answer, unless the fault loses it: a reset or a truncated answer close the connection, with every
+// message that was waiting for an answer, and a hung answer is never sent
+func writeISO(conn net.Conn, res *iso8583.Message, fault string) error {
+	switch fault {
+	case faults.HangFault:
+		return nil
+	case faults.ResetFault:
+		if tcp, ok := conn.(*net.TCPConn); ok {
+			_ = tcp.SetLinger(0)
+		}
+		return conn.Close()
+	case faults.TruncateFault:
+		packed, err := res.Pack()
+		if err != nil {
+			return err
+		}
+
+		frame := binary.BigEndian.AppendUint16(nil, uint16(len(packed)))
+		_, _ = conn.Write(append(frame, packed[:len(packed)/2]...))
+		return conn.Close()
+	default:
+		return iso8583.WriteMessage(conn, res)
+	}
+}
+
+// isoEndpoint is the endpoint of a message in the fault profiles, a void is a reversal in ISO 8583
+func isoEndpoint(request *iso8583.Message) string {
+	switch request.MTI {
+	case iso8583.AuthorizationRequest:
+		return "authorize"
+	case iso8583.FinancialRequest:
+		if request.Get(iso8583.FieldProcessingCode) == iso8583.RefundProcessingCode {
+			return "refund"
+		}
+		return "pay"
+	case iso8583.CompletionAdvice:
+		return "capture"
+	case iso8583.ReversalRequest, iso8583.ReversalRepeat:
+		return "reversal"
+	default:
+		return "echo"
+	}
+}
+
+// handleISO answers a message with the same operations of the HTTP API
+func (h *handler) handleISO(request *iso8583.Message) *iso8583.Message {
+	ctx := &domain.ContextInformation{RequestInfo: &domain.RequestInfo{RequestID: request.Get(iso8583.FieldReference)}}
+	logger.Info("ISO 8583 message", "iso-message", ctx, map[string]any{"bank_id": h.bankID, "mti": request.MTI, "stan": request.Get(iso8583.FieldSTAN)})
+
+	res := iso8583.NewResponse(request)
+	var bankErr *domain.BankError
+	switch request.MTI {
+	case iso8583.NetworkRequest:
+		// Echo, the link is up
+	case iso8583.AuthorizationRequest, iso8583.FinancialRequest:
+		amount, err := isoAmount(request)
+		if err != nil {
+			bankErr = err
+			break
+		}
+
+		if request.Get(iso8583.FieldProcessingCode) == iso8583.RefundProcessingCode {
+			// The reference of a refund is its idempotency key
+			bankErr = h.refund(request.Get(iso8583.FieldOperationID), request.Get(iso8583.FieldReference), amount)
+			break
+		}
+
+		payment, err := isoPayment(request, amount)
+		if err != nil {
+			bankErr = err
+			break
+		}
+
+		var id string
+		id, bankErr = h.pay(payment, request.MTI == iso8583.AuthorizationRequest)
+		if bankErr == nil {
+			res.Set(iso8583.FieldOperationID, id)
+		}
+	case iso8583.CompletionAdvice:
+		amount, err := isoAmount(request)
+		if err != nil {
+			bankErr = err
+			break
+		}
+
+		if err := h.operations.capture(request.Get(iso8583.FieldOperationID), amount); err != nil {
+			bankErr = operationApiError(err)
+		}
+	case iso8583.ReversalRequest, iso8583.ReversalRepeat:
+		// The reversal of a hold is a void
+		id := request.Get(iso8583.FieldOperationID)
+		if err := h.operations.void(id); err != nil {
+			if err := h.operations.reverse(id); err != nil {
+				bankErr = operationApiError(err)
+			}
+		}
+	default:
+		bankErr = domain.NewBankError(http.StatusBadRequest, defines.UNKNOWN_DECLINE, "unsupported message type "+request.MTI, false)
+	}
+
+	if bankErr != nil {
+		res.Set(iso8583.FieldActionCode, isoActionCode(bankErr))
+		res.Set(iso8583.FieldAdditionalResponse, bankErr.DeclineCode)
+		return res
+	}
+
+	res.Set(iso8583.FieldActionCode, iso8583.Approved)
+	return res
+}
+
+// isoActionCode returns the action code of an error. The declines that have no code of their own, like a refund over
+// the amount, are a "do not honour" so they aren't taken as a failure of the bank
+func isoActionCode(bankErr *domain.BankError) string {
+	code := iso8583.ForDecline(bankErr.DeclineCode)
+	if code == iso8583.SystemError && !bankErr.Retryable {
+		return iso8583.DoNotHonour
+	}
+	return code
+}
+
+func isoAmount(request *iso8583.Message) (money.Amount, *domain.BankError) {
+	minor, err := strconv.ParseInt(request.Get(iso8583.FieldAmount), 10, 64)
+	if err != nil {
+		return 0, domain.NewBankError(http.StatusBadRequest, defines.INVALID_AMOUNT_DECLINE, "invalid amount", false)
+	}
+	return money.FromMinorUnits(minor), nil
+}
+
+func isoPayment(request *iso8583.Message, amount money.Amount) (d.PaymentRequest, *domain.BankError) {
+	currency, ok := money.LookupNumericCurrency(request.Get(iso8583.FieldCurrency))
+	if !ok {
+		return d.PaymentRequest{}, domain.NewBankError(http.StatusBadRequest, defines.CURRENCY_NOT_SUPPORTED_DECLINE, defines.CURRENCY_NOT_SUPPORTED, false)
+	}
+
+	merchantID, _ := strconv.ParseUint(request.Get(iso8583.FieldCardAcceptorID), 10, 64)
+	return d.PaymentRequest{
+		Amount:     amount,
+		Currency:   currency.Code,
+		MerchantID: merchantID,
+		CardHash:   request.Get(iso8583.FieldCardHash),
+		Reference:  request.Get(iso8583.FieldReference),
+	}, nil
+}
@@ -0,0 +1,505 @@
+package bank
+
+import (
+	"errors"
+	"github.com/negarciacamilo/deuna_challenge/application/defines"
+	"github.com/negarciacamilo/deuna_challenge/application/domain"
+	dbd "github.com/negarciacamilo/deuna_challenge/application/domain/database"
+	"github.com/negarciacamilo/deuna_challenge/application/logger"
+	"github.com/negarciacamilo/deuna_challenge/application/money"
+	d "github.com/negarciacamilo/deuna_challenge/application/payments-app/domain"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	errOperationNotFound      = errors.New(defines.OPERATION_NOT_FOUND)
+	errOperationNotAuthorized = errors.New(defines.OPERATION_NOT_AUTHORIZED)
+	errAuthorizationExpired   = errors.New(defines.AUTHORIZATION_EXPIRED)
+	errInvalidCaptureAmount   = errors.New(defines.INVALID_CAPTURE_AMOUNT)
+	errOperationReversed      = errors.New(defines.ALREADY_REVERSED)
+	errOperationRefunded      = errors.New(defines.ALREADY_REFUNDED)
+	errRefundExceedsAmount    = errors.New(defines.REFUND_EXCEEDS_AMOUNT)
+	// errNotStored fails an operation whose changes couldn't be written, the bank doesn't answer what a restart
+	// would lose
+	errNotStored = errors.New(defines.BANK_TX_FAILED)
+)
+
+// operation is what the bank remembers about a processed payment
+type operation struct {
+	reference string
+	cardHash  string
+	amount    money.Amount
+	refunded  money.Amount
+	createdAt time.Time
+	// onHold is true while the funds are authorized but not captured yet
+	onHold    bool
+	expiresAt time.Time
+	voided    bool
+	reversed  bool
+}
+
+// decline is what the bank remembers about a declined payment
+type decline struct {
+	cardHash  string
+	amount    money.Amount
+	reason    *domain.BankError
+	createdAt time.Time
+}
+
+// OperationView is what the admin API shows of an operation, declined payments have no operation id
+type OperationView struct {
+	OperationID string            `json:"operation_id,omitempty"`
+	Reference   string            `json:"reference,omitempty"`
+	CardHash    string            `json:"card_hash"`
+	Amount      money.Amount      `json:"amount"`
+	Refunded    money.Amount      `json:"refunded"`
+	Status      string            `json:"status"`
+	Error       *domain.BankError `json:"error,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	ExpiresAt   *time.Time        `json:"expires_at,omitempty"`
+}
+
+// operationStore is an in-memory registry of the operations performed by the simulator. Every operation moves the
+// funds of the account of its card, and every change is written through to the repository
+type operationStore struct {
+	mu         sync.Mutex
+	repository repository
+	changes    *changes
+	accounts   *accountStore
+	operations map[string]*operation
+	// The payments app reference of every operation, so it can ask for the ones it never got the answer of
+	references map[string]string
+	// The declined payments by reference
+	declines map[string]*decline
+	// Operations reversed before the bank knew about them, by id or reference. A payment that comes after its own
+	// reversal is stored as reversed and isn't charged
+	reversals map[string]bool
+	// The refunds by idempotency key, a retried refund is answered without paying it back again
+	refunds map[string]dbd.BankRefund
+}
+
+// newOperationStore picks up the state the bank was left with
+func newOperationStore(repository repository) *operationStore {
+	changes := newChanges()
+	s := &operationStore{repository: repository, changes: changes, accounts: newAccountStore(changes)}
+	s.clear()
+
+	stored, err := repository.load()
+	if err != nil {
+		logger.Panic("can't load the state of the bank", "new-operation-store", err, nil)
+	}
+	s.restore(stored)
+	return s
+}
+
+// reset forgets every operation and account, the bank starts over
+func (s *operationStore) reset() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.repository.reset(); err != nil {
+		return err
+	}
+
+	s.clear()
+	s.accounts.reset()
+	return nil
+}
+
+// clear must be called with the lock held
+func (s *operationStore) clear() {
+	s.operations = make(map[string]*operation)
+	s.references = make(map[string]string)
+	s.declines = make(map[string]*decline)
+	s.reversals = make(map[string]bool)
+	s.refunds = make(map[string]dbd.BankRefund)
+	s.changes.clear()
+}
+
+// restore must be called with the lock held, or before the store is used
+func (s *operationStore) restore(stored *rows) {
+	for _, o := range stored.operations {
+		op := &operation{
+			reference: o.Reference,
+			cardHash:  o.CardHash,
+			amount:    o.Amount,
+			refunded:  o.Refunded,
+			createdAt: o.CreatedAt,
+			onHold:    o.Status == defines.OPERATION_AUTHORIZED,
+			voided:    o.Status == defines.OPERATION_VOIDED,
+			reversed:  o.Status == defines.OPERATION_REVERSED,
+		}
+		if o.ExpiresAt != nil {
+			op.expiresAt = *o.ExpiresAt
+		}
+
+		s.operations[o.OperationID] = op
+		if op.reference != "" {
+			s.references[op.reference] = o.OperationID
+		}
+	}
+
+	for _, d := range stored.declines {
+		s.declines[d.Reference] = &decline{cardHash: d.CardHash, amount: d.Amount, reason: d.Error, createdAt: d.CreatedAt}
+	}
+
+	for _, r := range stored.reversals {
+		s.reversals[r.OperationID] = true
+	}
+
+	for _, r := range stored.refunds {
+		s.refunds[r.Key] = r
+	}
+
+	s.accounts.restore(stored.accounts)
+}
+
+// flush must be called with the lock held. What can't be written is kept, and written with the next change
+func (s *operationStore) flush() error {
+	changed := &rows{entries: s.changes.entries, accounts: s.accounts.changed()}
+	for id := range s.changes.operations {
+		changed.operations = append(changed.operations, s.operations[id].model(id))
+	}
+
+	for reference := range s.changes.declines {
+		d := s.declines[reference]
+		decline := dbd.BankDecline{Reference: reference, CardHash: d.cardHash, Amount: d.amount, Error: d.reason}
+		decline.CreatedAt = d.createdAt
+		changed.declines = append(changed.declines, decline)
+	}
+
+	for id, added := range s.changes.reversals {
+		if added {
+			changed.reversals = append(changed.reversals, dbd.BankEarlyReversal{OperationID: id})
+		} else {
+			changed.consumed = append(changed.consumed, id)
+		}
+	}
+
+	for key := range s.changes.refunds {
+		changed.refunds = append(changed.refunds, s.refunds[key])
+	}
+
+	if changed.empty() {
+		return nil
+	}
+
+	if err := s.repository.save(changed); err != nil {
+		logger.Error("can't store the state of the bank", "flush-operations", err, nil, map[string]any{"operations": len(changed.operations), "entries": len(changed.entries)})
+		return errNotStored
+	}
+	s.changes.clear()
+	return nil
+}
+
+// commit must be called with the lock held. It flushes the changes of an operation and fails it if they can't be
+// written, even if the operation failed on its own, since what it changed would be lost on a restart
+func (s *operationStore) commit(err *error) {
+	if flushErr := s.flush(); flushErr != nil {
+		*err = flushErr
+	}
+}
+
+// add charges the payment to the account of the card
+func (s *operationStore) add(id string, payment d.PaymentRequest) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.commit(&err)
+	return s.store(id, &operation{reference: payment.Reference, cardHash: payment.CardHash, amount: payment.Amount})
+}
+
+// authorize holds the funds of the payment, they're charged to the account until the hold is voided or captured
+func (s *operationStore) authorize(id string, payment d.PaymentRequest, ttl time.Duration) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.commit(&err)
+	return s.store(id, &operation{reference: payment.Reference, cardHash: payment.CardHash, amount: payment.Amount, onHold: true, expiresAt: time.Now().Add(ttl)})
+}
+
+// store must be called with the lock held
+func (s *operationStore) store(id string, op *operation) error {
+	if op.reference != "" && s.reversals[op.reference] {
+		delete(s.reversals, op.reference)
+		s.changes.reversals[op.reference] = false
+		op.onHold = false
+		op.reversed = true
+	} else if err := s.accounts.debit(op.cardHash, id, op.amount); err != nil {
+		return err
+	}
+
+	op.createdAt = time.Now()
+	s.operations[id] = op
+	s.changes.operations[id] = true
+	if op.reference != "" {
+		s.references[op.reference] = id
+	}
+	return nil
+}
+
+func (s *operationStore) decline(payment d.PaymentRequest, reason *domain.BankError) {
+	if payment.Reference == "" {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Nothing was charged, a decline that can't be written is written with the next change
+	defer s.flush()
+	s.declines[payment.Reference] = &decline{cardHash: payment.CardHash, amount: payment.Amount, reason: reason, createdAt: time.Now()}
+	s.changes.declines[payment.Reference] = true
+}
+
+// answer returns what the bank answered to a payment reference, if it did
+func (s *operationStore) answer(reference string) (string, *domain.BankError, bool) {
+	if reference == "" {
+		return "", nil, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if decline, ok := s.declines[reference]; ok {
+		return "", decline.reason, true
+	}
+
+	id, ok := s.references[reference]
+	if ok && s.flush() != nil {
+		// The operation of an earlier attempt isn't answered until it's written
+		return "", notStoredApiError(), true
+	}
+	return id, nil, ok
+}
+
+// reverse accepts either the operation id or the payments app reference, since the payments app might not know the
+// id of an operation it never got the answer of. The reversal of an unknown operation is remembered, in case the
+// payment comes after its reversal. What wasn't refunded yet goes back to the account
+func (s *operationStore) reverse(id string) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.commit(&err)
+	if opID, ok := s.references[id]; ok {
+		id = opID
+	}
+
+	op, ok := s.operations[id]
+	if !ok {
+		if id != "" {
+			s.reversals[id] = true
+			s.changes.reversals[id] = true
+		}
+		return errOperationNotFound
+	}
+
+	switch {
+	case op.reversed || op.voided:
+		return errOperationReversed
+	case !op.onHold && op.refunded == op.amount:
+		return errOperationRefunded
+	}
+
+	s.accounts.release(op.cardHash, id, op.amount-op.refunded, op.createdAt)
+	op.onHold = false
+	op.reversed = true
+	s.changes.operations[id] = true
+	return nil
+}
+
+// lookup returns the status of the operation of a payments app reference
+func (s *operationStore) lookup(reference string) (*domain.BankOperation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if decline, ok := s.declines[reference]; ok {
+		return &domain.BankOperation{Reference: reference, Status: defines.OPERATION_DECLINED, Error: decline.reason}, nil
+	}
+
+	id, ok := s.references[reference]
+	if !ok {
+		return nil, errOperationNotFound
+	}
+
+	return &domain.BankOperation{OperationID: id, Reference: reference, Status: s.operations[id].status()}, nil
+}
+
+// view returns an operation by id or payments app reference, declined payments included
+func (s *operationStore) view(id string) (*OperationView, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if op, ok := s.operations[id]; ok {
+		return op.view(id), nil
+	}
+
+	if decline, ok := s.declines[id]; ok {
+		return decline.view(id), nil
+	}
+
+	if opID, ok := s.references[id]; ok {
+		return s.operations[opID].view(opID), nil
+	}
+	return nil, errOperationNotFound
+}
+
+// list returns the operations and the declined payments, the oldest first
+func (s *operationStore) list() []OperationView {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	views := make([]OperationView, 0, len(s.operations)+len(s.declines))
+	for id, op := range s.operations {
+		views = append(views, *op.view(id))
+	}
+	for reference, decline := range s.declines {
+		views = append(views, *decline.view(reference))
+	}
+
+	sort.Slice(views, func(i, j int) bool {
+		return views[i].CreatedAt.Before(views[j].CreatedAt)
+	})
+	return views
+}
+
+func (op *operation) status() string {
+	switch {
+	case op.reversed:
+		return defines.OPERATION_REVERSED
+	case op.voided:
+		return defines.OPERATION_VOIDED
+	case op.onHold:
+		return defines.OPERATION_AUTHORIZED
+	default:
+		return defines.OPERATION_APPROVED
+	}
+}
+
+func (op *operation) view(id string) *OperationView {
+	view := &OperationView{
+		OperationID: id,
+		Reference:   op.reference,
+		CardHash:    op.cardHash,
+		Amount:      op.amount,
+		Refunded:    op.refunded,
+		Status:      op.status(),
+		CreatedAt:   op.createdAt,
+	}
+	if op.onHold {
+		view.ExpiresAt = &op.expiresAt
+	}
+	return view
+}
+
+func (op *operation) model(id string) dbd.BankOperation {
+	model := dbd.BankOperation{
+		OperationID: id,
+		Reference:   op.reference,
+		CardHash:    op.cardHash,
+		Amount:      op.amount,
+		Refunded:    op.refunded,
+		Status:      op.status(),
+	}
+	model.CreatedAt = op.createdAt
+	if op.onHold {
+		expiresAt := op.expiresAt
+		model.ExpiresAt = &expiresAt
+	}
+	return model
+}
+
+func (d *decline) view(reference string) *OperationView {
+	return &OperationView{
+		Reference: reference,
+		CardHash:  d.cardHash,
+		Amount:    d.amount,
+		Status:    defines.OPERATION_DECLINED,
+		Error:     d.reason,
+		CreatedAt: d.createdAt,
+	}
+}
+
+// capture charges the given amount of a hold and releases the rest of it
+func (s *operationStore) capture(id string, amount money.Amount) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.commit(&err)
+	op, err := s.getHold(id)
+	if err != nil {
+		return err
+	}
+
+	if amount <= 0 || amount > op.amount {
+		return errInvalidCaptureAmount
+	}
+
+	s.accounts.release(op.cardHash, id, op.amount-amount, op.createdAt)
+	op.onHold = false
+	op.amount = amount
+	s.changes.operations[id] = true
+	return nil
+}
+
+func (s *operationStore) void(id string) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.commit(&err)
+	op, err := s.getHold(id)
+	if err != nil && !errors.Is(err, errAuthorizationExpired) {
+		return err
+	}
+
+	s.accounts.release(op.cardHash, id, op.amount, op.createdAt)
+	op.onHold = false
+	op.voided = true
+	s.changes.operations[id] = true
+	return nil
+}
+
+// getHold must be called with the lock held
+func (s *operationStore) getHold(id string) (*operation, error) {
+	op, ok := s.operations[id]
+	if !ok {
+		return nil, errOperationNotFound
+	}
+
+	if !op.onHold {
+		return nil, errOperationNotAuthorized
+	}
+
+	if op.expiresAt.Before(time.Now()) {
+		return op, errAuthorizationExpired
+	}
+
+	return op, nil
+}
+
+// refund pays the amount back into the account, as long as it doesn't exceed what's left to refund. A refund with the
+// key of one that was already paid back is done, it's a retry
+func (s *operationStore) refund(id, key string, amount money.Amount) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.commit(&err)
+	op, ok := s.operations[id]
+	if !ok {
+		return errOperationNotFound
+	}
+
+	if refund, ok := s.refunds[key]; ok && key != "" && refund.OperationID == id {
+		return nil
+	}
+
+	switch {
+	case op.voided || op.reversed:
+		return errOperationReversed
+	case op.onHold:
+		return errRefundExceedsAmount
+	case op.refunded == op.amount:
+		return errOperationRefunded
+	case op.refunded+amount > op.amount:
+		return errRefundExceedsAmount
+	}
+
+	op.refunded += amount
+	s.accounts.credit(op.cardHash, id, amount)
+	s.changes.operations[id] = true
+	if key != "" {
+		s.refunds[key] = dbd.BankRefund{Key: key, OperationID: id, Amount: amount}
+		s.changes.refunds[key] = true
+	}
+	return nil
+}
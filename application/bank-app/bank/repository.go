@@ -0,0 +1,198 @@
+package bank
+
+import (
+	"context"
+	"github.com/negarciacamilo/deuna_challenge/application/bank-app/database"
+	dbd "github.com/negarciacamilo/deuna_challenge/application/domain/database"
+	"github.com/uptrace/bun"
+)
+
+// repository stores the state of a bank, so it survives restarts. The bank works on its state in memory and writes
+// every change through to it
+type repository interface {
+	load() (*rows, error)
+	save(rows *rows) error
+	reset() error
+}
+
+// rows are the stored state of a bank, or the part of it a change writes
+type rows struct {
+	accounts   []dbd.BankAccount
+	entries    []dbd.BankLedgerEntry
+	operations []dbd.BankOperation
+	declines   []dbd.BankDecline
+	reversals  []dbd.BankEarlyReversal
+	refunds    []dbd.BankRefund
+	// The early reversals whose payment came
+	consumed []string
+}
+
+func (r *rows) empty() bool {
+	return len(r.accounts)+len(r.entries)+len(r.operations)+len(r.declines)+len(r.reversals)+len(r.refunds)+len(r.consumed) == 0
+}
+
+// changes are what changed since the state was last stored: the keys of what has to be written again and the
+// movements of the ledger
+type changes struct {
+	accounts   map[string]bool
+	operations map[string]bool
+	declines   map[string]bool
+	// Early reversals, true if one was added and false if its payment came
+	reversals map[string]bool
+	// Refunds by idempotency key
+	refunds map[string]bool
+	entries []dbd.BankLedgerEntry
+}
+
+func newChanges() *changes {
+	c := &changes{}
+	c.clear()
+	return c
+}
+
+func (c *changes) clear() {
+	c.accounts = make(map[string]bool)
+	c.operations = make(map[string]bool)
+	c.declines = make(map[string]bool)
+	c.reversals = make(map[string]bool)
+	c.refunds = make(map[string]bool)
+	c.entries = nil
+}
+
+// newRepository stores the state in the database, without one the state is lost when the bank stops
+func newRepository(bankID uint64, db database.Database) repository {
+	if db == nil {
+		return memoryRepository{}
+	}
+	return &dbRepository{bankID: bankID, db: db}
+}
+
+type memoryRepository struct{}
+
+func (memoryRepository) load() (*rows, error) {
+	return &rows{}, nil
+}
+
+func (memoryRepository) save(*rows) error {
+	return nil
+}
+
+func (memoryRepository) reset() error {
+	return nil
+}
+
+type dbRepository struct {
+	bankID uint64
+	db     database.Database
+}
+
+// load reads the state of the bank, the ledger is only written
+func (r *dbRepository) load() (*rows, error) {
+	ctx := context.Background()
+	db := r.db.GetDB()
+	stored := &rows{}
+	for _, model := range []any{&stored.accounts, &stored.operations, &stored.declines, &stored.reversals, &stored.refunds} {
+		if err := db.NewSelect().Model(model).Where("bank_id = ?", r.bankID).Scan(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return stored, nil
+}
+
+// save writes the changes in a single transaction, so the ledger always matches the balances
+func (r *dbRepository) save(changes *rows) error {
+	for i := range changes.accounts {
+		changes.accounts[i].BankID = r.bankID
+	}
+	for i := range changes.entries {
+		changes.entries[i].BankID = r.bankID
+	}
+	for i := range changes.operations {
+		changes.operations[i].BankID = r.bankID
+	}
+	for i := range changes.declines {
+		changes.declines[i].BankID = r.bankID
+	}
+	for i := range changes.reversals {
+		changes.reversals[i].BankID = r.bankID
+	}
+	for i := range changes.refunds {
+		changes.refunds[i].BankID = r.bankID
+	}
+
+	return r.db.GetDB().RunInTx(context.Background(), nil, func(ctx context.Context, tx bun.Tx) error {
+		if len(changes.accounts) > 0 {
+			_, err := tx.NewInsert().Model(&changes.accounts).
+				On("CONFLICT (bank_id, card_hash) DO UPDATE").
+				Set("balance = EXCLUDED.balance").
+				Set("spent = EXCLUDED.spent").
+				Set("day = EXCLUDED.day").
+				Set("updated_at = current_timestamp").
+				Returning("NULL").Exec(ctx)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(changes.entries) > 0 {
+			if _, err := tx.NewInsert().Model(&changes.entries).Returning("NULL").Exec(ctx); err != nil {
+				return err
+			}
+		}
+
+		if len(changes.operations) > 0 {
+			_, err := tx.NewInsert().Model(&changes.operations).
+				On("CONFLICT (bank_id, operation_id) DO UPDATE").
+				Set("amount = EXCLUDED.amount").
+				Set("refunded = EXCLUDED.refunded").
+				Set("status = EXCLUDED.status").
+				Set("expires_at = EXCLUDED.expires_at").
+				Set("updated_at = current_timestamp").
+				Returning("NULL").Exec(ctx)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(changes.declines) > 0 {
+			if _, err := tx.NewInsert().Model(&changes.declines).On("CONFLICT (bank_id, reference) DO NOTHING").Returning("NULL").Exec(ctx); err != nil {
+				return err
+			}
+		}
+
+		if len(changes.reversals) > 0 {
+			if _, err := tx.NewInsert().Model(&changes.reversals).On("CONFLICT (bank_id, operation_id) DO NOTHING").Returning("NULL").Exec(ctx); err != nil {
+				return err
+			}
+		}
+
+		if len(changes.refunds) > 0 {
+			if _, err := tx.NewInsert().Model(&changes.refunds).On("CONFLICT (bank_id, key) DO NOTHING").Returning("NULL").Exec(ctx); err != nil {
+				return err
+			}
+		}
+
+		if len(changes.consumed) > 0 {
+			_, err := tx.NewDelete().Model((*dbd.BankEarlyReversal)(nil)).
+				Where("bank_id = ?", r.bankID).
+				Where("operation_id IN (?)", bun.In(changes.consumed)).
+				ForceDelete().Exec(ctx)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// reset removes the whole state of the bank, the ledger included
+func (r *dbRepository) reset() error {
+	return r.db.GetDB().RunInTx(context.Background(), nil, func(ctx context.Context, tx bun.Tx) error {
+		for _, model := range []any{(*dbd.BankAccount)(nil), (*dbd.BankLedgerEntry)(nil), (*dbd.BankOperation)(nil), (*dbd.BankDecline)(nil), (*dbd.BankEarlyReversal)(nil), (*dbd.BankRefund)(nil)} {
+			if _, err := tx.NewDelete().Model(model).Where("bank_id = ?", r.bankID).ForceDelete().Exec(ctx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
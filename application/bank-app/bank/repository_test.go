@@ -0,0 +1,163 @@
+package bank
+
+import (
+	"errors"
+	"github.com/negarciacamilo/deuna_challenge/application/defines"
+	dbd "github.com/negarciacamilo/deuna_challenge/application/domain/database"
+	"github.com/negarciacamilo/deuna_challenge/application/money"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// tableRepository keeps the rows the way the database does
+type tableRepository struct {
+	accounts   map[string]dbd.BankAccount
+	entries    []dbd.BankLedgerEntry
+	operations map[string]dbd.BankOperation
+	declines   map[string]dbd.BankDecline
+	reversals  map[string]dbd.BankEarlyReversal
+	refunds    map[string]dbd.BankRefund
+	fail       bool
+}
+
+func newTableRepository() *tableRepository {
+	r := &tableRepository{}
+	_ = r.reset()
+	return r
+}
+
+func (r *tableRepository) load() (*rows, error) {
+	stored := &rows{}
+	for _, a := range r.accounts {
+		stored.accounts = append(stored.accounts, a)
+	}
+	for _, o := range r.operations {
+		stored.operations = append(stored.operations, o)
+	}
+	for _, d := range r.declines {
+		stored.declines = append(stored.declines, d)
+	}
+	for _, rv := range r.reversals {
+		stored.reversals = append(stored.reversals, rv)
+	}
+	for _, rf := range r.refunds {
+		stored.refunds = append(stored.refunds, rf)
+	}
+	return stored, nil
+}
+
+func (r *tableRepository) save(changes *rows) error {
+	if r.fail {
+		return errors.New("connection refused")
+	}
+
+	for _, a := range changes.accounts {
+		r.accounts[a.CardHash] = a
+	}
+	r.entries = append(r.entries, changes.entries...)
+	for _, o := range changes.operations {
+		r.operations[o.OperationID] = o
+	}
+	for _, d := range changes.declines {
+		r.declines[d.Reference] = d
+	}
+	for _, rv := range changes.reversals {
+		r.reversals[rv.OperationID] = rv
+	}
+	for _, rf := range changes.refunds {
+		if _, ok := r.refunds[rf.Key]; !ok {
+			r.refunds[rf.Key] = rf
+		}
+	}
+	for _, id := range changes.consumed {
+		delete(r.reversals, id)
+	}
+	return nil
+}
+
+func (r *tableRepository) reset() error {
+	r.accounts = make(map[string]dbd.BankAccount)
+	r.entries = nil
+	r.operations = make(map[string]dbd.BankOperation)
+	r.declines = make(map[string]dbd.BankDecline)
+	r.reversals = make(map[string]dbd.BankEarlyReversal)
+	r.refunds = make(map[string]dbd.BankRefund)
+	return nil
+}
+
+func TestRepository(t *testing.T) {
+	t.Run("The state survives a restart", func(t *testing.T) {
+		setupAccounts(t)
+		repo := newTableRepository()
+		s := newOperationStore(repo)
+
+		authorization := payment("card", "20")
+		authorization.Reference = "ref-2"
+		declined := payment("card", "5")
+		declined.Reference = "ref-3"
+		require.NoError(t, s.add("1", payment("card", "30")))
+		require.NoError(t, s.authorize("2", authorization, time.Hour))
+		require.NoError(t, s.refund("1", "refund-key", money.MustParse("10")))
+		s.decline(declined, scenarioError(invalidCardScenario))
+		require.ErrorIs(t, s.reverse("ref-4"), errOperationNotFound)
+		require.Len(t, repo.entries, 3)
+
+		restarted := newOperationStore(repo)
+		require.Equal(t, money.MustParse("60"), balance(restarted, "card"))
+		require.Equal(t, money.MustParse("50"), restarted.accounts.accounts["card"].spent)
+
+		view, err := restarted.view("ref-2")
+		require.NoError(t, err)
+		require.Equal(t, defines.OPERATION_AUTHORIZED, view.Status)
+		require.NotNil(t, view.ExpiresAt)
+
+		// A retry of the refund isn't paid back again
+		require.NoError(t, restarted.refund("1", "refund-key", money.MustParse("10")))
+		require.Equal(t, money.MustParse("60"), balance(restarted, "card"))
+		require.Equal(t, money.MustParse("10"), repo.operations["1"].Refunded)
+
+		_, bankErr, ok := restarted.answer("ref-3")
+		require.True(t, ok)
+		require.Equal(t, defines.INVALID_CARD_DECLINE, bankErr.DeclineCode)
+
+		// The payment of the early reversal comes after the restart
+		late := payment("card", "5")
+		late.Reference = "ref-4"
+		require.NoError(t, restarted.add("4", late))
+		require.Equal(t, defines.OPERATION_REVERSED, repo.operations["4"].Status)
+		require.Empty(t, repo.reversals)
+
+		require.NoError(t, restarted.reset())
+		require.Empty(t, repo.operations)
+		require.Equal(t, money.MustParse("100"), balance(newOperationStore(repo), "card"))
+	})
+
+	t.Run("Changes that can't be stored fail the operation and are stored with the next ones", func(t *testing.T) {
+		setupAccounts(t)
+		repo := newTableRepository()
+		s := newOperationStore(repo)
+
+		repo.fail = true
+		first := payment("card", "30")
+		first.Reference = "ref"
+		require.ErrorIs(t, s.add("1", first), errNotStored)
+		require.Empty(t, repo.operations)
+
+		// A retry isn't answered until the operation is stored
+		_, bankErr, ok := s.answer("ref")
+		require.True(t, ok)
+		require.True(t, bankErr.Retryable)
+
+		repo.fail = false
+		require.NoError(t, s.add("2", payment("card", "10")))
+		require.Len(t, repo.operations, 2)
+		require.Len(t, repo.entries, 2)
+		require.Equal(t, money.MustParse("60"), repo.accounts["card"].Balance)
+
+		id, bankErr, ok := s.answer("ref")
+		require.True(t, ok)
+		require.Nil(t, bankErr)
+		require.Equal(t, "1", id)
+	})
+}
@@ -0,0 +1,84 @@
+package bank
+
+import (
+	"github.com/negarciacamilo/deuna_challenge/application/defines"
+	"github.com/negarciacamilo/deuna_challenge/application/domain"
+	d "github.com/negarciacamilo/deuna_challenge/application/payments-app/domain"
+	"github.com/spf13/viper"
+	"net/http"
+	"time"
+)
+
+// Scenarios triggered by the test cards and the magic amounts, whatever the state of the account
+const (
+	insufficientFundsScenario = "insufficient_funds"
+	limitExceededScenario     = "limit_exceeded"
+	invalidCardScenario       = "invalid_card"
+	bankErrorScenario         = "bank_error"
+	// The payment is approved after BANK_TIMEOUT_DELAY, when the payments app is no longer waiting for it
+	timeoutScenario = "timeout"
+	// The payment is approved after BANK_SLOW_APPROVAL_DELAY
+	slowApprovalScenario = "slow_approval"
+)
+
+var scenarios = []string{insufficientFundsScenario, limitExceededScenario, invalidCardScenario, bankErrorScenario, timeoutScenario, slowApprovalScenario}
+
+// testCards are the card hashes that always trigger a scenario
+var testCards = map[string]string{
+	"test_card_insufficient_funds": insufficientFundsScenario,
+	"test_card_limit_exceeded":     limitExceededScenario,
+	"test_card_invalid":            invalidCardScenario,
+	"test_card_bank_error":         bankErrorScenario,
+	"test_card_timeout":            timeoutScenario,
+	"test_card_slow_approval":      slowApprovalScenario,
+}
+
+// magicCents are the cents of the amounts that trigger a scenario when BANK_MAGIC_AMOUNTS is on, e.g. 10.51
+var magicCents = map[int64]string{
+	51: insufficientFundsScenario,
+	52: limitExceededScenario,
+	53: invalidCardScenario,
+	54: bankErrorScenario,
+	55: timeoutScenario,
+	56: slowApprovalScenario,
+}
+
+// scenarioOf returns the scenario a payment triggers, if any. Test cards come before magic amounts
+func scenarioOf(payment d.PaymentRequest) string {
+	if scenario, ok := testCards[payment.CardHash]; ok {
+		return scenario
+	}
+
+	if viper.GetBool("BANK_MAGIC_AMOUNTS") {
+		return magicCents[payment.Amount.MinorUnits()%100]
+	}
+	return ""
+}
+
+// scenarioDelay is how long the bank takes to answer in a scenario
+func scenarioDelay(scenario string) time.Duration {
+	switch scenario {
+	case timeoutScenario:
+		return viper.GetDuration("BANK_TIMEOUT_DELAY")
+	case slowApprovalScenario:
+		return viper.GetDuration("BANK_SLOW_APPROVAL_DELAY")
+	default:
+		return 0
+	}
+}
+
+// scenarioError returns the decline of a scenario, the rest of them are approved if the account allows it
+func scenarioError(scenario string) *domain.BankError {
+	switch scenario {
+	case insufficientFundsScenario:
+		return domain.NewBankError(http.StatusBadRequest, defines.INSUFFICIENT_FUNDS_DECLINE, defines.CLIENT_INVALID_BALANCE, false)
+	case limitExceededScenario:
+		return domain.NewBankError(http.StatusBadRequest, defines.LIMIT_EXCEEDED_DECLINE, defines.CLIENT_HAS_EXCEEDED_LIMIT, false)
+	case invalidCardScenario:
+		return domain.NewBankError(http.StatusBadRequest, defines.INVALID_CARD_DECLINE, defines.INVALID_CARD_HASH, false)
+	case bankErrorScenario:
+		return domain.NewBankError(http.StatusInternalServerError, defines.TRANSACTION_FAILED_DECLINE, defines.BANK_TX_FAILED, true)
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,71 @@
+package bank
+
+import (
+	"github.com/negarciacamilo/deuna_challenge/application/bank-app/faults"
+	"github.com/negarciacamilo/deuna_challenge/application/defines"
+	"github.com/negarciacamilo/deuna_challenge/application/money"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func setupScenarios(t *testing.T) *handler {
+	setupAccounts(t)
+	viper.Set("BANK_MAGIC_AMOUNTS", true)
+	viper.Set("BANK_SLOW_APPROVAL_DELAY", "20ms")
+	viper.Set("BANK_TIMEOUT_DELAY", "40ms")
+	return NewHandler(1, faults.NewInjector(), nil).(*handler)
+}
+
+func TestScenarios(t *testing.T) {
+	t.Run("Test cards and magic amounts decline whatever the account", func(t *testing.T) {
+		h := setupScenarios(t)
+
+		for cardHash, declineCode := range map[string]string{
+			"test_card_insufficient_funds": defines.INSUFFICIENT_FUNDS_DECLINE,
+			"test_card_limit_exceeded":     defines.LIMIT_EXCEEDED_DECLINE,
+			"test_card_invalid":            defines.INVALID_CARD_DECLINE,
+		} {
+			_, bankErr := h.pay(payment(cardHash, "1"), false)
+			require.Equal(t, declineCode, bankErr.DeclineCode)
+		}
+
+		_, bankErr := h.pay(payment("card", "10.54"), false)
+		require.Equal(t, defines.TRANSACTION_FAILED_DECLINE, bankErr.DeclineCode)
+		require.Equal(t, http.StatusInternalServerError, bankErr.Status())
+		require.True(t, bankErr.Retryable)
+
+		viper.Set("BANK_MAGIC_AMOUNTS", false)
+		_, bankErr = h.pay(payment("card", "10.54"), false)
+		require.Nil(t, bankErr)
+		require.Equal(t, money.MustParse("89.46"), balance(h.operations, "card"))
+	})
+
+	t.Run("Slow scenarios are approved late", func(t *testing.T) {
+		h := setupScenarios(t)
+
+		start := time.Now()
+		_, bankErr := h.pay(payment("test_card_slow_approval", "1"), false)
+		require.Nil(t, bankErr)
+		require.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+
+		start = time.Now()
+		_, bankErr = h.pay(payment("card", "1.55"), true)
+		require.Nil(t, bankErr)
+		require.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+	})
+
+	t.Run("A payment that comes after its reversal isn't charged", func(t *testing.T) {
+		h := setupScenarios(t)
+		p := payment("test_card_timeout", "10")
+		p.Reference = "ref"
+
+		go h.operations.reverse("ref")
+		id, bankErr := h.pay(p, false)
+		require.Nil(t, bankErr)
+		require.True(t, h.operations.operations[id].reversed)
+		require.Equal(t, money.MustParse("100"), balance(h.operations, "test_card_timeout"))
+	})
+}
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"github.com/negarciacamilo/deuna_challenge/application/bank-app/bank"
+	"github.com/negarciacamilo/deuna_challenge/application/bank-app/database"
+	"github.com/negarciacamilo/deuna_challenge/application/bank-app/faults"
 	"github.com/negarciacamilo/deuna_challenge/application/bank-app/http"
+	"github.com/negarciacamilo/deuna_challenge/application/domain"
 	"github.com/spf13/viper"
 	"log"
 	"os"
@@ -18,7 +22,39 @@ func main() {
 		panic(err)
 	}
 
-	if err = http.NewRouter().Run(viper.GetString("BANK_PORT")); err != nil {
+	banks, err := domain.GetBankConfigs()
+	if err != nil {
 		log.Panic(err)
 	}
+
+	// The banks share a database and keep their rows apart by bank id. Without BANK_DSN they only keep their state in
+	// memory, so a restart starts them over
+	var db database.Database
+	if viper.GetString("BANK_DSN") != "" {
+		db = database.New()
+	}
+
+	// Every bank is simulated on its own port, with its own operations. The ISO 8583 link of a bank shares them with
+	// its HTTP API
+	errs := make(chan error)
+	for bankID, config := range banks {
+		// The faults are shared too, so they can be changed through the HTTP API for both
+		injector := faults.NewInjector()
+		handler := bank.NewHandler(bankID, injector, db)
+		if config.Port != "" {
+			go func(bankID uint64, config domain.BankConfig) {
+				log.Printf("simulating bank %d (%s) on %s", bankID, config.Name, config.Port)
+				errs <- http.NewRouter(config, handler, injector).Run(config.Port)
+			}(bankID, config)
+		}
+
+		if config.ISOPort != "" {
+			go func(bankID uint64, config domain.BankConfig) {
+				log.Printf("simulating the ISO 8583 link of bank %d (%s) on %s", bankID, config.Name, config.ISOPort)
+				errs <- handler.ListenISO(config.ISOPort)
+			}(bankID, config)
+		}
+	}
+
+	log.Panic(<-errs)
 }
@@ -0,0 +1,85 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	dbd "github.com/negarciacamilo/deuna_challenge/application/domain/database"
+	"github.com/negarciacamilo/deuna_challenge/application/logger"
+	"github.com/spf13/viper"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+// Database is the one of the simulated banks, every bank keeps its rows by bank id
+type Database interface {
+	GetDB() *bun.DB
+	GetMock() sqlmock.Sqlmock
+}
+
+type database struct {
+	db   *bun.DB
+	mock sqlmock.Sqlmock
+}
+
+func New(forTest ...bool) Database {
+	if forTest != nil && forTest[0] {
+		mockdb, mock, _ := sqlmock.New()
+		db := bun.NewDB(mockdb, pgdialect.New())
+		return &database{db: db, mock: mock}
+	}
+
+	sqlb := sql.OpenDB(pgdriver.NewConnector(pgdriver.WithDSN(viper.GetString("BANK_DSN"))))
+	db := bun.NewDB(sqlb, pgdialect.New())
+
+	if err := db.Ping(); err != nil {
+		logger.Panic("can't ping DB", "new-db", err, nil)
+	}
+
+	createTables(db)
+	migrate(db)
+
+	return &database{db: db, mock: nil}
+}
+
+func (d *database) GetDB() *bun.DB {
+	return d.db
+}
+
+func (d *database) GetMock() sqlmock.Sqlmock {
+	return d.mock
+}
+
+func createTables(db *bun.DB) {
+	models := []interface{}{
+		(*dbd.BankAccount)(nil),
+		(*dbd.BankLedgerEntry)(nil),
+		(*dbd.BankOperation)(nil),
+		(*dbd.BankDecline)(nil),
+		(*dbd.BankEarlyReversal)(nil),
+		(*dbd.BankRefund)(nil),
+	}
+
+	for _, model := range models {
+		if _, err := db.NewCreateTable().IfNotExists().Model(model).Exec(context.Background()); err != nil {
+			logger.Panic(fmt.Sprintf("can't create table %s", model), "create-tables", err, nil)
+		}
+	}
+}
+
+// migrations add the columns added to the tables after they were created, which creating them doesn't. They're run in
+// order on every start, so each one must be safe to run again
+var migrations = []string{
+	"ALTER TABLE bank_operations ADD COLUMN IF NOT EXISTS status varchar NOT NULL DEFAULT 'approved'",
+	"ALTER TABLE bank_operations ADD COLUMN IF NOT EXISTS expires_at timestamptz",
+}
+
+func migrate(db *bun.DB) {
+	for _, migration := range migrations {
+		if _, err := db.ExecContext(context.Background(), migration); err != nil {
+			logger.Panic(fmt.Sprintf("can't run the migration %s", migration), "migrate", err, nil)
+		}
+	}
+}
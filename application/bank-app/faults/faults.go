@@ -0,0 +1,235 @@
+package faults
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Faults that can be injected into an answer of the bank. An error is answered instead of performing the operation,
+// the rest happen after the operation is performed, so the bank did it but its answer gets lost
+const (
+	NoFault = ""
+	// ErrorFault answers a retryable error, as if the bank was unavailable
+	ErrorFault = "error"
+	// ResetFault closes the connection without answering
+	ResetFault = "reset"
+	// TruncateFault sends half of the answer and closes the connection
+	TruncateFault = "truncate"
+	// HangFault never answers, the connection stays open until the client gives up
+	HangFault = "hang"
+)
+
+// Latency distributions
+const (
+	FixedDistribution       = "fixed"
+	UniformDistribution     = "uniform"
+	NormalDistribution      = "normal"
+	ExponentialDistribution = "exponential"
+)
+
+// AnyEndpoint is the endpoint of the profile used by the endpoints without a profile of their own
+const AnyEndpoint = "*"
+
+var ErrInvalidProfile = errors.New("invalid fault profile")
+
+// Duration is a time.Duration that's written as a string in JSON, e.g. "250ms"
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+// Latency is how long the bank takes to answer. A fixed latency takes the mean, a uniform one is between min and max,
+// and a normal or exponential one has the mean (and the standard deviation), bounded by min and max if they're set
+type Latency struct {
+	Distribution string   `json:"distribution"`
+	Mean         Duration `json:"mean,omitempty"`
+	StdDev       Duration `json:"std_dev,omitempty"`
+	Min          Duration `json:"min,omitempty"`
+	Max          Duration `json:"max,omitempty"`
+}
+
+// Profile is how an endpoint misbehaves. The rates go from 0 to 1 and together they can't go over 1
+type Profile struct {
+	Latency      *Latency `json:"latency,omitempty"`
+	ErrorRate    float64  `json:"error_rate,omitempty"`
+	ResetRate    float64  `json:"reset_rate,omitempty"`
+	TruncateRate float64  `json:"truncate_rate,omitempty"`
+	HangRate     float64  `json:"hang_rate,omitempty"`
+}
+
+// Fault is what happens to a request
+type Fault struct {
+	Delay time.Duration
+	Kind  string
+}
+
+// Injector keeps the fault profiles of a bank by endpoint
+type Injector struct {
+	mu       sync.Mutex
+	profiles map[string]Profile
+	rand     *rand.Rand
+}
+
+func NewInjector() *Injector {
+	return &Injector{
+		profiles: make(map[string]Profile),
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Profiles returns the profiles by endpoint
+func (i *Injector) Profiles() map[string]Profile {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	profiles := make(map[string]Profile, len(i.profiles))
+	for endpoint, profile := range i.profiles {
+		profiles[endpoint] = profile
+	}
+	return profiles
+}
+
+// Set replaces the profiles by endpoint, AnyEndpoint applies to the endpoints without a profile
+func (i *Injector) Set(profiles map[string]Profile) error {
+	for endpoint, profile := range profiles {
+		if err := profile.Validate(); err != nil {
+			return fmt.Errorf("%w of %s", err, endpoint)
+		}
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.profiles = make(map[string]Profile, len(profiles))
+	for endpoint, profile := range profiles {
+		i.profiles[endpoint] = profile
+	}
+	return nil
+}
+
+// Reset removes every profile, the bank behaves again
+func (i *Injector) Reset() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.profiles = make(map[string]Profile)
+}
+
+// Pick decides the fault of a request to the endpoint. The profile of the request, if there's one, is used instead of
+// the profile of the endpoint
+func (i *Injector) Pick(endpoint string, override *Profile) Fault {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	profile, ok := i.profiles[endpoint]
+	if !ok {
+		profile = i.profiles[AnyEndpoint]
+	}
+	if override != nil {
+		profile = *override
+	}
+
+	fault := Fault{}
+	if profile.Latency != nil {
+		fault.Delay = profile.Latency.sample(i.rand)
+	}
+
+	r := i.rand.Float64()
+	for _, f := range []struct {
+		kind string
+		rate float64
+	}{
+		{ErrorFault, profile.ErrorRate},
+		{ResetFault, profile.ResetRate},
+		{TruncateFault, profile.TruncateRate},
+		{HangFault, profile.HangRate},
+	} {
+		if r < f.rate {
+			fault.Kind = f.kind
+			break
+		}
+		r -= f.rate
+	}
+	return fault
+}
+
+// ParseProfile reads the profile of a single request, which is sent as JSON
+func ParseProfile(s string) (*Profile, error) {
+	profile := &Profile{}
+	if err := json.Unmarshal([]byte(s), profile); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidProfile, err.Error())
+	}
+
+	if err := profile.Validate(); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+func (p Profile) Validate() error {
+	total := 0.0
+	for _, rate := range []float64{p.ErrorRate, p.ResetRate, p.TruncateRate, p.HangRate} {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("%w: the rates go from 0 to 1", ErrInvalidProfile)
+		}
+		total += rate
+	}
+
+	if total > 1 {
+		return fmt.Errorf("%w: the rates can't add up to more than 1", ErrInvalidProfile)
+	}
+
+	if p.Latency == nil {
+		return nil
+	}
+
+	l := p.Latency
+	switch {
+	case l.Distribution != FixedDistribution && l.Distribution != UniformDistribution && l.Distribution != NormalDistribution && l.Distribution != ExponentialDistribution:
+		return fmt.Errorf("%w: unknown latency distribution %q", ErrInvalidProfile, l.Distribution)
+	case l.Mean < 0 || l.StdDev < 0 || l.Min < 0 || l.Max < 0:
+		return fmt.Errorf("%w: the latency can't be negative", ErrInvalidProfile)
+	case l.Max > 0 && l.Min > l.Max:
+		return fmt.Errorf("%w: the min latency is over the max", ErrInvalidProfile)
+	case l.Distribution == UniformDistribution && l.Max == 0:
+		return fmt.Errorf("%w: a uniform latency needs a max", ErrInvalidProfile)
+	}
+	return nil
+}
+
+// sample must be called with the lock of the injector held, the source isn't safe for concurrent use
+func (l *Latency) sample(r *rand.Rand) time.Duration {
+	var delay float64
+	switch l.Distribution {
+	case UniformDistribution:
+		delay = float64(l.Min) + r.Float64()*float64(l.Max-l.Min)
+	case NormalDistribution:
+		delay = float64(l.Mean) + r.NormFloat64()*float64(l.StdDev)
+	case ExponentialDistribution:
+		delay = r.ExpFloat64() * float64(l.Mean)
+	default:
+		delay = float64(l.Mean)
+	}
+
+	delay = math.Max(delay, float64(l.Min))
+	if l.Max > 0 {
+		delay = math.Min(delay, float64(l.Max))
+	}
+	return time.Duration(delay)
+}
@@ -0,0 +1,80 @@
+package faults
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestPick(t *testing.T) {
+	t.Run("The rates decide the fault", func(t *testing.T) {
+		i := NewInjector()
+		require.NoError(t, i.Set(map[string]Profile{
+			"pay":       {HangRate: 1},
+			AnyEndpoint: {ErrorRate: 1},
+		}))
+
+		require.Equal(t, HangFault, i.Pick("pay", nil).Kind)
+		require.Equal(t, ErrorFault, i.Pick("refund", nil).Kind)
+		require.Equal(t, TruncateFault, i.Pick("pay", &Profile{TruncateRate: 1}).Kind)
+
+		i.Reset()
+		require.Equal(t, Fault{}, i.Pick("pay", nil))
+	})
+
+	t.Run("Half of the requests fail", func(t *testing.T) {
+		i := NewInjector()
+		require.NoError(t, i.Set(map[string]Profile{"pay": {ResetRate: 0.5}}))
+
+		resets := 0
+		for n := 0; n < 1000; n++ {
+			if i.Pick("pay", nil).Kind == ResetFault {
+				resets++
+			}
+		}
+		require.InDelta(t, 500, resets, 100)
+	})
+
+	t.Run("The latency stays within its bounds", func(t *testing.T) {
+		i := NewInjector()
+		for _, latency := range []Latency{
+			{Distribution: UniformDistribution, Min: Duration(10 * time.Millisecond), Max: Duration(20 * time.Millisecond)},
+			{Distribution: NormalDistribution, Mean: Duration(15 * time.Millisecond), StdDev: Duration(time.Second), Min: Duration(10 * time.Millisecond), Max: Duration(20 * time.Millisecond)},
+			{Distribution: ExponentialDistribution, Mean: Duration(time.Second), Min: Duration(10 * time.Millisecond), Max: Duration(20 * time.Millisecond)},
+		} {
+			latency := latency
+			for n := 0; n < 100; n++ {
+				delay := i.Pick("pay", &Profile{Latency: &latency}).Delay
+				require.GreaterOrEqual(t, delay, 10*time.Millisecond)
+				require.LessOrEqual(t, delay, 20*time.Millisecond)
+			}
+		}
+
+		fixed := &Latency{Distribution: FixedDistribution, Mean: Duration(time.Second)}
+		require.Equal(t, time.Second, i.Pick("pay", &Profile{Latency: fixed}).Delay)
+	})
+}
+
+func TestParseProfile(t *testing.T) {
+	profile, err := ParseProfile(`{"latency": {"distribution": "normal", "mean": "200ms", "std_dev": "50ms"}, "error_rate": 0.1}`)
+	require.NoError(t, err)
+	require.Equal(t, Duration(200*time.Millisecond), profile.Latency.Mean)
+	require.Equal(t, 0.1, profile.ErrorRate)
+
+	b, err := json.Marshal(profile)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"latency": {"distribution": "normal", "mean": "200ms", "std_dev": "50ms"}, "error_rate": 0.1}`, string(b))
+
+	for _, invalid := range []string{
+		`{"error_rate": 1.5}`,
+		`{"error_rate": 0.6, "hang_rate": 0.6}`,
+		`{"latency": {"distribution": "gaussian"}}`,
+		`{"latency": {"distribution": "uniform", "min": "1s"}}`,
+		`{"latency": {"distribution": "fixed", "mean": "soon"}}`,
+		`not json`,
+	} {
+		_, err := ParseProfile(invalid)
+		require.ErrorIs(t, err, ErrInvalidProfile, invalid)
+	}
+}
@@ -0,0 +1,102 @@
+package http
+
+import (
+	stdcontext "context"
+	"github.com/gin-gonic/gin"
+	"github.com/negarciacamilo/deuna_challenge/application/apierrors"
+	"github.com/negarciacamilo/deuna_challenge/application/bank-app/bank"
+	"github.com/negarciacamilo/deuna_challenge/application/bank-app/faults"
+	"github.com/negarciacamilo/deuna_challenge/application/context"
+	"github.com/negarciacamilo/deuna_challenge/application/idempotency"
+	"github.com/negarciacamilo/deuna_challenge/application/logger"
+	"github.com/negarciacamilo/deuna_challenge/application/response"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// admin lets the state of the bank be inspected and changed while it runs
+type admin struct {
+	handler     bank.Handler
+	injector    *faults.Injector
+	idempotency *resettableStore
+}
+
+func (a *admin) getFaults(c *gin.Context) {
+	ctx := context.GetContextInformation(c)
+	response.Respond(ctx, response.New(http.StatusOK, a.injector.Profiles()), nil)
+}
+
+func (a *admin) setFaults(c *gin.Context) {
+	ctx := context.GetContextInformation(c)
+	var profiles map[string]faults.Profile
+	if apierr := context.ShouldBindJSON(ctx, &profiles); apierr != nil {
+		response.Respond(ctx, nil, apierr)
+		return
+	}
+
+	if err := a.injector.Set(profiles); err != nil {
+		apierr := apierrors.NewBadRequestApiError(err.Error())
+		logger.Error(apierr.Message(), "set-faults", apierr, ctx)
+		response.Respond(ctx, nil, apierr)
+		return
+	}
+
+	logger.Info("fault profiles changed", "set-faults", ctx, map[string]any{"profiles": profiles})
+	response.Respond(ctx, response.New(http.StatusOK, a.injector.Profiles()), nil)
+}
+
+func (a *admin) resetFaults(c *gin.Context) {
+	ctx := context.GetContextInformation(c)
+	a.injector.Reset()
+	response.Respond(ctx, response.New(http.StatusNoContent, nil), nil)
+}
+
+// reset leaves the bank as it started: no operations, accounts, idempotency keys, faults nor scenario
+func (a *admin) reset(c *gin.Context) {
+	ctx := context.GetContextInformation(c)
+	if err := a.handler.Reset(); err != nil {
+		apierr := apierrors.NewInternalServerApiError("can't reset the bank", err)
+		logger.Error(apierr.Message(), "reset-bank", apierr, ctx)
+		response.Respond(ctx, nil, apierr)
+		return
+	}
+
+	a.injector.Reset()
+	a.idempotency.reset()
+	response.Respond(ctx, response.New(http.StatusNoContent, nil), nil)
+}
+
+// resettableStore is an in-memory idempotency store that can forget every key at once
+type resettableStore struct {
+	mu    sync.RWMutex
+	store idempotency.Store
+}
+
+func newResettableStore() *resettableStore {
+	return &resettableStore{store: idempotency.NewMemoryStore()}
+}
+
+func (s *resettableStore) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.store = idempotency.NewMemoryStore()
+}
+
+func (s *resettableStore) current() idempotency.Store {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.store
+}
+
+func (s *resettableStore) Begin(ctx stdcontext.Context, key, fingerprint string, inProgressTTL time.Duration) (*idempotency.Record, bool, error) {
+	return s.current().Begin(ctx, key, fingerprint, inProgressTTL)
+}
+
+func (s *resettableStore) Complete(ctx stdcontext.Context, key string, record *idempotency.Record, ttl time.Duration) error {
+	return s.current().Complete(ctx, key, record, ttl)
+}
+
+func (s *resettableStore) Release(ctx stdcontext.Context, key string) error {
+	return s.current().Release(ctx, key)
+}
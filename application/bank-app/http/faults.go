@@ -0,0 +1,147 @@
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/negarciacamilo/deuna_challenge/application/apierrors"
+	"github.com/negarciacamilo/deuna_challenge/application/bank-app/faults"
+	"github.com/negarciacamilo/deuna_challenge/application/defines"
+	"github.com/negarciacamilo/deuna_challenge/application/domain"
+	"github.com/negarciacamilo/deuna_challenge/application/logger"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// endpoints are the names of the routes in the fault profiles, the same names the payments app gives to the operations
+var endpoints = map[string]string{
+	"/pay":                          "pay",
+	"/authorize":                    "authorize",
+	"/payments/:paymentID/refund":   "refund",
+	"/payments/:paymentID/reversal": "reversal",
+	"/payments/:paymentID/capture":  "capture",
+	"/payments/:paymentID/void":     "void",
+	"/operations/:reference":        "operation",
+}
+
+// injectFaults delays and breaks the answers of the bank with the fault profile of the endpoint, or the one of the
+// X-Bank-Faults header. It goes before every other middleware, so a lost answer is lost with its headers and all
+func injectFaults(injector *faults.Injector) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		endpoint, ok := endpoints[c.FullPath()]
+		if !ok {
+			c.Next()
+			return
+		}
+
+		var override *faults.Profile
+		if header := c.GetHeader(defines.BankFaults); header != "" {
+			profile, err := faults.ParseProfile(header)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, domain.ToBankError(apierrors.NewBadRequestApiError(err.Error())))
+				return
+			}
+			override = profile
+		}
+
+		fault := injector.Pick(endpoint, override)
+		if fault.Kind != faults.NoFault || fault.Delay > 0 {
+			logger.Info("injecting a fault", "inject-faults", nil, map[string]any{"endpoint": endpoint, "fault": fault.Kind, "delay": fault.Delay.String()})
+		}
+
+		select {
+		case <-time.After(fault.Delay):
+		case <-c.Request.Context().Done():
+			c.Abort()
+			return
+		}
+
+		switch fault.Kind {
+		case faults.NoFault:
+			c.Next()
+		case faults.ErrorFault:
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, domain.NewBankError(http.StatusServiceUnavailable, defines.BANK_UNAVAILABLE_DECLINE, defines.BANK_UNAVAILABLE, true))
+		default:
+			loseAnswer(c, fault.Kind)
+		}
+	}
+}
+
+// loseAnswer performs the operation but the payments app never gets its answer
+func loseAnswer(c *gin.Context, kind string) {
+	w := c.Writer
+	captured := &captureWriter{ResponseWriter: w, status: http.StatusOK}
+	c.Writer = captured
+	c.Next()
+	c.Writer = w
+
+	if kind == faults.HangFault {
+		<-c.Request.Context().Done()
+	}
+
+	conn, _, err := w.Hijack()
+	if err != nil {
+		logger.Error("can't take over the connection", "inject-faults", err, nil)
+		return
+	}
+	defer conn.Close()
+
+	switch kind {
+	case faults.ResetFault:
+		if tcp, ok := conn.(*net.TCPConn); ok {
+			// Closing with no linger sends a RST instead of a FIN
+			_ = tcp.SetLinger(0)
+		}
+	case faults.TruncateFault:
+		body := captured.body.Bytes()
+		var head bytes.Buffer
+		fmt.Fprintf(&head, "HTTP/1.1 %d %s\r\n", captured.status, http.StatusText(captured.status))
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		_ = w.Header().Write(&head)
+		head.WriteString("\r\n")
+		_, _ = conn.Write(append(head.Bytes(), body[:len(body)/2]...))
+	}
+}
+
+// captureWriter keeps the answer instead of sending it
+type captureWriter struct {
+	gin.ResponseWriter
+	body    bytes.Buffer
+	status  int
+	written bool
+}
+
+func (w *captureWriter) WriteHeader(status int) {
+	if !w.written {
+		w.status = status
+	}
+}
+
+func (w *captureWriter) WriteHeaderNow() {
+	w.written = true
+}
+
+func (w *captureWriter) Write(data []byte) (int, error) {
+	w.written = true
+	return w.body.Write(data)
+}
+
+func (w *captureWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *captureWriter) Written() bool {
+	return w.written
+}
+
+func (w *captureWriter) Status() int {
+	return w.status
+}
+
+func (w *captureWriter) Size() int {
+	return w.body.Len()
+}
+
+func (w *captureWriter) Flush() {}
@@ -10,6 +10,7 @@ import (
 	"github.com/negarciacamilo/deuna_challenge/application/context"
 	"github.com/negarciacamilo/deuna_challenge/application/defines"
 	"github.com/negarciacamilo/deuna_challenge/application/domain"
+	"github.com/negarciacamilo/deuna_challenge/application/idempotency"
 	"github.com/negarciacamilo/deuna_challenge/application/logger"
 	"github.com/negarciacamilo/deuna_challenge/application/response"
 
@@ -74,7 +75,16 @@ func getResponseFromContext(c *gin.Context) (int, interface{}) {
 	return 0, nil
 }
 
+// useBankErrors turns the error of the response into one of the bank error protocol, so the payments app gets the same
+// body whether the error comes from the operations or from the middlewares
+func useBankErrors(c *gin.Context) {
+	if apierr, ok := c.Keys[response.ResponseKey].(apierrors.ApiError); ok {
+		c.Keys[response.ResponseKey] = domain.ToBankError(apierr)
+	}
+}
+
 func respondAndLogResponse(c *gin.Context, elapsed int64, shouldLog bool) {
+	useBankErrors(c)
 	status, response := getResponseFromContext(c)
 	logRequest(OutcomingResponse, elapsed, c, shouldLog)
 	if response == nil {
@@ -170,3 +180,100 @@ func logRequestHandler() gin.HandlerFunc {
 		respondAndLogResponse(c, time.Since(start).Nanoseconds(), shouldLog)
 	}
 }
+
+// idempotencyKeyCheck deduplicates the operations like a real acquirer does. The payments app sends an idempotency key
+// with every operation that moves money, and a retry with the same key gets the answer of the first request, with the
+// same operation id, instead of being charged again. Unlike the payments app, the bank keeps them in memory, the refunds
+// are also deduplicated by their key with the operations, which are stored
+func idempotencyKeyCheck(store idempotency.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		h := c.GetHeader(defines.IdempotencyKey)
+		if h == "" || c.Request.Method == http.MethodGet {
+			c.Next()
+			return
+		}
+
+		ctx := context.GetContextInformation(c)
+		ctx.RequestInfo.IdempotencyKey = &h
+		// The operation id of the refunds and reversals is in the path
+		key := idempotency.Key("", c.Request.Method, c.Request.URL.Path, h)
+		tags := map[string]any{"idempotency_key": h}
+
+		reqBody, _ := io.ReadAll(c.Request.Body)
+		c.Request.Body = io.NopCloser(bytes.NewBuffer(reqBody))
+		fingerprint := idempotency.Fingerprint(reqBody)
+
+		record, first, err := store.Begin(c, key, fingerprint, idempotency.InProgressTTL())
+		if err != nil {
+			apierr := apierrors.NewInternalServerApiError("can't check the idempotency key", err)
+			logger.Error(apierr.Message(), "idempotency-key-check", err, ctx, tags)
+			response.Respond(ctx, nil, apierr)
+			c.Abort()
+			return
+		}
+
+		if !first {
+			var apierr apierrors.ApiError
+			switch {
+			case record.Fingerprint != fingerprint:
+				apierr = apierrors.NewApiError("the idempotency key was already used with a different request body", "idempotency_key_mismatch", http.StatusUnprocessableEntity, nil)
+			case record.InProgress:
+				apierr = apierrors.NewApiError("a request with the same idempotency key is still being processed, retry later", "idempotency_key_in_use", http.StatusConflict, nil)
+			}
+
+			if apierr != nil {
+				logger.Error(apierr.Message(), "idempotency-key-check", apierr, ctx, tags)
+				response.Respond(ctx, nil, apierr)
+				c.Abort()
+				return
+			}
+
+			c.Header(defines.IdempotentReplayed, "true")
+			c.Keys[response.StatusKey] = record.Status
+			if len(record.Body) > 0 {
+				c.Keys[response.ResponseKey] = record.Body
+			}
+			c.Abort()
+			return
+		}
+
+		c.Next()
+
+		// The failed transactions aren't stored by the bank, so retrying them is a new operation
+		useBankErrors(c)
+		status, resp := getResponseFromContext(c)
+		if status == 0 || status >= http.StatusInternalServerError {
+			store.Release(c, key) // nolint
+			return
+		}
+
+		var body json.RawMessage
+		if resp != nil {
+			body, _ = json.Marshal(resp)
+		}
+		if err := store.Complete(c, key, &idempotency.Record{Fingerprint: fingerprint, Status: status, Body: body}, idempotency.TTL(c.Request.Method, c.FullPath())); err != nil {
+			logger.Error("can't store the idempotent response", "idempotency-key-check", err, ctx, tags)
+		}
+	}
+}
+
+// authorizeClient checks the credentials of the payments app, a bank without an api key accepts every request
+func authorizeClient(apiKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if apiKey == "" || strings.Contains(c.Request.URL.Path, "/ping") {
+			c.Next()
+			return
+		}
+
+		if c.GetHeader(defines.Authorization) != apiKey {
+			ctx := context.GetContextInformation(c)
+			apierr := apierrors.NewUnauthorizedApiError()
+			logger.Error(apierr.Message(), "authorize-client", apierr, ctx)
+			response.Respond(ctx, nil, apierr)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -4,30 +4,48 @@ import (
 	"github.com/gin-contrib/gzip"
 	"github.com/gin-gonic/gin"
 	"github.com/negarciacamilo/deuna_challenge/application/bank-app/bank"
+	"github.com/negarciacamilo/deuna_challenge/application/bank-app/faults"
 	"github.com/negarciacamilo/deuna_challenge/application/context"
+	"github.com/negarciacamilo/deuna_challenge/application/domain"
 	"github.com/negarciacamilo/deuna_challenge/application/response"
 	"net/http"
 )
 
-func NewRouter() *gin.Engine {
+// NewRouter returns the router of a simulated bank, the injector holds the faults of its answers
+func NewRouter(config domain.BankConfig, handler bank.Handler, injector *faults.Injector) *gin.Engine {
 	gin.SetMode(gin.DebugMode)
 	router := gin.New()
+	router.Use(injectFaults(injector))
 	router.Use(gzip.Gzip(gzip.DefaultCompression))
 	router.Use(gin.Logger())
 	router.Use(logRequestHandler())
 	router.Use(generateContext())
 	router.NoRoute(noRouteHandler)
-	mapRoutes(router)
+	router.Use(authorizeClient(config.APIKey))
+	store := newResettableStore()
+	router.Use(idempotencyKeyCheck(store))
+	mapRoutes(router, handler, &admin{handler: handler, injector: injector, idempotency: store})
 	return router
 }
 
-func mapRoutes(router *gin.Engine) {
-	handler := bank.NewHandler()
-
+func mapRoutes(router *gin.Engine, handler bank.Handler, admin *admin) {
 	router.GET("/ping", ping)
 	router.POST("/pay", handler.Pay)
 	router.PUT("/payments/:paymentID/reversal", handler.PerformReversal)
 	router.PUT("/payments/:paymentID/refund", handler.RefundPayment)
+	router.POST("/authorize", handler.Authorize)
+	router.PUT("/payments/:paymentID/capture", handler.Capture)
+	router.PUT("/payments/:paymentID/void", handler.Void)
+	router.GET("/operations/:reference", handler.GetOperation)
+
+	router.GET("/admin/operations", handler.ListOperations)
+	router.GET("/admin/operations/:operationID", handler.InspectOperation)
+	router.GET("/admin/scenario", handler.GetScenario)
+	router.PUT("/admin/scenario", handler.SetScenario)
+	router.GET("/admin/faults", admin.getFaults)
+	router.PUT("/admin/faults", admin.setFaults)
+	router.DELETE("/admin/faults", admin.resetFaults)
+	router.POST("/admin/reset", admin.reset)
 }
 
 func ping(c *gin.Context) {
@@ -1,10 +1,14 @@
 package domain
 
+import (
+	"github.com/negarciacamilo/deuna_challenge/application/money"
+)
+
 type CardIsValidRequest struct {
 	CardHash string `json:"card_hash"`
 }
 
 type ClientHasEnoughBalanceRequest struct {
-	ClientID uint64  `json:"client_id"`
-	Amount   float64 `json:"amount"`
+	ClientID uint64       `json:"client_id"`
+	Amount   money.Amount `json:"amount"`
 }
@@ -44,6 +44,16 @@ func ShouldBindJSON(c *domain.ContextInformation, i interface{}) apierrors.ApiEr
 	return nil
 }
 
+// ShouldBindOptionalJSON works like ShouldBindJSON but an empty body is not considered an error
+func ShouldBindOptionalJSON(c *domain.ContextInformation, i interface{}) apierrors.ApiError {
+	if err := c.GinContext.ShouldBindJSON(i); err != nil && !errors.Is(err, io.EOF) {
+		apierr := apierrors.NewBadRequestApiError(err.Error())
+		logger.Error(apierr.Message(), strings.ToLower(strings.ReplaceAll(logger.GetCallerFunctionName(), ".", "-")), err, c)
+		return apierr
+	}
+	return nil
+}
+
 func ParseParamToUInt(ctx *domain.ContextInformation, paramName string) (uint64, apierrors.ApiError) {
 	param := ctx.GinContext.Param(paramName)
 
@@ -56,3 +66,32 @@ func ParseParamToUInt(ctx *domain.ContextInformation, paramName string) (uint64,
 
 	return uint64(paramToInt), nil
 }
+
+// ParseMerchantParam parses the merchant id param and checks that it's the merchant that is calling
+func ParseMerchantParam(ctx *domain.ContextInformation, paramName string) (uint64, apierrors.ApiError) {
+	merchantID, apierr := ParseParamToUInt(ctx, paramName)
+	if apierr != nil {
+		return 0, apierr
+	}
+
+	user := ctx.RequestInfo.AuthenticatedUser
+	if user == nil || user.MerchantID == nil || *user.MerchantID != merchantID {
+		apierr = apierrors.NewForbiddenApiError("you can only access your own merchant resources")
+		logger.Error(apierr.Message(), strings.ToLower(strings.ReplaceAll(logger.GetCallerFunctionName(), ".", "-")), apierr, ctx, map[string]any{paramName: merchantID})
+		return 0, apierr
+	}
+
+	return merchantID, nil
+}
+
+// RequireOperator checks that the caller is an operator, it's meant to be used by the back office endpoints
+func RequireOperator(ctx *domain.ContextInformation) apierrors.ApiError {
+	user := ctx.RequestInfo.AuthenticatedUser
+	if user == nil || !user.Operator {
+		apierr := apierrors.NewForbiddenApiError("only operators can access this resource")
+		logger.Error(apierr.Message(), strings.ToLower(strings.ReplaceAll(logger.GetCallerFunctionName(), ".", "-")), apierr, ctx)
+		return apierr
+	}
+
+	return nil
+}
@@ -5,4 +5,34 @@ const (
 	CLIENT_INVALID_BALANCE    = "client has not enough balance"
 	CLIENT_HAS_EXCEEDED_LIMIT = "client has exceeded limit"
 	BANK_TX_FAILED            = "bank transaction failed"
+	INVALID_REFUND_AMOUNT     = "invalid refund amount"
+	REFUND_EXCEEDS_AMOUNT     = "refund exceeds the operation amount"
+	OPERATION_NOT_FOUND       = "operation not found"
+	OPERATION_NOT_AUTHORIZED  = "operation is not an authorization on hold"
+	AUTHORIZATION_EXPIRED     = "authorization has expired"
+	INVALID_CAPTURE_AMOUNT    = "invalid capture amount"
+	CURRENCY_NOT_SUPPORTED    = "currency not supported by the bank"
+	ALREADY_REVERSED          = "operation was already reversed"
+	ALREADY_REFUNDED          = "operation was already refunded"
+	// Set by the payments app while the circuit breaker of the bank is open
+	BANK_UNAVAILABLE = "bank unavailable"
+)
+
+// Decline codes of the bank errors, the payments app maps them to ISO 8583 codes
+const (
+	INVALID_CARD_DECLINE             = "invalid_card"
+	INSUFFICIENT_FUNDS_DECLINE       = "insufficient_funds"
+	LIMIT_EXCEEDED_DECLINE           = "limit_exceeded"
+	CURRENCY_NOT_SUPPORTED_DECLINE   = "currency_not_supported"
+	TRANSACTION_FAILED_DECLINE       = "transaction_failed"
+	INVALID_AMOUNT_DECLINE           = "invalid_amount"
+	REFUND_EXCEEDS_AMOUNT_DECLINE    = "refund_exceeds_amount"
+	OPERATION_NOT_FOUND_DECLINE      = "operation_not_found"
+	OPERATION_NOT_AUTHORIZED_DECLINE = "operation_not_authorized"
+	AUTHORIZATION_EXPIRED_DECLINE    = "authorization_expired"
+	OPERATION_REVERSED_DECLINE       = "operation_reversed"
+	OPERATION_REFUNDED_DECLINE       = "operation_refunded"
+	BANK_UNAVAILABLE_DECLINE         = "bank_unavailable"
+	// The bank answered with something that isn't an error of the protocol
+	UNKNOWN_DECLINE = "unknown"
 )
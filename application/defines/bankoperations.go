@@ -0,0 +1,23 @@
+package defines
+
+// Statuses of an operation at the bank
+const (
+	OPERATION_APPROVED   = "approved"
+	OPERATION_AUTHORIZED = "authorized"
+	OPERATION_VOIDED     = "voided"
+	OPERATION_REVERSED   = "reversed"
+	OPERATION_DECLINED   = "declined"
+)
+
+// Protocols of the link with a bank
+const (
+	HTTP_PROTOCOL    = "http"
+	ISO8583_PROTOCOL = "iso8583"
+)
+
+// Movements of the ledger of a bank account
+const (
+	LEDGER_CHARGE  = "charge"
+	LEDGER_RELEASE = "release"
+	LEDGER_REFUND  = "refund"
+)
@@ -4,4 +4,15 @@ const (
 	Authorization  = "Authorization"
 	XRequestID     = "X-Request-ID"
 	IdempotencyKey = "X-Idempotency-Key"
+	// Set when the response is a replay of the first request with the same idempotency key
+	IdempotentReplayed = "Idempotent-Replayed"
+
+	WebhookSignature  = "X-Webhook-Signature"
+	WebhookEvent      = "X-Webhook-Event"
+	WebhookDeliveryID = "X-Webhook-Delivery-ID"
+
+	OutboxEventID = "X-Outbox-Event-ID"
+
+	// BankFaults carries the fault profile of a single request to the bank simulator
+	BankFaults = "X-Bank-Faults"
 )
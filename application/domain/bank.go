@@ -1,5 +1,66 @@
 package domain
 
+import (
+	"github.com/negarciacamilo/deuna_challenge/application/money"
+	"github.com/spf13/viper"
+	"strconv"
+	"time"
+)
+
+// BankConfig is the setup of a bank, it's shared by both apps. The payments app calls it at URL and the bank app
+// simulates it on Port
+type BankConfig struct {
+	Name   string `mapstructure:"name"`
+	URL    string `mapstructure:"url"`
+	Port   string `mapstructure:"port"`
+	APIKey string `mapstructure:"api_key"`
+	// Protocol is how the payments app talks to the bank, http (default) or iso8583. With iso8583 it connects to
+	// ISOAddress and the bank app listens on ISOPort
+	Protocol   string `mapstructure:"protocol"`
+	ISOAddress string `mapstructure:"iso_address"`
+	ISOPort    string `mapstructure:"iso_port"`
+	// Timeout overrides BANK_TIMEOUT and Timeouts overrides it for some operations
+	Timeout  time.Duration            `mapstructure:"timeout"`
+	Timeouts map[string]time.Duration `mapstructure:"timeouts"`
+	// ErrorCodes maps the errors of the bank to ISO 8583 codes, it overrides the default mapping
+	ErrorCodes map[string]string `mapstructure:"error_codes"`
+}
+
+// GetBankConfigs returns the banks set in the BANKS config by bank id
+func GetBankConfigs() (map[uint64]BankConfig, error) {
+	var configs map[string]BankConfig
+	if err := viper.UnmarshalKey("BANKS", &configs); err != nil {
+		return nil, err
+	}
+
+	banks := make(map[uint64]BankConfig, len(configs))
+	for id, config := range configs {
+		bankID, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		banks[bankID] = config
+	}
+	return banks, nil
+}
+
 type BankResponse struct {
 	OperationID string `json:"operation_id"`
 }
+
+type BankRefundRequest struct {
+	Amount money.Amount `json:"amount"`
+}
+
+type BankCaptureRequest struct {
+	Amount money.Amount `json:"amount"`
+}
+
+// BankOperation is what the bank knows about the operation of a payment reference
+type BankOperation struct {
+	OperationID string `json:"operation_id,omitempty"`
+	Reference   string `json:"reference"`
+	Status      string `json:"status"`
+	// Error is the reason of a declined operation
+	Error *BankError `json:"error,omitempty"`
+}
@@ -0,0 +1,80 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/negarciacamilo/deuna_challenge/application/apierrors"
+	"net/http"
+)
+
+// BankErrorVersion is the version of the error body the banks answer with. A body of another version is an unknown
+// error for the payments app
+const BankErrorVersion = 1
+
+// BankError is the body of every error of the banks. It's an ApiError, so the bank app responds with it as any other
+// error
+type BankError struct {
+	Version      int    `json:"version"`
+	ErrorStatus  int    `json:"status"`
+	DeclineCode  string `json:"decline_code"`
+	ErrorMessage string `json:"message"`
+	// Retryable tells if the bank might answer differently if asked again
+	Retryable bool `json:"retryable"`
+	// BankReference identifies the failed attempt at the bank
+	BankReference string `json:"bank_reference,omitempty"`
+}
+
+func NewBankError(status int, declineCode, message string, retryable bool) *BankError {
+	reference, _ := uuid.NewV7()
+	return &BankError{
+		Version:       BankErrorVersion,
+		ErrorStatus:   status,
+		DeclineCode:   declineCode,
+		ErrorMessage:  message,
+		Retryable:     retryable,
+		BankReference: reference.String(),
+	}
+}
+
+// ToBankError turns any error into one of the protocol, the errors that aren't declines keep their code
+func ToBankError(apierr apierrors.ApiError) *BankError {
+	var bankErr *BankError
+	if errors.As(apierr, &bankErr) {
+		return bankErr
+	}
+	return NewBankError(apierr.Status(), apierr.Code(), apierr.Message(), IsRetryableStatus(apierr.Status()))
+}
+
+// IsRetryableStatus tells if a request answered with the status might succeed if it's sent again
+func IsRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	case http.StatusConflict:
+		// The first attempt is still running
+		return true
+	}
+	return false
+}
+
+func (e *BankError) Message() string {
+	return e.ErrorMessage
+}
+
+// Code is the decline code
+func (e *BankError) Code() string {
+	return e.DeclineCode
+}
+
+func (e *BankError) Status() int {
+	return e.ErrorStatus
+}
+
+func (e *BankError) Cause() apierrors.CauseList {
+	return apierrors.CauseList{}
+}
+
+func (e *BankError) Error() string {
+	return fmt.Sprintf("Message: %s;Decline Code: %s;Status: %d;Retryable: %t;Bank Reference: %s", e.ErrorMessage, e.DeclineCode, e.ErrorStatus, e.Retryable, e.BankReference)
+}
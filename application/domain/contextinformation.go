@@ -13,21 +13,32 @@ type ContextInformation struct {
 
 type AuthenticatedUser struct {
 	ClientID uint64 `json:"client_id"`
+	// MerchantID is only set when the caller is a merchant
+	MerchantID *uint64 `json:"merchant_id,omitempty"`
+	// Operator is true for the payments platform staff
+	Operator bool `json:"operator,omitempty"`
 }
 
 type RequestInfo struct {
 	RequestID         string
 	AuthenticatedUser *AuthenticatedUser
 	IdempotencyKey    *string
+	// BankFaults is the fault profile the bank simulator is asked to use for the bank calls of the request
+	BankFaults string
 }
 
 func (c *ContextInformation) GetCtx() context.Context {
-	if !environment.IsDockerEnv() {
+	if !environment.IsDockerEnv() || c.GinContext == nil {
 		return context.Background()
 	}
 	return c.GinContext
 }
 
+// BackgroundContext is meant to be used by the jobs that don't run within a request
+func BackgroundContext() *ContextInformation {
+	return &ContextInformation{RequestInfo: &RequestInfo{}}
+}
+
 func TestContext() *ContextInformation {
 	return &ContextInformation{
 		RequestInfo: &RequestInfo{
@@ -0,0 +1,36 @@
+package database
+
+import "github.com/negarciacamilo/deuna_challenge/application/money"
+
+// BankAccount is the card account of a client at a simulated bank
+type BankAccount struct {
+	Base
+	BankID      uint64       `json:"bank_id" bun:",notnull,unique:bank_account"`
+	CardHash    string       `json:"card_hash" bun:",notnull,unique:bank_account"`
+	Balance     money.Amount `json:"balance" bun:",notnull,type:numeric(12,2),default:0"`
+	CreditLimit money.Amount `json:"credit_limit" bun:",notnull,type:numeric(12,2),default:0"`
+	DailyLimit  money.Amount `json:"daily_limit" bun:",notnull,type:numeric(12,2),default:0"`
+	Blocked     bool         `json:"blocked" bun:",notnull,default:false"`
+	// Spent is what was charged on Day, a UTC date
+	Spent money.Amount `json:"spent" bun:",notnull,type:numeric(12,2),default:0"`
+	Day   string       `json:"day" bun:",nullzero"`
+}
+
+/*
+Type defines the movement
+charge - A payment or an authorization took the funds
+release - A reversal, a void or what's left of a capture gave them back, it's taken out of the daily spend too
+refund - A refund paid them back
+*/
+
+// BankLedgerEntry is a movement of the funds of a bank account, entries are never changed
+type BankLedgerEntry struct {
+	Base
+	BankID      uint64       `json:"bank_id" bun:",notnull"`
+	CardHash    string       `json:"card_hash" bun:",notnull"`
+	OperationID string       `json:"operation_id" bun:",notnull"`
+	Type        string       `json:"type" bun:",notnull"`
+	Amount      money.Amount `json:"amount" bun:",notnull,type:numeric(12,2)"`
+	// Balance is the one the account was left with
+	Balance money.Amount `json:"balance" bun:",notnull,type:numeric(12,2)"`
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"github.com/negarciacamilo/deuna_challenge/application/domain"
+	"github.com/negarciacamilo/deuna_challenge/application/money"
+	"time"
+)
+
+/*
+Status defines the operation status, the same the bank answers when it's asked about it
+approved - The funds were charged
+authorized - The funds are on hold until ExpiresAt, waiting to be captured or voided
+voided - The hold was released
+reversed - The funds that weren't refunded were given back
+*/
+
+// BankOperation is a payment or an authorization processed by a simulated bank
+type BankOperation struct {
+	Base
+	BankID      uint64 `json:"bank_id" bun:",notnull,unique:bank_operation"`
+	OperationID string `json:"operation_id" bun:",notnull,unique:bank_operation"`
+	// Reference is the one the payments app sent, it's empty if it sent none
+	Reference string       `json:"reference,omitempty" bun:",nullzero"`
+	CardHash  string       `json:"card_hash" bun:",notnull"`
+	Amount    money.Amount `json:"amount" bun:",notnull,type:numeric(12,2)"`
+	Refunded  money.Amount `json:"refunded" bun:",notnull,type:numeric(12,2),default:0"`
+	Status    string       `json:"status" bun:",notnull"`
+	ExpiresAt *time.Time   `json:"expires_at,omitempty" bun:",nullzero"`
+}
+
+// BankDecline is a payment declined by a simulated bank, so the payments app can still ask for it by reference
+type BankDecline struct {
+	Base
+	BankID    uint64            `json:"bank_id" bun:",notnull,unique:bank_decline"`
+	Reference string            `json:"reference" bun:",notnull,unique:bank_decline"`
+	CardHash  string            `json:"card_hash" bun:",notnull"`
+	Amount    money.Amount      `json:"amount" bun:",notnull,type:numeric(12,2)"`
+	Error     *domain.BankError `json:"error" bun:"type:jsonb"`
+}
+
+// BankRefund is a refund processed by a simulated bank with the idempotency key it was sent with, so a retried refund
+// isn't paid back twice even after the bank restarts
+type BankRefund struct {
+	Base
+	BankID      uint64       `json:"bank_id" bun:",notnull,unique:bank_refund"`
+	Key         string       `json:"key" bun:",notnull,unique:bank_refund"`
+	OperationID string       `json:"operation_id" bun:",notnull"`
+	Amount      money.Amount `json:"amount" bun:",notnull,type:numeric(12,2)"`
+}
+
+// BankEarlyReversal is the reversal of an operation a simulated bank didn't know about, it's removed when the payment
+// comes and is stored as reversed
+type BankEarlyReversal struct {
+	Base
+	BankID uint64 `json:"bank_id" bun:",notnull,unique:bank_early_reversal"`
+	// OperationID is the operation id or the payments app reference the reversal was asked with
+	OperationID string `json:"operation_id" bun:",notnull,unique:bank_early_reversal"`
+}
@@ -0,0 +1,18 @@
+package database
+
+import (
+	"github.com/uptrace/bun"
+	"time"
+)
+
+// IdempotencyKey is used by the Postgres idempotency store, the expired keys are reused by the next request with the same key
+type IdempotencyKey struct {
+	bun.BaseModel `bun:"table:idempotency_keys"`
+	Key           string    `bun:",pk"`
+	InProgress    bool      `bun:",notnull"`
+	Fingerprint   string    `bun:",notnull"`
+	Status        int       `bun:",notnull,default:0"`
+	Body          []byte    `bun:"type:bytea"`
+	ExpiresAt     time.Time `bun:",notnull"`
+	CreatedAt     time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/brianvoe/gofakeit/v7"
 	"github.com/uptrace/bun"
 	"math/rand"
+	"strings"
 )
 
 type Merchant struct {
@@ -12,6 +13,22 @@ type Merchant struct {
 	Name              string `json:"name"`
 	BankAccountNumber uint64 `json:"bank_account_number"`
 	Email             string `json:"email"`
+	// ISO 4217 codes of the currencies the merchant accepts, if it's empty then every supported currency is accepted
+	AcceptedCurrencies []string           `json:"accepted_currencies,omitempty" bun:",array"`
+	WebhookEndpoints   []*WebhookEndpoint `json:"webhook_endpoints,omitempty" bun:"rel:has-many,join:id=merchant_id"`
+}
+
+func (m *Merchant) AcceptsCurrency(code string) bool {
+	if len(m.AcceptedCurrencies) == 0 {
+		return true
+	}
+
+	for _, c := range m.AcceptedCurrencies {
+		if strings.EqualFold(c, code) {
+			return true
+		}
+	}
+	return false
 }
 
 func (*Merchant) AfterCreateTable(ctx context.Context, query *bun.CreateTableQuery) error {
@@ -24,6 +41,10 @@ func (*Merchant) AfterCreateTable(ctx context.Context, query *bun.CreateTableQue
 			Email:             gofakeit.Email(),
 			BankAccountNumber: uint64(rand.Int63n(9223372036854775807)),
 		}
+		// A couple of local merchants so the currency restriction can be tested
+		if i > 8 {
+			merchant.AcceptedCurrencies = []string{"MXN"}
+		}
 		query.DB().NewInsert().Model(&merchant).On("CONFLICT (id) DO UPDATE").Exec(ctx)
 	}
 	return nil
@@ -0,0 +1,30 @@
+package database
+
+import (
+	"github.com/uptrace/bun"
+	"time"
+)
+
+// OutboxEvent is a payment change waiting to be published. It's written in the same transaction as the change, so
+// an event exists if and only if the change was stored
+type OutboxEvent struct {
+	bun.BaseModel `bun:"table:outbox_events"`
+	Base
+	// AggregateID is the payment the event belongs to, events of the same payment are published in order
+	AggregateID uint64        `json:"aggregate_id" bun:",notnull"`
+	Type        string        `json:"type" bun:",notnull"`
+	Payload     *PaymentEvent `json:"payload" bun:"type:jsonb"`
+	PublishedAt *time.Time    `json:"published_at,omitempty" bun:",nullzero"`
+	Attempts    int           `json:"attempts" bun:",notnull,default:0"`
+	LastError   string        `json:"last_error,omitempty"`
+}
+
+type PaymentEvent struct {
+	PaymentID uint64 `json:"payment_id"`
+	// FromStatus is nil when the payment is created
+	FromStatus *int     `json:"from_status"`
+	ToStatus   int      `json:"to_status"`
+	Actor      string   `json:"actor"`
+	Reason     string   `json:"reason,omitempty"`
+	Payment    *Payment `json:"payment"`
+}
@@ -1,5 +1,12 @@
 package database
 
+import (
+	"encoding/json"
+	"github.com/negarciacamilo/deuna_challenge/application/iso8583"
+	"github.com/negarciacamilo/deuna_challenge/application/money"
+	"time"
+)
+
 /*
 Status defines the payment status. Normally I wouldn't use an ORM and, I'm being honest here, I don't know if it's possible to create an enum with bun, so instead I will just assume
 0 - Pending status
@@ -8,14 +15,18 @@ Status defines the payment status. Normally I wouldn't use an ORM and, I'm being
 3 - Rejected
 4 - Refunded
 5 - Reversal
+6 - Partially refunded
+7 - Authorized (funds on hold, waiting to be captured or voided)
 
-This would be like CREATE TYPE payment_status as ENUM ('approved', 'cancelled', 'rejected', 'pending', 'refunded', 'reversed')
+This would be like CREATE TYPE payment_status as ENUM ('approved', 'cancelled', 'rejected', 'pending', 'refunded', 'reversed', 'partially_refunded', 'authorized')
 And assigning type payment_status to status
 */
 
 type Payment struct {
 	Base
-	Amount     float64   `json:"amount" bun:",notnull,type:numeric(12,2)"`
+	Amount money.Amount `json:"amount" bun:",notnull,type:numeric(12,2)"`
+	// ISO 4217 currency code, refunds and captures are always in the payment currency
+	Currency   string    `json:"currency" bun:",notnull,type:char(3),default:'USD'"`
 	Status     int       `json:"status" bun:",notnull,type:int,default:0"`
 	CustomerID uint64    `bun:",notnull"`
 	Customer   *Customer `bun:"rel:belongs-to,join:customer_id=id"`
@@ -27,4 +38,27 @@ type Payment struct {
 	Code string `json:"code"`
 	// This is the ID that both the bank and the payment platform use to identify the payment
 	OperationID *string `json:"operation_id" bun:",nullzero"`
+	// Reference is sent to the bank before the operation is performed, so a payment that was left pending can be
+	// resolved by asking the bank for it
+	Reference string `json:"reference" bun:",nullzero,unique"`
+	// ReversalStatus is set when the payment was reversed, it's pending until the bank confirms the reversal
+	ReversalStatus string `json:"reversal_status,omitempty" bun:",nullzero"`
+	// This is the sum of every refund performed over this payment
+	RefundedAmount money.Amount `json:"refunded_amount" bun:",notnull,type:numeric(12,2),default:0"`
+	// This is the sum of the refunds sent to the bank that it hasn't answered yet, they can't be refunded again
+	RefundingAmount money.Amount `json:"-" bun:",notnull,type:numeric(12,2),default:0"`
+	Refunds         []*Refund    `json:"refunds,omitempty" bun:"rel:has-many,join:id=payment_id"`
+	// This is the amount held by the bank, the captured one could be lower
+	AuthorizedAmount money.Amount `json:"authorized_amount" bun:",notnull,type:numeric(12,2),default:0"`
+	// After this date the hold is released and the payment can't be captured anymore
+	AuthorizationExpiresAt *time.Time `json:"authorization_expires_at,omitempty" bun:",nullzero"`
+}
+
+// MarshalJSON adds the reason of the code, so the merchants don't need to look it up
+func (p Payment) MarshalJSON() ([]byte, error) {
+	type payment Payment
+	return json.Marshal(struct {
+		payment
+		CodeReason string `json:"code_reason,omitempty"`
+	}{payment(p), iso8583.Reason(p.Code)})
 }
@@ -0,0 +1,17 @@
+package database
+
+import "github.com/uptrace/bun"
+
+// PaymentStatusHistory stores every status transition of a payment, it's the payment audit trail
+type PaymentStatusHistory struct {
+	bun.BaseModel `bun:"table:payment_status_history"`
+	Base
+	PaymentID uint64 `json:"payment_id" bun:",notnull"`
+	// FromStatus is nil when the payment is created
+	FromStatus *int   `json:"from_status"`
+	ToStatus   int    `json:"to_status" bun:",notnull"`
+	Actor      string `json:"actor" bun:",notnull"`
+	Reason     string `json:"reason,omitempty"`
+	// This is the response code based on ISO 8583:2023 that the payment had after the transition
+	Code string `json:"code"`
+}
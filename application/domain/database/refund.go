@@ -0,0 +1,32 @@
+package database
+
+import (
+	"encoding/json"
+	"github.com/negarciacamilo/deuna_challenge/application/iso8583"
+	"github.com/negarciacamilo/deuna_challenge/application/money"
+)
+
+/*
+A payment can be refunded more than once (e.g. a single item from a basket), so every refund is stored as its own row
+and the payment keeps track of the refunded amount so far
+*/
+
+type Refund struct {
+	Base
+	Amount    money.Amount `json:"amount" bun:",notnull,type:numeric(12,2)"`
+	Reason    string       `json:"reason,omitempty"`
+	PaymentID uint64       `json:"payment_id" bun:",notnull"`
+	Payment   *Payment     `json:"-" bun:"rel:belongs-to,join:payment_id=id"`
+	// This is the response code based on ISO 8583:2023
+	Code string `json:"code"`
+}
+
+// MarshalJSON adds the reason of the code, like the payments do. It has its own field, since the reason of the refund
+// is the one the merchant sent
+func (r Refund) MarshalJSON() ([]byte, error) {
+	type refund Refund
+	return json.Marshal(struct {
+		refund
+		CodeReason string `json:"code_reason,omitempty"`
+	}{refund(r), iso8583.Reason(r.Code)})
+}
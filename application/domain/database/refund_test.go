@@ -0,0 +1,32 @@
+package database
+
+import (
+	"encoding/json"
+	"github.com/negarciacamilo/deuna_challenge/application/iso8583"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestRefundMarshalJSON(t *testing.T) {
+	refund := Refund{Reason: "one item was returned", Code: iso8583.Approved}
+
+	b, err := json.Marshal(refund)
+	require.NoError(t, err)
+
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(b, &body))
+	require.Equal(t, "one item was returned", body["reason"])
+	require.Equal(t, iso8583.Reason(iso8583.Approved), body["code_reason"])
+
+	// Inside a payment too
+	b, err = json.Marshal(Payment{Code: iso8583.Approved, Refunds: []*Refund{&refund}})
+	require.NoError(t, err)
+
+	var payment struct {
+		CodeReason string           `json:"code_reason"`
+		Refunds    []map[string]any `json:"refunds"`
+	}
+	require.NoError(t, json.Unmarshal(b, &payment))
+	require.Equal(t, iso8583.Reason(iso8583.Approved), payment.CodeReason)
+	require.Equal(t, "one item was returned", payment.Refunds[0]["reason"])
+}
@@ -0,0 +1,25 @@
+package database
+
+import "time"
+
+/*
+Status defines the reversal status
+pending - The bank didn't confirm it yet, NextAttemptAt says when it's going to be retried
+confirmed - The bank confirmed the reversal
+*/
+
+// Reversal is a bank reversal that failed and is retried until the bank confirms it
+type Reversal struct {
+	Base
+	PaymentID uint64   `json:"payment_id" bun:",notnull"`
+	Payment   *Payment `json:"-" bun:"rel:belongs-to,join:payment_id=id"`
+	// BankID is the bank of the payment, the one that's asked for the reversal
+	BankID uint64 `json:"bank_id" bun:",notnull"`
+	// OperationID is the bank operation id or, if the payments app never got it, the payment reference
+	OperationID   string     `json:"operation_id" bun:",notnull"`
+	Status        string     `json:"status" bun:",notnull"`
+	Attempts      int        `json:"attempts" bun:",notnull,default:0"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty" bun:",nullzero"`
+	LastError     string     `json:"last_error,omitempty"`
+	ConfirmedAt   *time.Time `json:"confirmed_at,omitempty" bun:",nullzero"`
+}
@@ -0,0 +1,46 @@
+package database
+
+import "time"
+
+// WebhookEndpoint is a URL where a merchant wants to be notified about the lifecycle of its payments
+type WebhookEndpoint struct {
+	Base
+	MerchantID uint64    `json:"merchant_id" bun:",notnull"`
+	Merchant   *Merchant `json:"-" bun:"rel:belongs-to,join:merchant_id=id"`
+	URL        string    `json:"url" bun:",notnull"`
+	// Secret is used to sign the deliveries, it's only returned when the endpoint is created
+	Secret string   `json:"secret,omitempty" bun:",notnull"`
+	Events []string `json:"events" bun:",array"`
+}
+
+/*
+Status defines the delivery status
+pending - It wasn't delivered yet, NextAttemptAt says when it's going to be retried
+succeeded - The endpoint answered with a 2xx
+dead - Every retry failed, it can only be redelivered manually
+*/
+
+type WebhookDelivery struct {
+	Base
+	EndpointID    uint64           `json:"endpoint_id" bun:",notnull"`
+	Endpoint      *WebhookEndpoint `json:"-" bun:"rel:belongs-to,join:endpoint_id=id"`
+	MerchantID    uint64           `json:"merchant_id" bun:",notnull"`
+	PaymentID     uint64           `json:"payment_id" bun:",notnull"`
+	Event         string           `json:"event" bun:",notnull"`
+	Payload       *WebhookEvent    `json:"payload" bun:"type:jsonb"`
+	Status        string           `json:"status" bun:",notnull"`
+	Attempts      int              `json:"attempts" bun:",notnull,default:0"`
+	NextAttemptAt *time.Time       `json:"next_attempt_at,omitempty" bun:",nullzero"`
+	// Status code returned by the endpoint the last time it was called, 0 if it couldn't be reached
+	LastResponseStatus int        `json:"last_response_status"`
+	LastError          string     `json:"last_error,omitempty"`
+	DeliveredAt        *time.Time `json:"delivered_at,omitempty" bun:",nullzero"`
+}
+
+// WebhookEvent is the body sent to the merchant, its ID is the same for every endpoint so it can be used to deduplicate
+type WebhookEvent struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      *Payment  `json:"data"`
+}
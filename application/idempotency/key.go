@@ -0,0 +1,27 @@
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// Key scopes the idempotency key sent by a client, so the same key sent by different clients or to different routes
+// are different requests. The route is the registered one, e.g. "/payments/:payment_id/refund"
+func Key(client, method, route, key string) string {
+	return fmt.Sprintf("%s|%s %s|%s", client, method, route, key)
+}
+
+// Fingerprint hashes the request body, a key can only be reused with the same body. JSON bodies are compacted first so
+// only the content matters and not how it's formatted
+func Fingerprint(body []byte) string {
+	compacted := new(bytes.Buffer)
+	if err := json.Compact(compacted, body); err == nil {
+		body = compacted.Bytes()
+	}
+
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,21 @@
+package idempotency
+
+import (
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+func TestKey(t *testing.T) {
+	key := Key("merchant-1", http.MethodPost, "/pay", "abc")
+	require.NotEqual(t, key, Key("merchant-2", http.MethodPost, "/pay", "abc"))
+	require.NotEqual(t, key, Key("merchant-1", http.MethodPut, "/payments/:payment_id/refund", "abc"))
+	require.Equal(t, key, Key("merchant-1", http.MethodPost, "/pay", "abc"))
+}
+
+func TestFingerprint(t *testing.T) {
+	fingerprint := Fingerprint([]byte(`{"amount": 10, "currency": "USD"}`))
+	require.Equal(t, fingerprint, Fingerprint([]byte("{\n  \"amount\":10,\n  \"currency\":\"USD\"\n}")))
+	require.NotEqual(t, fingerprint, Fingerprint([]byte(`{"amount":11,"currency":"USD"}`)))
+	require.Equal(t, Fingerprint(nil), Fingerprint([]byte{}))
+}
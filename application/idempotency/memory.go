@@ -0,0 +1,41 @@
+package idempotency
+
+import (
+	"context"
+	c "github.com/patrickmn/go-cache"
+	"time"
+)
+
+type memoryStore struct {
+	cache *c.Cache
+}
+
+// NewMemoryStore returns a store that keeps the keys in the process memory
+func NewMemoryStore() Store {
+	return &memoryStore{cache: c.New(defaultTTL, 10*time.Minute)}
+}
+
+func (m *memoryStore) Begin(ctx context.Context, key, fingerprint string, inProgressTTL time.Duration) (*Record, bool, error) {
+	// Add is atomic
+	if err := m.cache.Add(key, &Record{InProgress: true, Fingerprint: fingerprint}, inProgressTTL); err == nil {
+		return nil, true, nil
+	}
+
+	r, found := m.cache.Get(key)
+	if !found {
+		// It expired in the meantime
+		return m.Begin(ctx, key, fingerprint, inProgressTTL)
+	}
+
+	return r.(*Record), false, nil
+}
+
+func (m *memoryStore) Complete(ctx context.Context, key string, record *Record, ttl time.Duration) error {
+	m.cache.Set(key, record, ttl)
+	return nil
+}
+
+func (m *memoryStore) Release(ctx context.Context, key string) error {
+	m.cache.Delete(key)
+	return nil
+}
@@ -0,0 +1,194 @@
+package idempotency
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// The store speaks the Redis protocol (RESP) by itself since it only needs SET, GET and DEL, so it works with Redis
+// and any of its drop-in replacements without adding a client library
+
+const redisPoolSize = 10
+
+var errRedisNil = errors.New("redis: nil")
+
+type redisStore struct {
+	addr string
+	// Idle connections, a connection is only used by one command at a time
+	pool chan *redisConn
+}
+
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewRedisStore returns a store that keeps the keys in the Redis listening on addr
+func NewRedisStore(addr string) Store {
+	return &redisStore{addr: addr, pool: make(chan *redisConn, redisPoolSize)}
+}
+
+func (r *redisStore) Begin(ctx context.Context, key, fingerprint string, inProgressTTL time.Duration) (*Record, bool, error) {
+	b, err := json.Marshal(&Record{InProgress: true, Fingerprint: fingerprint})
+	if err != nil {
+		return nil, false, err
+	}
+
+	// NX makes it atomic, it's only set if the key doesn't exist
+	_, err = r.do(ctx, "SET", key, string(b), "NX", "PX", strconv.FormatInt(inProgressTTL.Milliseconds(), 10))
+	if err == nil {
+		return nil, true, nil
+	}
+	if !errors.Is(err, errRedisNil) {
+		return nil, false, err
+	}
+
+	stored, err := r.do(ctx, "GET", key)
+	if errors.Is(err, errRedisNil) {
+		// It expired in the meantime
+		return r.Begin(ctx, key, fingerprint, inProgressTTL)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	var record Record
+	if err := json.Unmarshal([]byte(stored), &record); err != nil {
+		return nil, false, err
+	}
+	return &record, false, nil
+}
+
+func (r *redisStore) Complete(ctx context.Context, key string, record *Record, ttl time.Duration) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.do(ctx, "SET", key, string(b), "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
+
+func (r *redisStore) Release(ctx context.Context, key string) error {
+	_, err := r.do(ctx, "DEL", key)
+	return err
+}
+
+// do sends the command and returns the reply as a string, errRedisNil is returned for null replies
+func (r *redisStore) do(ctx context.Context, args ...string) (string, error) {
+	conn, err := r.getConn(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.conn.SetDeadline(deadline) // nolint
+	} else {
+		conn.conn.SetDeadline(time.Time{}) // nolint
+	}
+
+	reply, err := conn.command(args...)
+	var replyErr redisError
+	if err != nil && !errors.Is(err, errRedisNil) && !errors.As(err, &replyErr) {
+		// The connection is in an unknown state, so it's not reused
+		conn.conn.Close() // nolint
+		return "", err
+	}
+
+	r.putConn(conn)
+	return reply, err
+}
+
+func (r *redisStore) getConn(ctx context.Context) (*redisConn, error) {
+	select {
+	case conn := <-r.pool:
+		return conn, nil
+	default:
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", r.addr)
+	if err != nil {
+		return nil, err
+	}
+	return &redisConn{conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+func (r *redisStore) putConn(conn *redisConn) {
+	select {
+	case r.pool <- conn:
+	default:
+		conn.conn.Close() // nolint
+	}
+}
+
+// redisError is an error reply, the connection can still be used after it
+type redisError string
+
+func (e redisError) Error() string {
+	return string(e)
+}
+
+func (c *redisConn) command(args ...string) (string, error) {
+	cmd := fmt.Sprintf("*%d\r\n", len(args))
+	for _, arg := range args {
+		cmd += fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	if _, err := c.conn.Write([]byte(cmd)); err != nil {
+		return "", err
+	}
+	return c.readReply()
+}
+
+func (c *redisConn) readReply() (string, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return "", err
+	}
+	if line == "" {
+		return "", errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+', ':':
+		return line[1:], nil
+	case '-':
+		return "", redisError(line[1:])
+	case '_':
+		return "", errRedisNil
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return "", err
+		}
+		if size < 0 {
+			return "", errRedisNil
+		}
+
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(c.reader, buf); err != nil {
+			return "", err
+		}
+		return string(buf[:size]), nil
+	}
+	return "", fmt.Errorf("redis: unexpected reply %q", line)
+}
+
+func (c *redisConn) readLine() (string, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("redis: malformed reply %q", line)
+	}
+	return line[:len(line)-2], nil
+}
@@ -0,0 +1,65 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/spf13/viper"
+	"strings"
+	"time"
+)
+
+const (
+	// Like Stripe, by default a key can be reused to get the same response for 24 hours
+	defaultTTL = 24 * time.Hour
+	// If the process dies while handling a request, its key is released after this
+	defaultInProgressTTL = time.Minute
+)
+
+// Record is what's stored for every idempotency key
+type Record struct {
+	// InProgress is true while the first request with the key is being handled
+	InProgress bool `json:"in_progress"`
+	// Fingerprint is the hash of the body of the first request
+	Fingerprint string          `json:"fingerprint"`
+	Status      int             `json:"status"`
+	Body        json.RawMessage `json:"body,omitempty"`
+}
+
+// Store keeps the idempotency keys and the responses to replay. Begin must be atomic, so only one of many concurrent
+// requests with the same key gets to be handled, even among replicas when the store is shared
+type Store interface {
+	// Begin reserves the key for a new request with the given fingerprint for inProgressTTL. If the key was already
+	// used, it returns false and the stored record, which is either the response to replay or an in progress one
+	Begin(ctx context.Context, key, fingerprint string, inProgressTTL time.Duration) (*Record, bool, error)
+	// Complete stores the response of the request, so it's replayed for the following requests with the same key
+	Complete(ctx context.Context, key string, record *Record, ttl time.Duration) error
+	// Release forgets the key, so the next request with it is handled as a new one
+	Release(ctx context.Context, key string) error
+}
+
+// TTL returns for how long the responses of a route are replayed. IDEMPOTENCY_ROUTE_TTLS overrides IDEMPOTENCY_TTL for
+// the routes in it, which are set as "{method} {route}", e.g. "POST /payments/:payment_id/capture"
+func TTL(method, route string) time.Duration {
+	// viper lowercases the keys of the maps read from the config file
+	for r, routeTTL := range viper.GetStringMapString("IDEMPOTENCY_ROUTE_TTLS") {
+		if !strings.EqualFold(r, method+" "+route) {
+			continue
+		}
+		if ttl, err := time.ParseDuration(routeTTL); err == nil && ttl > 0 {
+			return ttl
+		}
+	}
+
+	if ttl := viper.GetDuration("IDEMPOTENCY_TTL"); ttl > 0 {
+		return ttl
+	}
+	return defaultTTL
+}
+
+// InProgressTTL returns for how long a key is reserved while its request is handled
+func InProgressTTL() time.Duration {
+	if ttl := viper.GetDuration("IDEMPOTENCY_IN_PROGRESS_TTL"); ttl > 0 {
+		return ttl
+	}
+	return defaultInProgressTTL
+}
@@ -0,0 +1,83 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// testStore checks the behaviour every store must have
+func testStore(t *testing.T, store Store) {
+	ctx := context.Background()
+
+	t.Run("Begin and complete", func(t *testing.T) {
+		key := "test-begin-and-complete"
+
+		_, first, err := store.Begin(ctx, key, "fingerprint", time.Minute)
+		require.NoError(t, err)
+		require.True(t, first)
+
+		// A retry while the first request is running
+		record, first, err := store.Begin(ctx, key, "fingerprint", time.Minute)
+		require.NoError(t, err)
+		require.False(t, first)
+		require.True(t, record.InProgress)
+		require.Equal(t, "fingerprint", record.Fingerprint)
+
+		err = store.Complete(ctx, key, &Record{Fingerprint: "fingerprint", Status: http.StatusCreated, Body: json.RawMessage(`{"id":1}`)}, time.Minute)
+		require.NoError(t, err)
+		record, first, err = store.Begin(ctx, key, "fingerprint", time.Minute)
+		require.NoError(t, err)
+		require.False(t, first)
+		require.False(t, record.InProgress)
+		require.Equal(t, "fingerprint", record.Fingerprint)
+		require.Equal(t, http.StatusCreated, record.Status)
+		require.JSONEq(t, `{"id":1}`, string(record.Body))
+	})
+
+	t.Run("Release", func(t *testing.T) {
+		key := "test-release"
+
+		_, first, err := store.Begin(ctx, key, "fingerprint", time.Minute)
+		require.NoError(t, err)
+		require.True(t, first)
+
+		require.NoError(t, store.Release(ctx, key))
+		_, first, err = store.Begin(ctx, key, "fingerprint", time.Minute)
+		require.NoError(t, err)
+		require.True(t, first)
+	})
+
+	t.Run("Expired key", func(t *testing.T) {
+		key := "test-expired-key"
+
+		_, first, err := store.Begin(ctx, key, "fingerprint", time.Minute)
+		require.NoError(t, err)
+		require.True(t, first)
+
+		require.NoError(t, store.Complete(ctx, key, &Record{Status: http.StatusNoContent}, 10*time.Millisecond))
+		time.Sleep(20 * time.Millisecond)
+		_, first, err = store.Begin(ctx, key, "fingerprint", time.Minute)
+		require.NoError(t, err)
+		require.True(t, first)
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestTTL(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	require.Equal(t, defaultTTL, TTL(http.MethodPost, "/pay"))
+
+	viper.Set("IDEMPOTENCY_TTL", "1h")
+	viper.Set("IDEMPOTENCY_ROUTE_TTLS", map[string]string{"POST /payments/:payment_id/capture": "10m"})
+	require.Equal(t, time.Hour, TTL(http.MethodPost, "/pay"))
+	require.Equal(t, 10*time.Minute, TTL(http.MethodPost, "/payments/:payment_id/capture"))
+}
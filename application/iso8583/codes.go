@@ -0,0 +1,108 @@
+package iso8583
+
+import (
+	"github.com/negarciacamilo/deuna_challenge/application/defines"
+	"sort"
+)
+
+// Categories of the action codes
+const (
+	ApprovedCategory = "approved"
+	DeclinedCategory = "declined"
+	ErrorCategory    = "error"
+)
+
+// Action codes based on ISO 8583:2023 (https://www.iso.org/standard/79451.html), they're strings cause the 0 padding
+// matters
+const (
+	Approved              = "0000"
+	ApprovedPartialAmount = "0002"
+	RefundApproved        = "0008"
+	DoNotHonour           = "1000"
+	ExpiredCard           = "1001"
+	SuspectedFraud        = "1002"
+	InvalidCardNumber     = "1011"
+	InvalidAmount         = "1013"
+	InsufficientFunds     = "1016"
+	CurrencyNotSupported  = "1019"
+	ExceedsAmountLimit    = "1021"
+	ExceedsFrequencyLimit = "1023"
+	ExceedsCardLimit      = "2011"
+	FormatError           = "9004"
+	IssuerUnavailable     = "9012"
+	DuplicateTransaction  = "9013"
+	SystemError           = "9999"
+)
+
+// Code is an action code of the catalogue
+type Code struct {
+	Code        string `json:"code"`
+	Description string `json:"description"`
+	Category    string `json:"category"`
+	// Retryable tells if the same payment could be approved if it's tried again later
+	Retryable bool `json:"retryable"`
+	// MerchantMessage is meant to be shown to the customer
+	MerchantMessage string `json:"merchant_message"`
+}
+
+var catalogue = map[string]Code{
+	Approved:              {Approved, "Approved", ApprovedCategory, false, "The payment was approved"},
+	ApprovedPartialAmount: {ApprovedPartialAmount, "Approved for a partial amount", ApprovedCategory, false, "The payment was approved for a lower amount"},
+	RefundApproved:        {RefundApproved, "Refund approved", ApprovedCategory, false, "The payment was refunded"},
+	DoNotHonour:           {DoNotHonour, "Do not honour", DeclinedCategory, false, "The payment was declined by the bank, please use another card"},
+	ExpiredCard:           {ExpiredCard, "Expired card", DeclinedCategory, false, "The card has expired, please use another card"},
+	SuspectedFraud:        {SuspectedFraud, "Suspected fraud", DeclinedCategory, false, "The payment was declined by the bank, please use another card"},
+	InvalidCardNumber:     {InvalidCardNumber, "Invalid card number", DeclinedCategory, false, "The card is invalid, please check the card details"},
+	InvalidAmount:         {InvalidAmount, "Invalid amount", DeclinedCategory, false, "The amount of the payment is invalid"},
+	InsufficientFunds:     {InsufficientFunds, "Insufficient funds", DeclinedCategory, true, "The card has not enough funds, please try again later or use another card"},
+	CurrencyNotSupported:  {CurrencyNotSupported, "Transaction not permitted, currency not supported", DeclinedCategory, false, "The bank doesn't accept payments in this currency"},
+	ExceedsAmountLimit:    {ExceedsAmountLimit, "Exceeds amount limit", DeclinedCategory, true, "The payment exceeds the limit of the card, please try again later or use another card"},
+	ExceedsFrequencyLimit: {ExceedsFrequencyLimit, "Exceeds frequency limit", DeclinedCategory, true, "The card has too many payments, please try again later"},
+	ExceedsCardLimit:      {ExceedsCardLimit, "Exceeds the limit of the card", DeclinedCategory, true, "The payment exceeds the limit of the card, please try again later or use another card"},
+	FormatError:           {FormatError, "Format error", ErrorCategory, false, "The payment couldn't be processed"},
+	IssuerUnavailable:     {IssuerUnavailable, "Issuer unavailable", ErrorCategory, true, "The bank is unavailable, please try again later"},
+	DuplicateTransaction:  {DuplicateTransaction, "Duplicate transaction", ErrorCategory, false, "The payment was already processed"},
+	SystemError:           {SystemError, "System error", ErrorCategory, true, "The payment couldn't be processed, please try again later"},
+}
+
+// declines maps the decline codes of the bank errors to action codes, the rest of them are system errors
+var declines = map[string]string{
+	defines.INVALID_CARD_DECLINE:           InvalidCardNumber,
+	defines.INSUFFICIENT_FUNDS_DECLINE:     InsufficientFunds,
+	defines.LIMIT_EXCEEDED_DECLINE:         ExceedsCardLimit,
+	defines.CURRENCY_NOT_SUPPORTED_DECLINE: CurrencyNotSupported,
+	defines.INVALID_AMOUNT_DECLINE:         InvalidAmount,
+	defines.BANK_UNAVAILABLE_DECLINE:       IssuerUnavailable,
+}
+
+// ForDecline returns the action code of a decline code of the bank
+func ForDecline(declineCode string) string {
+	if code, ok := declines[declineCode]; ok {
+		return code
+	}
+	return SystemError
+}
+
+// Lookup returns the code of the catalogue
+func Lookup(code string) (Code, bool) {
+	c, ok := catalogue[code]
+	return c, ok
+}
+
+// Reason is the description of a code, it's empty for the codes that aren't in the catalogue
+func Reason(code string) string {
+	return catalogue[code].Description
+}
+
+// Codes returns the whole catalogue sorted by code
+func Codes() []Code {
+	codes := make([]Code, 0, len(catalogue))
+	for _, c := range catalogue {
+		codes = append(codes, c)
+	}
+
+	sort.Slice(codes, func(i, j int) bool {
+		return codes[i].Code < codes[j].Code
+	})
+	return codes
+}
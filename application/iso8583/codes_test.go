@@ -0,0 +1,24 @@
+package iso8583
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestCatalogue(t *testing.T) {
+	for declineCode, code := range declines {
+		_, ok := Lookup(code)
+		require.True(t, ok, "the code of %s isn't in the catalogue", declineCode)
+	}
+
+	codes := Codes()
+	require.Len(t, codes, len(catalogue))
+	for i := 1; i < len(codes); i++ {
+		require.Less(t, codes[i-1].Code, codes[i].Code)
+	}
+
+	require.Equal(t, InsufficientFunds, ForDecline("insufficient_funds"))
+	require.Equal(t, SystemError, ForDecline("transaction_failed"))
+	require.Equal(t, "Insufficient funds", Reason(InsufficientFunds))
+	require.Empty(t, Reason("1234"))
+}
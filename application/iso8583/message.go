@@ -0,0 +1,304 @@
+package iso8583
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Message type indicators
+const (
+	AuthorizationRequest  = "0100"
+	AuthorizationResponse = "0110"
+	FinancialRequest      = "0200"
+	FinancialResponse     = "0210"
+	CompletionAdvice      = "0220"
+	CompletionResponse    = "0230"
+	ReversalRequest       = "0400"
+	// ReversalRepeat is sent when a reversal was never answered, so the bank can tell it from a new one
+	ReversalRepeat   = "0401"
+	ReversalResponse = "0410"
+	NetworkRequest   = "0800"
+	NetworkResponse  = "0810"
+)
+
+// Data elements of the ISO 8583:1987 layout. The action code has 4 digits, like the codes of the catalogue, and the
+// private fields carry what has no standard field, like the reference of the payment (a uuid doesn't fit into the
+// retrieval reference number)
+const (
+	FieldCardHash       = 2
+	FieldProcessingCode = 3
+	// The amount is in hundredths whatever the currency, like the amounts of the platform
+	FieldAmount             = 4
+	FieldTransmissionTime   = 7
+	FieldSTAN               = 11
+	FieldActionCode         = 39
+	FieldCardAcceptorID     = 42
+	FieldAdditionalResponse = 44
+	FieldReference          = 48
+	FieldCurrency           = 49
+	FieldOperationID        = 62
+	FieldNetworkCode        = 70
+)
+
+// Processing codes of field 3
+const (
+	PurchaseProcessingCode = "000000"
+	RefundProcessingCode   = "200000"
+)
+
+// EchoNetworkCode is the network management code of an echo test
+const EchoNetworkCode = "301"
+
+// TransmissionTimeLayout is the layout of field 7, MMDDhhmmss in UTC
+const TransmissionTimeLayout = "0102150405"
+
+// fieldSpec is how a data element is encoded. Fixed fields have a length, variable ones a length prefix of 2 (LLVAR)
+// or 3 (LLLVAR) digits and a max length
+type fieldSpec struct {
+	length  int
+	prefix  int
+	numeric bool
+	name    string
+}
+
+var specs = map[int]fieldSpec{
+	FieldCardHash:           {length: 99, prefix: 2, name: "card hash"},
+	FieldProcessingCode:     {length: 6, numeric: true, name: "processing code"},
+	FieldAmount:             {length: 12, numeric: true, name: "amount"},
+	FieldTransmissionTime:   {length: 10, numeric: true, name: "transmission date and time"},
+	FieldSTAN:               {length: 6, numeric: true, name: "system trace audit number"},
+	FieldActionCode:         {length: 4, numeric: true, name: "action code"},
+	FieldCardAcceptorID:     {length: 15, name: "card acceptor id"},
+	FieldAdditionalResponse: {length: 99, prefix: 2, name: "additional response data"},
+	FieldReference:          {length: 999, prefix: 3, name: "reference"},
+	FieldCurrency:           {length: 3, numeric: true, name: "currency code"},
+	FieldOperationID:        {length: 999, prefix: 3, name: "operation id"},
+	FieldNetworkCode:        {length: 3, numeric: true, name: "network management code"},
+}
+
+var (
+	ErrInvalidMessage = errors.New("invalid ISO 8583 message")
+	ErrUnknownField   = errors.New("unknown ISO 8583 field")
+)
+
+// Message is an ISO 8583 message, the fields are kept as text and encoded when it's packed
+type Message struct {
+	MTI    string
+	fields map[int]string
+}
+
+func NewMessage(mti string) *Message {
+	return &Message{MTI: mti, fields: make(map[int]string)}
+}
+
+// NewResponse starts the response of a request, with the fields that identify the request
+func NewResponse(request *Message) *Message {
+	response := NewMessage(ResponseMTI(request.MTI))
+	for _, field := range []int{FieldProcessingCode, FieldTransmissionTime, FieldSTAN, FieldReference, FieldNetworkCode} {
+		if request.Has(field) {
+			response.Set(field, request.Get(field))
+		}
+	}
+	return response
+}
+
+// ResponseMTI returns the MTI of the response of a request, e.g. 0210 for 0200 and 0410 for 0401
+func ResponseMTI(mti string) string {
+	if len(mti) != 4 || !isNumeric(mti) {
+		return mti
+	}
+	return mti[:2] + string(mti[2]+1) + "0"
+}
+
+func (m *Message) Set(field int, value string) *Message {
+	m.fields[field] = value
+	return m
+}
+
+func (m *Message) Get(field int) string {
+	return m.fields[field]
+}
+
+func (m *Message) Has(field int) bool {
+	_, ok := m.fields[field]
+	return ok
+}
+
+// Fields returns the fields that are set, in order
+func (m *Message) Fields() []int {
+	fields := make([]int, 0, len(m.fields))
+	for field := range m.fields {
+		fields = append(fields, field)
+	}
+	sort.Ints(fields)
+	return fields
+}
+
+// Pack encodes the message: the MTI, the bitmap (with a secondary one if any field is above 64) and the fields in
+// order, everything in ASCII but the bitmaps
+func (m *Message) Pack() ([]byte, error) {
+	if len(m.MTI) != 4 || !isNumeric(m.MTI) {
+		return nil, fmt.Errorf("%w: bad MTI %q", ErrInvalidMessage, m.MTI)
+	}
+
+	fields := m.Fields()
+	bitmap := make([]byte, 8)
+	if len(fields) > 0 && fields[len(fields)-1] > 64 {
+		bitmap = make([]byte, 16)
+		bitmap[0] |= 0x80
+	}
+
+	var body strings.Builder
+	for _, field := range fields {
+		spec, ok := specs[field]
+		if !ok || field > len(bitmap)*8 {
+			return nil, fmt.Errorf("%w: %d", ErrUnknownField, field)
+		}
+
+		encoded, err := spec.encode(m.fields[field])
+		if err != nil {
+			return nil, err
+		}
+		bitmap[(field-1)/8] |= 0x80 >> ((field - 1) % 8)
+		body.WriteString(encoded)
+	}
+
+	packed := make([]byte, 0, 4+len(bitmap)+body.Len())
+	packed = append(packed, m.MTI...)
+	packed = append(packed, bitmap...)
+	return append(packed, body.String()...), nil
+}
+
+// Unpack decodes a packed message
+func Unpack(data []byte) (*Message, error) {
+	if len(data) < 12 {
+		return nil, fmt.Errorf("%w: too short", ErrInvalidMessage)
+	}
+
+	m := NewMessage(string(data[:4]))
+	if !isNumeric(m.MTI) {
+		return nil, fmt.Errorf("%w: bad MTI %q", ErrInvalidMessage, m.MTI)
+	}
+
+	bitmap := data[4:12]
+	rest := data[12:]
+	if bitmap[0]&0x80 != 0 {
+		if len(data) < 20 {
+			return nil, fmt.Errorf("%w: missing the secondary bitmap", ErrInvalidMessage)
+		}
+		bitmap = data[4:20]
+		rest = data[20:]
+	}
+
+	for field := 2; field <= len(bitmap)*8; field++ {
+		if bitmap[(field-1)/8]&(0x80>>((field-1)%8)) == 0 {
+			continue
+		}
+
+		spec, ok := specs[field]
+		if !ok {
+			return nil, fmt.Errorf("%w: %d", ErrUnknownField, field)
+		}
+
+		value, n, err := spec.decode(rest)
+		if err != nil {
+			return nil, err
+		}
+		m.fields[field] = value
+		rest = rest[n:]
+	}
+
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("%w: %d bytes left after the last field", ErrInvalidMessage, len(rest))
+	}
+	return m, nil
+}
+
+func (s fieldSpec) encode(value string) (string, error) {
+	if len(value) > s.length || (s.numeric && !isNumeric(value)) {
+		return "", fmt.Errorf("%w: bad %s %q", ErrInvalidMessage, s.name, value)
+	}
+
+	if s.prefix > 0 {
+		return fmt.Sprintf("%0*d%s", s.prefix, len(value), value), nil
+	}
+	if s.numeric {
+		return strings.Repeat("0", s.length-len(value)) + value, nil
+	}
+	return value + strings.Repeat(" ", s.length-len(value)), nil
+}
+
+// decode returns the value of the field and how many bytes it takes
+func (s fieldSpec) decode(data []byte) (string, int, error) {
+	length := s.length
+	if s.prefix > 0 {
+		if len(data) < s.prefix {
+			return "", 0, fmt.Errorf("%w: truncated %s", ErrInvalidMessage, s.name)
+		}
+
+		l, err := strconv.Atoi(string(data[:s.prefix]))
+		if err != nil || l > s.length {
+			return "", 0, fmt.Errorf("%w: bad length of the %s", ErrInvalidMessage, s.name)
+		}
+		data = data[s.prefix:]
+		length = l
+	}
+
+	if len(data) < length {
+		return "", 0, fmt.Errorf("%w: truncated %s", ErrInvalidMessage, s.name)
+	}
+
+	value := string(data[:length])
+	if s.numeric && !isNumeric(value) {
+		return "", 0, fmt.Errorf("%w: bad %s %q", ErrInvalidMessage, s.name, value)
+	}
+	if s.prefix == 0 && !s.numeric {
+		value = strings.TrimRight(value, " ")
+	}
+	return value, s.prefix + length, nil
+}
+
+// WriteMessage sends a message over a connection, framed with its length in 2 bytes big endian
+func WriteMessage(w io.Writer, m *Message) error {
+	packed, err := m.Pack()
+	if err != nil {
+		return err
+	}
+
+	if len(packed) > 0xFFFF {
+		return fmt.Errorf("%w: too long", ErrInvalidMessage)
+	}
+
+	frame := make([]byte, 2, 2+len(packed))
+	binary.BigEndian.PutUint16(frame, uint16(len(packed)))
+	_, err = w.Write(append(frame, packed...))
+	return err
+}
+
+// ReadMessage reads a message framed by WriteMessage
+func ReadMessage(r io.Reader) (*Message, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, binary.BigEndian.Uint16(header))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return Unpack(data)
+}
+
+func isNumeric(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,86 @@
+package iso8583
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestPackUnpack(t *testing.T) {
+	request := NewMessage(FinancialRequest).
+		Set(FieldCardHash, "card-hash").
+		Set(FieldProcessingCode, PurchaseProcessingCode).
+		Set(FieldAmount, "1025").
+		Set(FieldSTAN, "42").
+		Set(FieldCardAcceptorID, "7").
+		Set(FieldReference, "0191b6a4-5b7e-7c3e-9f1a-2d4e5f6a7b8c").
+		Set(FieldCurrency, "840")
+
+	packed, err := request.Pack()
+	require.NoError(t, err)
+	require.Equal(t, "0200", string(packed[:4]))
+	// Fields 2, 3, 4, 11, 42, 48 and 49 without a secondary bitmap
+	require.Equal(t, []byte{0x70, 0x20, 0x00, 0x00, 0x00, 0x41, 0x80, 0x00}, packed[4:12])
+	require.Contains(t, string(packed), "000000001025")
+	require.Contains(t, string(packed), "7              ")
+
+	unpacked, err := Unpack(packed)
+	require.NoError(t, err)
+	require.Equal(t, request.MTI, unpacked.MTI)
+	require.Equal(t, request.Fields(), unpacked.Fields())
+	require.Equal(t, "000000001025", unpacked.Get(FieldAmount))
+	require.Equal(t, "000042", unpacked.Get(FieldSTAN))
+	require.Equal(t, "7", unpacked.Get(FieldCardAcceptorID))
+	require.Equal(t, "card-hash", unpacked.Get(FieldCardHash))
+	require.Equal(t, request.Get(FieldReference), unpacked.Get(FieldReference))
+}
+
+func TestSecondaryBitmap(t *testing.T) {
+	echo := NewMessage(NetworkRequest).Set(FieldSTAN, "1").Set(FieldNetworkCode, EchoNetworkCode)
+	packed, err := echo.Pack()
+	require.NoError(t, err)
+	require.Len(t, packed, 4+16+6+3)
+	require.EqualValues(t, 0x80, packed[4]&0x80)
+
+	unpacked, err := Unpack(packed)
+	require.NoError(t, err)
+	require.Equal(t, EchoNetworkCode, unpacked.Get(FieldNetworkCode))
+	require.Equal(t, NetworkResponse, NewResponse(unpacked).MTI)
+}
+
+func TestInvalidMessages(t *testing.T) {
+	_, err := NewMessage("02x0").Pack()
+	require.ErrorIs(t, err, ErrInvalidMessage)
+
+	_, err = NewMessage(FinancialRequest).Set(FieldAmount, "10.25").Pack()
+	require.ErrorIs(t, err, ErrInvalidMessage)
+
+	_, err = NewMessage(FinancialRequest).Set(5, "1").Pack()
+	require.ErrorIs(t, err, ErrUnknownField)
+
+	packed, err := NewMessage(FinancialRequest).Set(FieldReference, "ref").Pack()
+	require.NoError(t, err)
+	_, err = Unpack(packed[:len(packed)-1])
+	require.ErrorIs(t, err, ErrInvalidMessage)
+}
+
+func TestResponseMTI(t *testing.T) {
+	require.Equal(t, AuthorizationResponse, ResponseMTI(AuthorizationRequest))
+	require.Equal(t, FinancialResponse, ResponseMTI(FinancialRequest))
+	require.Equal(t, CompletionResponse, ResponseMTI(CompletionAdvice))
+	require.Equal(t, ReversalResponse, ResponseMTI(ReversalRepeat))
+}
+
+func TestFraming(t *testing.T) {
+	var conn bytes.Buffer
+	require.NoError(t, WriteMessage(&conn, NewMessage(ReversalRequest).Set(FieldOperationID, "op")))
+	require.NoError(t, WriteMessage(&conn, NewMessage(NetworkRequest).Set(FieldNetworkCode, EchoNetworkCode)))
+
+	first, err := ReadMessage(&conn)
+	require.NoError(t, err)
+	require.Equal(t, "op", first.Get(FieldOperationID))
+
+	second, err := ReadMessage(&conn)
+	require.NoError(t, err)
+	require.Equal(t, NetworkRequest, second.MTI)
+}
@@ -0,0 +1,70 @@
+package money
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Currency holds the ISO 4217 rules that an amount has to follow
+type Currency struct {
+	Code string `json:"code"`
+	// Numeric is the ISO 4217 numeric code, it's what the ISO 8583 messages carry
+	Numeric string `json:"numeric"`
+	// MinorUnits is the number of decimal places the currency allows, it can't be bigger than Scale
+	MinorUnits int    `json:"minor_units"`
+	Min        Amount `json:"min"`
+	Max        Amount `json:"max"`
+}
+
+// These are the currencies of the countries where we operate
+var currencies = map[string]Currency{
+	"USD": {Code: "USD", Numeric: "840", MinorUnits: 2, Min: MustParse("0.50"), Max: MustParse("999999.99")},
+	"MXN": {Code: "MXN", Numeric: "484", MinorUnits: 2, Min: MustParse("10"), Max: MustParse("20000000")},
+	"COP": {Code: "COP", Numeric: "170", MinorUnits: 2, Min: MustParse("2000"), Max: MustParse("4000000000")},
+	"ARS": {Code: "ARS", Numeric: "032", MinorUnits: 2, Min: MustParse("100"), Max: MustParse("1000000000")},
+	"BRL": {Code: "BRL", Numeric: "986", MinorUnits: 2, Min: MustParse("2.50"), Max: MustParse("5000000")},
+	"CLP": {Code: "CLP", Numeric: "152", MinorUnits: 0, Min: MustParse("500"), Max: MustParse("900000000")},
+	"PEN": {Code: "PEN", Numeric: "604", MinorUnits: 2, Min: MustParse("2"), Max: MustParse("3500000")},
+	"UYU": {Code: "UYU", Numeric: "858", MinorUnits: 2, Min: MustParse("20"), Max: MustParse("40000000")},
+}
+
+// LookupCurrency returns the rules of a supported currency, the code is case-insensitive
+func LookupCurrency(code string) (Currency, bool) {
+	c, ok := currencies[strings.ToUpper(code)]
+	return c, ok
+}
+
+// LookupNumericCurrency returns the rules of a supported currency by its numeric code
+func LookupNumericCurrency(numeric string) (Currency, bool) {
+	for _, c := range currencies {
+		if c.Numeric == numeric {
+			return c, true
+		}
+	}
+	return Currency{}, false
+}
+
+// ValidatePrecision checks that the amount doesn't have more decimal places than the currency allows
+func (c Currency) ValidatePrecision(a Amount) error {
+	step := int64(1)
+	for i := c.MinorUnits; i < Scale; i++ {
+		step *= 10
+	}
+
+	if a.MinorUnits()%step != 0 {
+		return fmt.Errorf("%s amounts can't have more than %d decimal places", c.Code, c.MinorUnits)
+	}
+	return nil
+}
+
+// Validate checks the precision and the allowed range of a payment amount
+func (c Currency) Validate(a Amount) error {
+	if err := c.ValidatePrecision(a); err != nil {
+		return err
+	}
+
+	if a < c.Min || a > c.Max {
+		return fmt.Errorf("%s amounts must be between %s and %s", c.Code, c.Min, c.Max)
+	}
+	return nil
+}
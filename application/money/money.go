@@ -0,0 +1,153 @@
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+/*
+Amount is an exact monetary amount. Floats can't represent most decimal amounts (0.1 + 0.2 != 0.3), which ends up in
+reconciliation differences, so the amount is stored as an integer number of hundredths, the same scale as the numeric(12,2)
+columns. It's encoded as a JSON number, a plain decimal string for the database and it's never rounded: an amount with more
+decimal places than the supported scale is rejected
+*/
+
+type Amount int64
+
+const (
+	// Scale is the number of decimal places an Amount keeps
+	Scale = 2
+	// Max is the biggest amount that fits into a numeric(12,2) column
+	Max Amount = 999999999999
+)
+
+var ErrInvalidAmount = errors.New("invalid amount")
+var ErrTooManyDecimals = fmt.Errorf("amount can't have more than %d decimal places", Scale)
+
+const unit = 100
+
+// Parse converts a decimal string such as "12.5" or "-3.07" into an Amount
+func Parse(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	negative := false
+	if strings.HasPrefix(s, "-") {
+		negative = true
+		s = s[1:]
+	}
+
+	integer, fraction, _ := strings.Cut(s, ".")
+	if integer == "" || !isDigits(integer) || !isDigits(fraction) {
+		return 0, ErrInvalidAmount
+	}
+
+	// Trailing zeros don't add precision
+	fraction = strings.TrimRight(fraction, "0")
+	if len(fraction) > Scale {
+		return 0, ErrTooManyDecimals
+	}
+	fraction += strings.Repeat("0", Scale-len(fraction))
+
+	cents, _ := strconv.ParseInt(fraction, 10, 64)
+	units, err := strconv.ParseInt(integer, 10, 64)
+	if err != nil || units > (math.MaxInt64-cents)/unit {
+		return 0, ErrInvalidAmount
+	}
+
+	amount := Amount(units*unit + cents)
+	if negative {
+		amount = -amount
+	}
+	return amount, nil
+}
+
+// MustParse is like Parse but panics if the amount is invalid. It's meant for constants and tests
+func MustParse(s string) Amount {
+	a, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// FromMinorUnits creates an Amount from hundredths, e.g. cents
+func FromMinorUnits(minor int64) Amount {
+	return Amount(minor)
+}
+
+// MinorUnits returns the amount in hundredths, e.g. cents
+func (a Amount) MinorUnits() int64 {
+	return int64(a)
+}
+
+func (a Amount) String() string {
+	sign := ""
+	v := int64(a)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, v/unit, v%unit)
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON accepts both a JSON number and a string, in both cases the decimal text is parsed without going
+// through a float
+func (a *Amount) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	if s == "null" {
+		return nil
+	}
+
+	amount, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = amount
+	return nil
+}
+
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
+
+func (a *Amount) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*a = 0
+		return nil
+	case []byte:
+		return a.scanString(string(v))
+	case string:
+		return a.scanString(v)
+	case int64:
+		*a = Amount(v * unit)
+		return nil
+	default:
+		return fmt.Errorf("can't scan %T into an amount", src)
+	}
+}
+
+func (a *Amount) scanString(s string) error {
+	amount, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = amount
+	return nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
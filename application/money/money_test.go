@@ -0,0 +1,87 @@
+package money
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Amount
+		wantErr error
+	}{
+		{name: "integer", input: "100", want: 10000},
+		{name: "one decimal", input: "12.5", want: 1250},
+		{name: "two decimals", input: "0.07", want: 7},
+		{name: "trailing zeros", input: "10.500", want: 1050},
+		{name: "negative", input: "-3.07", want: -307},
+		{name: "too many decimals", input: "10.001", wantErr: ErrTooManyDecimals},
+		{name: "exponent", input: "1e2", wantErr: ErrInvalidAmount},
+		{name: "empty", input: "", wantErr: ErrInvalidAmount},
+		{name: "no integer part", input: ".5", wantErr: ErrInvalidAmount},
+		{name: "biggest amount", input: "92233720368547758.07", want: math.MaxInt64},
+		{name: "overflow", input: "92233720368547758.08", wantErr: ErrInvalidAmount},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			require.Equal(t, tt.wantErr, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var body struct {
+		Amount Amount `json:"amount"`
+	}
+
+	require.NoError(t, json.Unmarshal([]byte(`{"amount": 0.1}`), &body))
+	require.Equal(t, Amount(10), body.Amount)
+	require.Equal(t, Amount(30), body.Amount+MustParse("0.2"))
+
+	require.Error(t, json.Unmarshal([]byte(`{"amount": 19.999}`), &body))
+
+	b, err := json.Marshal(body)
+	require.NoError(t, err)
+	require.Equal(t, `{"amount":0.10}`, string(b))
+}
+
+func TestScan(t *testing.T) {
+	var a Amount
+	require.NoError(t, a.Scan([]byte("1234.56")))
+	require.Equal(t, Amount(123456), a)
+
+	v, err := a.Value()
+	require.NoError(t, err)
+	require.Equal(t, "1234.56", v)
+}
+
+func TestCurrencyValidate(t *testing.T) {
+	usd, ok := LookupCurrency("usd")
+	require.True(t, ok)
+	require.NoError(t, usd.Validate(MustParse("10.25")))
+	require.Error(t, usd.Validate(MustParse("0.10")))
+
+	clp, ok := LookupCurrency("CLP")
+	require.True(t, ok)
+	require.NoError(t, clp.Validate(MustParse("1500")))
+	require.Error(t, clp.Validate(MustParse("1500.50")))
+
+	_, ok = LookupCurrency("XXX")
+	require.False(t, ok)
+}
+
+func TestLookupNumericCurrency(t *testing.T) {
+	usd, ok := LookupNumericCurrency("840")
+	require.True(t, ok)
+	require.Equal(t, "USD", usd.Code)
+
+	_, ok = LookupNumericCurrency("999")
+	require.False(t, ok)
+}
@@ -0,0 +1,114 @@
+package bank
+
+import (
+	"github.com/spf13/viper"
+	"sync"
+	"time"
+)
+
+/*
+States of a circuit breaker
+closed - The calls go through to the bank
+open - The bank failed too many times in a row, the calls fail fast until OPEN_TIMEOUT passes
+half-open - The open timeout passed, a single call goes through to check if the bank is back
+*/
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// BreakerState is what's exposed for monitoring
+type BreakerState struct {
+	BankID              uint64     `json:"bank_id"`
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+}
+
+// breaker is a circuit breaker for a bank, so a bank that is down doesn't keep every payment waiting for its timeouts
+type breaker struct {
+	mu       sync.Mutex
+	bankID   uint64
+	state    string
+	failures int
+	openedAt time.Time
+	// trial is true while the half-open call is running
+	trial bool
+}
+
+func newBreaker(bankID uint64) *breaker {
+	return &breaker{bankID: bankID, state: BreakerClosed}
+}
+
+// allow tells if a call can go through to the bank
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < breakerOpenTimeout() {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.trial = true
+		return true
+	case BreakerHalfOpen:
+		// Only the trial call goes through
+		if b.trial {
+			return false
+		}
+		b.trial = true
+		return true
+	}
+	return true
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = BreakerClosed
+	b.failures = 0
+	b.trial = false
+}
+
+// failure returns true if the breaker was opened by it
+func (b *breaker) failure() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.trial = false
+
+	if b.state == BreakerHalfOpen || (b.state == BreakerClosed && b.failures >= breakerFailureThreshold()) {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+		return true
+	}
+	return false
+}
+
+func (b *breaker) snapshot() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	state := BreakerState{BankID: b.bankID, State: b.state, ConsecutiveFailures: b.failures}
+	if b.state != BreakerClosed {
+		openedAt := b.openedAt
+		state.OpenedAt = &openedAt
+	}
+	return state
+}
+
+func breakerFailureThreshold() int {
+	if threshold := viper.GetInt("BANK_BREAKER_FAILURE_THRESHOLD"); threshold > 0 {
+		return threshold
+	}
+	return 5
+}
+
+func breakerOpenTimeout() time.Duration {
+	if timeout := viper.GetDuration("BANK_BREAKER_OPEN_TIMEOUT"); timeout > 0 {
+		return timeout
+	}
+	return 30 * time.Second
+}
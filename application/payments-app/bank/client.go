@@ -0,0 +1,188 @@
+package bank
+
+import (
+	"context"
+	"errors"
+	"github.com/go-resty/resty/v2"
+	"github.com/negarciacamilo/deuna_challenge/application/apierrors"
+	"github.com/negarciacamilo/deuna_challenge/application/defines"
+	d "github.com/negarciacamilo/deuna_challenge/application/domain"
+	"github.com/negarciacamilo/deuna_challenge/application/logger"
+	"github.com/spf13/viper"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// Operations, each one has its own timeout
+const (
+	payOperation       = "pay"
+	authorizeOperation = "authorize"
+	refundOperation    = "refund"
+	reversalOperation  = "reversal"
+	captureOperation   = "capture"
+	voidOperation      = "void"
+	getOperation       = "operation"
+)
+
+// errBankUnavailable is returned without calling the bank while its circuit breaker is open
+var errBankUnavailable = errors.New(defines.BANK_UNAVAILABLE)
+
+// errStillProcessing is returned when the retries run out while the bank is still processing an earlier attempt, which
+// it may still perform
+var errStillProcessing = errors.New("the bank is still processing the operation")
+
+// call sends a request to the bank, retrying the retryable failures with exponential backoff and jitter. Every call
+// carries an idempotency key or is a read, so retrying can't charge the customer twice
+func (r *httpConnector) call(ctx *d.ContextInformation, operation, idempotencyKey, method, url string, body any) (*resty.Response, error) {
+	b := r.breaker
+	maxAttempts := retryMaxAttempts()
+
+	for attempt := 1; ; attempt++ {
+		if !b.allow() {
+			return nil, errBankUnavailable
+		}
+
+		res, err := r.send(ctx, operation, idempotencyKey, method, url, body)
+		if err != nil || res.StatusCode() >= http.StatusInternalServerError {
+			if b.failure() {
+				logger.Error("bank circuit breaker opened", "bank-circuit-breaker", errBankUnavailable, ctx, map[string]any{"bank_id": r.bankID})
+			}
+		} else {
+			b.success()
+		}
+
+		if !isRetryable(res, err) {
+			return res, err
+		}
+
+		if attempt >= maxAttempts {
+			return res, stillProcessing(res, err)
+		}
+
+		wait := retryBackoff(attempt)
+		logger.Info("retrying bank call", "bank-retry", ctx, map[string]any{"bank_id": r.bankID, "operation": operation, "attempt": attempt, "wait": wait.String()})
+		select {
+		case <-ctx.GetCtx().Done():
+			return res, stillProcessing(res, err)
+		case <-time.After(wait):
+		}
+	}
+}
+
+// send makes a single attempt, bounded by the timeout of the operation
+func (r *httpConnector) send(ctx *d.ContextInformation, operation, idempotencyKey, method, url string, body any) (*resty.Response, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx.GetCtx(), timeout(r.config, operation))
+	defer cancel()
+
+	req := r.request(ctx, idempotencyKey).SetContext(timeoutCtx)
+	if body != nil {
+		req.SetBody(body)
+	}
+	return req.Execute(method, url)
+}
+
+// request sets the headers every bank call carries. The request id lets the calls be followed in the bank logs and the
+// idempotency key, when there's one, lets the bank tell a retry from a new operation so the customer isn't charged twice.
+// The faults of the request are forwarded to the bank simulator
+func (r *httpConnector) request(ctx *d.ContextInformation, idempotencyKey string) *resty.Request {
+	req := r.httpClient.R().EnableTrace()
+	if r.config.APIKey != "" {
+		req.SetHeader(defines.Authorization, r.config.APIKey)
+	}
+	if ctx != nil && ctx.RequestInfo != nil && ctx.RequestInfo.RequestID != "" {
+		req.SetHeader(defines.XRequestID, ctx.RequestInfo.RequestID)
+	}
+	if ctx != nil && ctx.RequestInfo != nil && ctx.RequestInfo.BankFaults != "" {
+		req.SetHeader(defines.BankFaults, ctx.RequestInfo.BankFaults)
+	}
+	if idempotencyKey != "" {
+		req.SetHeader(defines.IdempotencyKey, idempotencyKey)
+	}
+	return req
+}
+
+// isRetryable tells if the bank might answer differently if asked again, which the bank says in its errors. Declines
+// aren't retried, they won't change
+func isRetryable(res *resty.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	if !res.IsError() {
+		return false
+	}
+	return decodeBankError(res).Retryable
+}
+
+// stillProcessing turns the last answer of a call into an error when the bank answered that an earlier attempt is
+// still running, so the call is taken as unanswered instead of as the bank refusing it
+func stillProcessing(res *resty.Response, err error) error {
+	if err == nil && res.StatusCode() == http.StatusConflict {
+		return errStillProcessing
+	}
+	return err
+}
+
+// retryBackoff doubles the wait on every attempt up to BANK_RETRY_BACKOFF_MAX, with full jitter so the retries of many
+// payments don't hit a recovering bank at the same time
+func retryBackoff(attempt int) time.Duration {
+	base := viper.GetDuration("BANK_RETRY_BACKOFF_BASE")
+	if base <= 0 {
+		base = 100 * time.Millisecond
+	}
+
+	maxBackoff := viper.GetDuration("BANK_RETRY_BACKOFF_MAX")
+	if maxBackoff <= 0 {
+		maxBackoff = 2 * time.Second
+	}
+
+	backoff := maxBackoff
+	if attempt < 32 && base<<(attempt-1) < maxBackoff {
+		backoff = base << (attempt - 1)
+	}
+	return time.Duration(rand.Int63n(int64(backoff)) + 1)
+}
+
+func retryMaxAttempts() int {
+	if attempts := viper.GetInt("BANK_RETRY_MAX_ATTEMPTS"); attempts > 0 {
+		return attempts
+	}
+	return 3
+}
+
+// timeout returns the timeout of an operation. The timeouts of the bank config come first, then BANK_TIMEOUTS and
+// BANK_TIMEOUT
+func timeout(config d.BankConfig, operation string) time.Duration {
+	if timeout := config.Timeouts[operation]; timeout > 0 {
+		return timeout
+	}
+
+	if config.Timeout > 0 {
+		return config.Timeout
+	}
+
+	if timeout, err := time.ParseDuration(viper.GetStringMapString("BANK_TIMEOUTS")[operation]); err == nil && timeout > 0 {
+		return timeout
+	}
+
+	if timeout := viper.GetDuration("BANK_TIMEOUT"); timeout > 0 {
+		return timeout
+	}
+	return 5 * time.Second
+}
+
+// Unanswered tells if the bank may have performed an operation whose answer never came: the call failed or timed out,
+// the bank was still processing it when the retries ran out, or the bank answered a server error. A call the breaker didn't let through never reached the bank, and the bank says
+// the operation wasn't performed when it's unavailable
+func Unanswered(apierr apierrors.ApiError) bool {
+	return apierr.Status() >= http.StatusInternalServerError && apierr.Code() != defines.BANK_UNAVAILABLE_DECLINE
+}
+
+// callApiError is the error of a call the bank never answered
+func callApiError(message string, err error) apierrors.ApiError {
+	if errors.Is(err, errBankUnavailable) {
+		return apierrors.NewApiError(defines.BANK_UNAVAILABLE, defines.BANK_UNAVAILABLE_DECLINE, http.StatusServiceUnavailable, nil)
+	}
+	return apierrors.NewInternalServerApiError(message, err)
+}
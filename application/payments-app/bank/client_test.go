@@ -0,0 +1,210 @@
+package bank
+
+import (
+	"encoding/json"
+	"github.com/go-resty/resty/v2"
+	"github.com/negarciacamilo/deuna_challenge/application/apierrors"
+	"github.com/negarciacamilo/deuna_challenge/application/defines"
+	d "github.com/negarciacamilo/deuna_challenge/application/domain"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/domain"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func setupBank(t *testing.T, bankID uint64, handler func(calls int32, w http.ResponseWriter, r *http.Request)) (BankConnector, *int32) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler(atomic.AddInt32(&calls, 1), w, r)
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(viper.Reset)
+
+	viper.Set("BANK_RETRY_MAX_ATTEMPTS", 3)
+	viper.Set("BANK_RETRY_BACKOFF_BASE", "1ms")
+	viper.Set("BANK_RETRY_BACKOFF_MAX", "5ms")
+	viper.Set("BANK_BREAKER_FAILURE_THRESHOLD", 3)
+	viper.Set("BANK_BREAKER_OPEN_TIMEOUT", "50ms")
+	return NewHTTPConnector(bankID, d.BankConfig{URL: server.URL, APIKey: "key"}, resty.New()), &calls
+}
+
+func TestRetries(t *testing.T) {
+	ctx := d.BackgroundContext()
+	payment := domain.PaymentRequest{BankID: 1, Reference: "ref"}
+
+	t.Run("Retryable failures are retried with the same idempotency key", func(t *testing.T) {
+		repo, calls := setupBank(t, 1, func(calls int32, w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, "ref", r.Header.Get(defines.IdempotencyKey))
+			require.Equal(t, "key", r.Header.Get(defines.Authorization))
+			if calls < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(`{"operation_id":"op"}`)) // nolint
+		})
+
+		operationID, apierr := repo.Pay(ctx, payment)
+		require.Nil(t, apierr)
+		require.Equal(t, "op", *operationID)
+		require.EqualValues(t, 3, *calls)
+	})
+
+	t.Run("Timeouts are retried", func(t *testing.T) {
+		repo, calls := setupBank(t, 1, func(calls int32, w http.ResponseWriter, r *http.Request) {
+			if calls == 1 {
+				time.Sleep(100 * time.Millisecond)
+			}
+		})
+		viper.Set("BANK_TIMEOUTS", map[string]string{reversalOperation: "20ms"})
+
+		apierr := repo.ReverseOperation(ctx, "op")
+		require.Nil(t, apierr)
+		require.EqualValues(t, 2, *calls)
+	})
+
+	t.Run("A payment the bank is still processing when the retries run out is unanswered", func(t *testing.T) {
+		repo, calls := setupBank(t, 1, func(calls int32, w http.ResponseWriter, r *http.Request) {
+			if calls == 1 {
+				time.Sleep(100 * time.Millisecond)
+				return
+			}
+			bankErr := d.ToBankError(apierrors.NewApiError("a request with the same idempotency key is still being processed, retry later", "idempotency_key_in_use", http.StatusConflict, nil))
+			w.WriteHeader(bankErr.Status())
+			require.NoError(t, json.NewEncoder(w).Encode(bankErr))
+		})
+		viper.Set("BANK_TIMEOUTS", map[string]string{payOperation: "20ms"})
+
+		_, apierr := repo.Pay(ctx, payment)
+		require.NotNil(t, apierr)
+		require.True(t, Unanswered(apierr))
+		require.EqualValues(t, 3, *calls)
+	})
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	ctx := d.BackgroundContext()
+	var failing atomic.Bool
+	failing.Store(true)
+
+	failingBank, calls := setupBank(t, 1, func(calls int32, w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			time.Sleep(50 * time.Millisecond)
+		}
+	})
+	otherBank, _ := setupBank(t, 2, func(calls int32, w http.ResponseWriter, r *http.Request) {})
+	registry := NewStaticRegistry(map[uint64]BankConnector{1: failingBank, 2: otherBank})
+	viper.Set("BANK_TIMEOUT", "10ms")
+
+	// The first call fails 3 times in a row, which opens the breaker of the bank
+	apierr := failingBank.Void(ctx, "op")
+	require.NotNil(t, apierr)
+	breakers := registry.GetBreakers()
+	require.Equal(t, BreakerState{BankID: 1, State: BreakerOpen, ConsecutiveFailures: 3, OpenedAt: breakers[0].OpenedAt}, breakers[0])
+	require.NotNil(t, breakers[0].OpenedAt)
+
+	// It fails fast, without calling the bank
+	apierr = failingBank.Void(ctx, "op")
+	require.Equal(t, defines.BANK_UNAVAILABLE, apierr.Message())
+	require.Equal(t, "9012", failingBank.ParseAPIError(apierr))
+	require.False(t, Unanswered(apierr))
+	require.EqualValues(t, 3, *calls)
+
+	// The other banks have their own
+	require.Nil(t, otherBank.Void(ctx, "op"))
+	require.Equal(t, BreakerClosed, registry.GetBreakers()[1].State)
+
+	// Once the open timeout passes a trial call goes through and closes it
+	failing.Store(false)
+	time.Sleep(60 * time.Millisecond)
+	require.Equal(t, BreakerOpen, failingBank.GetBreaker().State)
+	require.Nil(t, failingBank.Void(ctx, "op"))
+	require.Equal(t, BreakerClosed, failingBank.GetBreaker().State)
+}
+
+func TestBankErrors(t *testing.T) {
+	ctx := d.BackgroundContext()
+	payment := domain.PaymentRequest{BankID: 1, Reference: "ref"}
+	respond := func(w http.ResponseWriter, bankErr *d.BankError) {
+		w.WriteHeader(bankErr.Status())
+		require.NoError(t, json.NewEncoder(w).Encode(bankErr))
+	}
+
+	t.Run("Declines are decoded and aren't retried", func(t *testing.T) {
+		repo, calls := setupBank(t, 1, func(calls int32, w http.ResponseWriter, r *http.Request) {
+			respond(w, d.NewBankError(http.StatusBadRequest, defines.INSUFFICIENT_FUNDS_DECLINE, defines.CLIENT_INVALID_BALANCE, false))
+		})
+
+		_, apierr := repo.Pay(ctx, payment)
+		require.Equal(t, defines.INSUFFICIENT_FUNDS_DECLINE, apierr.Code())
+		require.Equal(t, http.StatusBadRequest, apierr.Status())
+		require.Equal(t, "1016", repo.ParseAPIError(apierr))
+		require.False(t, Unanswered(apierr))
+		require.NotEmpty(t, apierr.Cause()[0].(*d.BankError).BankReference)
+		require.EqualValues(t, 1, *calls)
+	})
+
+	t.Run("Retryable errors are retried", func(t *testing.T) {
+		repo, calls := setupBank(t, 1, func(calls int32, w http.ResponseWriter, r *http.Request) {
+			respond(w, d.NewBankError(http.StatusInternalServerError, defines.TRANSACTION_FAILED_DECLINE, defines.BANK_TX_FAILED, true))
+		})
+
+		_, apierr := repo.Pay(ctx, payment)
+		require.Equal(t, defines.TRANSACTION_FAILED_DECLINE, apierr.Code())
+		require.Equal(t, "9999", repo.ParseAPIError(apierr))
+		require.True(t, Unanswered(apierr))
+		require.EqualValues(t, 3, *calls)
+	})
+
+	t.Run("Bodies of another version are unknown errors", func(t *testing.T) {
+		repo, calls := setupBank(t, 1, func(calls int32, w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"version": 2, "decline_code": "insufficient_funds"}`))
+		})
+
+		_, apierr := repo.Pay(ctx, payment)
+		require.Equal(t, defines.UNKNOWN_DECLINE, apierr.Code())
+		require.Equal(t, "9999", repo.ParseAPIError(apierr))
+		require.EqualValues(t, 1, *calls)
+	})
+
+	t.Run("Bodies that aren't bank errors are retried by their status", func(t *testing.T) {
+		repo, calls := setupBank(t, 1, func(calls int32, w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = w.Write([]byte("bad gateway"))
+		})
+
+		apierr := repo.RefundPayment(ctx, "op", 100)
+		require.Equal(t, defines.UNKNOWN_DECLINE, apierr.Code())
+		require.Equal(t, http.StatusBadGateway, apierr.Status())
+		require.EqualValues(t, 3, *calls)
+	})
+
+	t.Run("Reversals of operations the bank doesn't have or already reversed are done", func(t *testing.T) {
+		repo, calls := setupBank(t, 1, func(calls int32, w http.ResponseWriter, r *http.Request) {
+			if calls == 1 {
+				respond(w, d.NewBankError(http.StatusNotFound, defines.OPERATION_NOT_FOUND_DECLINE, defines.OPERATION_NOT_FOUND, false))
+				return
+			}
+			respond(w, d.NewBankError(http.StatusConflict, defines.OPERATION_REVERSED_DECLINE, defines.ALREADY_REVERSED, false))
+		})
+
+		require.Nil(t, repo.ReverseOperation(ctx, "op"))
+		require.Nil(t, repo.ReverseOperation(ctx, "op"))
+		require.EqualValues(t, 2, *calls)
+
+		apierr := repo.Void(ctx, "op")
+		require.Equal(t, defines.OPERATION_REVERSED_DECLINE, apierr.Code())
+	})
+}
+
+func TestParseAPIError(t *testing.T) {
+	connector := NewHTTPConnector(1, d.BankConfig{ErrorCodes: map[string]string{defines.INVALID_CARD_DECLINE: "1014"}}, resty.New())
+	require.Equal(t, "1014", connector.ParseAPIError(d.NewBankError(http.StatusBadRequest, defines.INVALID_CARD_DECLINE, defines.INVALID_CARD_HASH, false)))
+	require.Equal(t, "1016", connector.ParseAPIError(d.NewBankError(http.StatusBadRequest, defines.INSUFFICIENT_FUNDS_DECLINE, defines.CLIENT_INVALID_BALANCE, false)))
+	require.Equal(t, "9012", connector.ParseAPIError(callApiError("something happened paying", errBankUnavailable)))
+	require.Equal(t, "9999", connector.ParseAPIError(apierrors.NewBadRequestApiError("something else")))
+}
@@ -0,0 +1,258 @@
+package bank
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-resty/resty/v2"
+	"github.com/google/uuid"
+	"github.com/negarciacamilo/deuna_challenge/application/apierrors"
+	"github.com/negarciacamilo/deuna_challenge/application/defines"
+	d "github.com/negarciacamilo/deuna_challenge/application/domain"
+	"github.com/negarciacamilo/deuna_challenge/application/iso8583"
+	"github.com/negarciacamilo/deuna_challenge/application/logger"
+	"github.com/negarciacamilo/deuna_challenge/application/money"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/domain"
+	"net/http"
+	"strings"
+)
+
+// BankConnector talks to a bank, every bank has its own one with its URL, credentials, timeouts, error codes and
+// circuit breaker
+type BankConnector interface {
+	Pay(ctx *d.ContextInformation, payment domain.PaymentRequest) (*string, apierrors.ApiError)
+	ReverseOperation(ctx *d.ContextInformation, operationID string) apierrors.ApiError
+	ParseAPIError(apierr apierrors.ApiError) string
+	RefundPayment(ctx *d.ContextInformation, operationID string, amount money.Amount) apierrors.ApiError
+	Authorize(ctx *d.ContextInformation, payment domain.PaymentRequest) (*string, apierrors.ApiError)
+	Capture(ctx *d.ContextInformation, operationID string, amount money.Amount) apierrors.ApiError
+	Void(ctx *d.ContextInformation, operationID string) apierrors.ApiError
+	GetOperation(ctx *d.ContextInformation, reference string) (*d.BankOperation, apierrors.ApiError)
+	GetBreaker() BreakerState
+}
+
+// httpConnector calls the bank JSON API
+type httpConnector struct {
+	bankID     uint64
+	config     d.BankConfig
+	httpClient *resty.Client
+	breaker    *breaker
+}
+
+func NewHTTPConnector(bankID uint64, config d.BankConfig, httpClient *resty.Client) BankConnector {
+	return &httpConnector{
+		bankID:     bankID,
+		config:     config,
+		httpClient: httpClient,
+		breaker:    newBreaker(bankID),
+	}
+}
+
+// refundIdempotencyKey derives the key of a refund from the one the client sent, so a retried refund isn't refunded
+// twice. Without it every refund is a new one, the payments app can't tell them apart either
+func refundIdempotencyKey(ctx *d.ContextInformation, operationID string) string {
+	if ctx == nil || ctx.RequestInfo == nil || ctx.RequestInfo.IdempotencyKey == nil {
+		return fmt.Sprintf("refund-%s-%s", operationID, uuid.NewString())
+	}
+	return fmt.Sprintf("refund-%s-%s", operationID, *ctx.RequestInfo.IdempotencyKey)
+}
+
+func (r *httpConnector) Pay(ctx *d.ContextInformation, payment domain.PaymentRequest) (*string, apierrors.ApiError) {
+	baseUrl := r.config.URL
+	url := fmt.Sprintf("%s/pay", baseUrl)
+
+	// The reference is unique for every payment, so it's the key of its operation
+	res, err := r.call(ctx, payOperation, payment.Reference, http.MethodPost, url, payment)
+	if err != nil {
+		apierr := callApiError("something happened paying", err)
+		logger.Error(apierr.Message(), "bank-payment-request", apierr, ctx)
+		return nil, apierr
+	}
+
+	if res.IsError() {
+		apierr := bankApiError("can't perform the payment", res)
+		logger.Error(apierr.Message(), "bank-payment-request", apierr, ctx, map[string]any{"body": string(res.Body())})
+		return nil, apierr
+	}
+
+	var bankResponse d.BankResponse
+	_ = json.Unmarshal(res.Body(), &bankResponse)
+	return &bankResponse.OperationID, nil
+}
+
+func (r *httpConnector) ReverseOperation(ctx *d.ContextInformation, operationID string) apierrors.ApiError {
+	baseUrl := r.config.URL
+	url := fmt.Sprintf("%s/payments/%s/reversal", baseUrl, operationID)
+
+	// An operation can only be reversed once, so every attempt is the same request
+	res, err := r.call(ctx, reversalOperation, "reversal-"+operationID, http.MethodPut, url, nil)
+	if err != nil {
+		apierr := callApiError("something happened reversing", err)
+		logger.Error(apierr.Message(), "reverse-operation", apierr, ctx, map[string]any{"operation_id": operationID})
+		return apierr
+	}
+
+	if res.IsError() {
+		apierr := bankApiError("can't perform the reversal", res)
+		if nothingToReverse(apierr) {
+			logger.Info("there's nothing left to reverse", "reverse-operation", ctx, map[string]any{"operation_id": operationID, "decline_code": apierr.Code()})
+			return nil
+		}
+		logger.Error(apierr.Message(), "reverse-operation", apierr, ctx, map[string]any{"body": string(res.Body()), "operation_id": operationID})
+		return apierr
+	}
+
+	return nil
+}
+
+func (r *httpConnector) RefundPayment(ctx *d.ContextInformation, operationID string, amount money.Amount) apierrors.ApiError {
+	baseUrl := r.config.URL
+	url := fmt.Sprintf("%s/payments/%s/refund", baseUrl, operationID)
+
+	res, err := r.call(ctx, refundOperation, refundIdempotencyKey(ctx, operationID), http.MethodPut, url, d.BankRefundRequest{Amount: amount})
+	if err != nil {
+		apierr := callApiError("something happened refunding", err)
+		logger.Error(apierr.Message(), "refund-operation", apierr, ctx, map[string]any{"operation_id": operationID})
+		return apierr
+	}
+
+	if res.IsError() {
+		apierr := bankApiError("can't perform the refund", res)
+		logger.Error(apierr.Message(), "refund-operation", apierr, ctx, map[string]any{"body": string(res.Body()), "operation_id": operationID})
+		return apierr
+	}
+
+	return nil
+}
+
+func (r *httpConnector) Authorize(ctx *d.ContextInformation, payment domain.PaymentRequest) (*string, apierrors.ApiError) {
+	baseUrl := r.config.URL
+	url := fmt.Sprintf("%s/authorize", baseUrl)
+
+	res, err := r.call(ctx, authorizeOperation, payment.Reference, http.MethodPost, url, payment)
+	if err != nil {
+		apierr := callApiError("something happened authorizing", err)
+		logger.Error(apierr.Message(), "bank-authorize-request", apierr, ctx)
+		return nil, apierr
+	}
+
+	if res.IsError() {
+		apierr := bankApiError("can't perform the authorization", res)
+		logger.Error(apierr.Message(), "bank-authorize-request", apierr, ctx, map[string]any{"body": string(res.Body())})
+		return nil, apierr
+	}
+
+	var bankResponse d.BankResponse
+	_ = json.Unmarshal(res.Body(), &bankResponse)
+	return &bankResponse.OperationID, nil
+}
+
+func (r *httpConnector) Capture(ctx *d.ContextInformation, operationID string, amount money.Amount) apierrors.ApiError {
+	baseUrl := r.config.URL
+	url := fmt.Sprintf("%s/payments/%s/capture", baseUrl, operationID)
+
+	// An authorization can only be captured once
+	res, err := r.call(ctx, captureOperation, "capture-"+operationID, http.MethodPut, url, d.BankCaptureRequest{Amount: amount})
+	if err != nil {
+		apierr := callApiError("something happened capturing", err)
+		logger.Error(apierr.Message(), "capture-operation", apierr, ctx, map[string]any{"operation_id": operationID})
+		return apierr
+	}
+
+	if res.IsError() {
+		apierr := bankApiError("can't perform the capture", res)
+		logger.Error(apierr.Message(), "capture-operation", apierr, ctx, map[string]any{"body": string(res.Body()), "operation_id": operationID})
+		return apierr
+	}
+
+	return nil
+}
+
+func (r *httpConnector) Void(ctx *d.ContextInformation, operationID string) apierrors.ApiError {
+	baseUrl := r.config.URL
+	url := fmt.Sprintf("%s/payments/%s/void", baseUrl, operationID)
+
+	res, err := r.call(ctx, voidOperation, "void-"+operationID, http.MethodPut, url, nil)
+	if err != nil {
+		apierr := callApiError("something happened voiding", err)
+		logger.Error(apierr.Message(), "void-operation", apierr, ctx, map[string]any{"operation_id": operationID})
+		return apierr
+	}
+
+	if res.IsError() {
+		apierr := bankApiError("can't perform the void", res)
+		logger.Error(apierr.Message(), "void-operation", apierr, ctx, map[string]any{"body": string(res.Body()), "operation_id": operationID})
+		return apierr
+	}
+
+	return nil
+}
+
+// GetOperation asks the bank for the operation of a payment reference, it returns a not found error if the bank never
+// processed it
+func (r *httpConnector) GetOperation(ctx *d.ContextInformation, reference string) (*d.BankOperation, apierrors.ApiError) {
+	baseUrl := r.config.URL
+	url := fmt.Sprintf("%s/operations/%s", baseUrl, reference)
+
+	res, err := r.call(ctx, getOperation, "", http.MethodGet, url, nil)
+	if err != nil {
+		apierr := callApiError("something happened fetching the operation", err)
+		logger.Error(apierr.Message(), "get-operation", apierr, ctx, map[string]any{"reference": reference})
+		return nil, apierr
+	}
+
+	if res.IsError() {
+		apierr := bankApiError("can't fetch the operation", res)
+		logger.Error(apierr.Message(), "get-operation", apierr, ctx, map[string]any{"body": string(res.Body()), "reference": reference})
+		return nil, apierr
+	}
+
+	var operation d.BankOperation
+	_ = json.Unmarshal(res.Body(), &operation)
+	return &operation, nil
+}
+
+// nothingToReverse tells if the bank refused a reversal because it's already done: the operation was reversed, or the
+// bank never got it, in which case the bank remembers the reversal and reverses the operation if it comes late
+func nothingToReverse(apierr apierrors.ApiError) bool {
+	return apierr.Code() == defines.OPERATION_NOT_FOUND_DECLINE || apierr.Code() == defines.OPERATION_REVERSED_DECLINE
+}
+
+// bankApiError is the error of a call the bank answered with an error. Its code is the decline code and its cause the
+// error of the bank
+func bankApiError(message string, res *resty.Response) apierrors.ApiError {
+	bankErr := decodeBankError(res)
+	return apierrors.NewApiError(message, bankErr.DeclineCode, res.StatusCode(), apierrors.CauseList{bankErr})
+}
+
+// decodeBankError reads the error body of the bank. A body of another version of the protocol, or one that isn't an
+// error of the bank at all like the ones of a proxy, is an unknown error
+func decodeBankError(res *resty.Response) *d.BankError {
+	var bankErr d.BankError
+	if err := json.Unmarshal(res.Body(), &bankErr); err != nil || bankErr.Version != d.BankErrorVersion {
+		return &d.BankError{
+			Version:      d.BankErrorVersion,
+			ErrorStatus:  res.StatusCode(),
+			DeclineCode:  defines.UNKNOWN_DECLINE,
+			ErrorMessage: http.StatusText(res.StatusCode()),
+			Retryable:    d.IsRetryableStatus(res.StatusCode()),
+		}
+	}
+	return &bankErr
+}
+
+// ParseAPIError maps an error of the bank to its ISO 8583 code, the codes of the bank config come first
+func (r *httpConnector) ParseAPIError(apierr apierrors.ApiError) string {
+	if code, ok := r.config.ErrorCodes[strings.ToLower(apierr.Code())]; ok {
+		return code
+	}
+	return ParseAPIError(apierr)
+}
+
+// ParseAPIError maps the decline code of an error of the bank through the shared code table
+func ParseAPIError(apierr apierrors.ApiError) string {
+	return iso8583.ForDecline(apierr.Code())
+}
+
+func (r *httpConnector) GetBreaker() BreakerState {
+	return r.breaker.snapshot()
+}
@@ -0,0 +1,106 @@
+package bank
+
+import (
+	"github.com/negarciacamilo/deuna_challenge/application/apierrors"
+	d "github.com/negarciacamilo/deuna_challenge/application/domain"
+	"github.com/negarciacamilo/deuna_challenge/application/money"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/domain"
+	"github.com/stretchr/testify/mock"
+)
+
+type ConnectorMock struct {
+	mock.Mock
+}
+
+func (r *ConnectorMock) Pay(ctx *d.ContextInformation, payment domain.PaymentRequest) (*string, apierrors.ApiError) {
+	args := r.Called(ctx, payment)
+	id := args.String(0)
+	err := args.Get(1)
+	if err != nil {
+		if id != "" {
+			return &id, err.(apierrors.ApiError)
+		}
+		return nil, err.(apierrors.ApiError)
+	}
+	return &id, nil
+}
+
+func (r *ConnectorMock) ReverseOperation(ctx *d.ContextInformation, operationID string) apierrors.ApiError {
+	args := r.Called(ctx, operationID)
+	err := args.Get(0)
+	if err != nil {
+		return err.(apierrors.ApiError)
+	}
+	return nil
+}
+
+func (r *ConnectorMock) ParseAPIError(apierr apierrors.ApiError) string {
+	return ParseAPIError(apierr)
+}
+
+func (r *ConnectorMock) RefundPayment(ctx *d.ContextInformation, operationID string, amount money.Amount) apierrors.ApiError {
+	args := r.Called(ctx, operationID, amount)
+	err := args.Get(0)
+	if err != nil {
+		return err.(apierrors.ApiError)
+	}
+	return nil
+}
+
+func (r *ConnectorMock) Authorize(ctx *d.ContextInformation, payment domain.PaymentRequest) (*string, apierrors.ApiError) {
+	args := r.Called(ctx, payment)
+	id := args.String(0)
+	err := args.Get(1)
+	if err != nil {
+		if id != "" {
+			return &id, err.(apierrors.ApiError)
+		}
+		return nil, err.(apierrors.ApiError)
+	}
+	return &id, nil
+}
+
+func (r *ConnectorMock) Capture(ctx *d.ContextInformation, operationID string, amount money.Amount) apierrors.ApiError {
+	args := r.Called(ctx, operationID, amount)
+	err := args.Get(0)
+	if err != nil {
+		return err.(apierrors.ApiError)
+	}
+	return nil
+}
+
+func (r *ConnectorMock) Void(ctx *d.ContextInformation, operationID string) apierrors.ApiError {
+	args := r.Called(ctx, operationID)
+	err := args.Get(0)
+	if err != nil {
+		return err.(apierrors.ApiError)
+	}
+	return nil
+}
+
+func (r *ConnectorMock) GetOperation(ctx *d.ContextInformation, reference string) (*d.BankOperation, apierrors.ApiError) {
+	args := r.Called(ctx, reference)
+	err := args.Get(1)
+	if err != nil {
+		return nil, err.(apierrors.ApiError)
+	}
+	return args.Get(0).(*d.BankOperation), nil
+}
+
+func (r *ConnectorMock) GetBreaker() BreakerState {
+	args := r.Called()
+	return args.Get(0).(BreakerState)
+}
+
+// RegistryMock returns the same connector for every bank
+type RegistryMock struct {
+	Connector BankConnector
+}
+
+func (r *RegistryMock) Get(ctx *d.ContextInformation, bankID uint64) (BankConnector, apierrors.ApiError) {
+	return r.Connector, nil
+}
+
+func (r *RegistryMock) GetBreakers() []BreakerState {
+	return []BreakerState{r.Connector.GetBreaker()}
+}
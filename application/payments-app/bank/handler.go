@@ -0,0 +1,33 @@
+package bank
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/negarciacamilo/deuna_challenge/application/context"
+	"github.com/negarciacamilo/deuna_challenge/application/response"
+	"net/http"
+)
+
+type Handler interface {
+	GetBreakers(c *gin.Context)
+}
+
+type handler struct {
+	registry Registry
+}
+
+func NewHandler(registry Registry) Handler {
+	return &handler{
+		registry: registry,
+	}
+}
+
+// GetBreakers returns the circuit breaker state of every bank
+func (h *handler) GetBreakers(c *gin.Context) {
+	ctx := context.GetContextInformation(c)
+	if apierr := context.RequireOperator(ctx); apierr != nil {
+		response.Respond(ctx, nil, apierr)
+		return
+	}
+
+	response.Respond(ctx, response.New(http.StatusOK, h.registry.GetBreakers()), nil)
+}
@@ -0,0 +1,471 @@
+package bank
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/negarciacamilo/deuna_challenge/application/apierrors"
+	"github.com/negarciacamilo/deuna_challenge/application/defines"
+	d "github.com/negarciacamilo/deuna_challenge/application/domain"
+	"github.com/negarciacamilo/deuna_challenge/application/iso8583"
+	"github.com/negarciacamilo/deuna_challenge/application/logger"
+	"github.com/negarciacamilo/deuna_challenge/application/money"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/domain"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/worker"
+	"github.com/spf13/viper"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const echoOperation = "echo"
+
+// operationNames are used in the messages of the errors
+var operationNames = map[string]string{
+	payOperation:       "payment",
+	authorizeOperation: "authorization",
+	refundOperation:    "refund",
+	reversalOperation:  "reversal",
+	captureOperation:   "capture",
+	voidOperation:      "void",
+}
+
+// errLinkClosed is returned to the calls that were waiting for an answer when the connection broke
+var errLinkClosed = errors.New("the ISO 8583 connection was closed")
+
+// isoConnector talks to the bank with ISO 8583 messages over a persistent TCP connection. Every call shares the
+// connection, the answers are matched to the requests by their STAN and the connection is dialed again when it breaks
+type isoConnector struct {
+	bankID  uint64
+	config  d.BankConfig
+	breaker *breaker
+	stan    atomic.Uint32
+
+	mu   sync.Mutex
+	link *link
+	// done is closed with the connector, it stops the heartbeat
+	done   chan struct{}
+	closed bool
+}
+
+// link is a connection to the bank and the calls waiting for an answer on it
+type link struct {
+	conn    net.Conn
+	writing sync.Mutex
+	mu      sync.Mutex
+	pending map[string]chan *iso8583.Message
+	closed  bool
+}
+
+// isoError keeps the action code the bank answered with
+type isoError struct {
+	apierrors.ApiError
+	actionCode string
+}
+
+func NewISOConnector(bankID uint64, config d.BankConfig) BankConnector {
+	c := &isoConnector{
+		bankID:  bankID,
+		config:  config,
+		breaker: newBreaker(bankID),
+		done:    make(chan struct{}),
+	}
+
+	if interval := viper.GetDuration("ISO_ECHO_INTERVAL"); interval > 0 {
+		go c.heartbeat(interval)
+	}
+	return c
+}
+
+func (c *isoConnector) Pay(ctx *d.ContextInformation, payment domain.PaymentRequest) (*string, apierrors.ApiError) {
+	return c.pay(ctx, payOperation, iso8583.FinancialRequest, payment)
+}
+
+func (c *isoConnector) Authorize(ctx *d.ContextInformation, payment domain.PaymentRequest) (*string, apierrors.ApiError) {
+	return c.pay(ctx, authorizeOperation, iso8583.AuthorizationRequest, payment)
+}
+
+// pay sends a payment (0200) or an authorization (0100)
+func (c *isoConnector) pay(ctx *d.ContextInformation, operation, mti string, payment domain.PaymentRequest) (*string, apierrors.ApiError) {
+	currency, _ := money.LookupCurrency(payment.Currency)
+	request := iso8583.NewMessage(mti).
+		Set(iso8583.FieldCardHash, payment.CardHash).
+		Set(iso8583.FieldProcessingCode, iso8583.PurchaseProcessingCode).
+		Set(iso8583.FieldAmount, isoAmount(payment.Amount)).
+		Set(iso8583.FieldCardAcceptorID, strconv.FormatUint(payment.MerchantID, 10)).
+		Set(iso8583.FieldReference, payment.Reference).
+		Set(iso8583.FieldCurrency, currency.Numeric)
+
+	res, err := c.exchange(ctx, operation, request)
+	if err != nil {
+		apierr := isoCallApiError(unansweredMessage(operation), err)
+		logger.Error(apierr.Message(), "bank-iso-payment", apierr, ctx, map[string]any{"reference": payment.Reference})
+		return nil, apierr
+	}
+
+	if apierr := isoApiError(declinedMessage(operation), res); apierr != nil {
+		logger.Error(apierr.Message(), "bank-iso-payment", apierr, ctx, map[string]any{"reference": payment.Reference, "action_code": res.Get(iso8583.FieldActionCode)})
+		return nil, apierr
+	}
+
+	operationID := res.Get(iso8583.FieldOperationID)
+	return &operationID, nil
+}
+
+func (c *isoConnector) ReverseOperation(ctx *d.ContextInformation, operationID string) apierrors.ApiError {
+	return c.reverse(ctx, reversalOperation, operationID)
+}
+
+// Void is a reversal as well, the bank voids the operation if it's a hold
+func (c *isoConnector) Void(ctx *d.ContextInformation, operationID string) apierrors.ApiError {
+	return c.reverse(ctx, voidOperation, operationID)
+}
+
+// reverse sends a reversal (0400) of an operation, or of a payment reference if its answer never came. A reversal
+// that isn't answered is repeated (0401) so the bank can tell it from a new one
+func (c *isoConnector) reverse(ctx *d.ContextInformation, operation, operationID string) apierrors.ApiError {
+	mti := iso8583.ReversalRequest
+	for attempt := 1; ; attempt++ {
+		res, err := c.exchange(ctx, operation, iso8583.NewMessage(mti).Set(iso8583.FieldOperationID, operationID))
+		if err == nil {
+			apierr := isoApiError(declinedMessage(operation), res)
+			if apierr != nil && operation == reversalOperation && nothingToReverse(apierr) {
+				logger.Info("there's nothing left to reverse", "bank-iso-reversal", ctx, map[string]any{"operation_id": operationID, "action_code": res.Get(iso8583.FieldActionCode)})
+				return nil
+			}
+			if apierr != nil {
+				logger.Error(apierr.Message(), "bank-iso-reversal", apierr, ctx, map[string]any{"operation_id": operationID, "action_code": res.Get(iso8583.FieldActionCode)})
+			}
+			return apierr
+		}
+
+		if attempt >= retryMaxAttempts() || errors.Is(err, errBankUnavailable) || errors.Is(err, iso8583.ErrInvalidMessage) {
+			apierr := isoCallApiError(unansweredMessage(operation), err)
+			logger.Error(apierr.Message(), "bank-iso-reversal", apierr, ctx, map[string]any{"operation_id": operationID})
+			return apierr
+		}
+
+		mti = iso8583.ReversalRepeat
+		wait := retryBackoff(attempt)
+		logger.Info("repeating the reversal", "bank-retry", ctx, map[string]any{"bank_id": c.bankID, "operation": operation, "attempt": attempt, "wait": wait.String()})
+		select {
+		case <-ctx.GetCtx().Done():
+			return isoCallApiError(unansweredMessage(operation), ctx.GetCtx().Err())
+		case <-time.After(wait):
+		}
+	}
+}
+
+// RefundPayment sends a payment (0200) with the refund processing code
+func (c *isoConnector) RefundPayment(ctx *d.ContextInformation, operationID string, amount money.Amount) apierrors.ApiError {
+	request := iso8583.NewMessage(iso8583.FinancialRequest).
+		Set(iso8583.FieldProcessingCode, iso8583.RefundProcessingCode).
+		Set(iso8583.FieldAmount, isoAmount(amount)).
+		Set(iso8583.FieldReference, refundIdempotencyKey(ctx, operationID)).
+		Set(iso8583.FieldOperationID, operationID)
+
+	return c.send(ctx, refundOperation, operationID, request)
+}
+
+// Capture sends a completion advice (0220) for the captured amount
+func (c *isoConnector) Capture(ctx *d.ContextInformation, operationID string, amount money.Amount) apierrors.ApiError {
+	request := iso8583.NewMessage(iso8583.CompletionAdvice).
+		Set(iso8583.FieldAmount, isoAmount(amount)).
+		Set(iso8583.FieldOperationID, operationID)
+
+	return c.send(ctx, captureOperation, operationID, request)
+}
+
+// GetOperation isn't part of the ISO 8583 link. Acquirers reverse the payments they never got the answer of instead,
+// which is what the payments app does when the bank has no answer
+func (c *isoConnector) GetOperation(ctx *d.ContextInformation, reference string) (*d.BankOperation, apierrors.ApiError) {
+	apierr := apierrors.NewApiError("the ISO 8583 link can't look up operations", "not_supported", http.StatusNotImplemented, nil)
+	logger.Error(apierr.Message(), "get-operation", apierr, ctx, map[string]any{"reference": reference})
+	return nil, apierr
+}
+
+// send makes a call that is neither retried nor reversed
+func (c *isoConnector) send(ctx *d.ContextInformation, operation, operationID string, request *iso8583.Message) apierrors.ApiError {
+	res, err := c.exchange(ctx, operation, request)
+	if err != nil {
+		apierr := isoCallApiError(unansweredMessage(operation), err)
+		logger.Error(apierr.Message(), fmt.Sprintf("%s-operation", operation), apierr, ctx, map[string]any{"operation_id": operationID})
+		return apierr
+	}
+
+	apierr := isoApiError(declinedMessage(operation), res)
+	if apierr != nil {
+		logger.Error(apierr.Message(), fmt.Sprintf("%s-operation", operation), apierr, ctx, map[string]any{"operation_id": operationID, "action_code": res.Get(iso8583.FieldActionCode)})
+	}
+	return apierr
+}
+
+// echo sends a network management message (0800) to check the link
+func (c *isoConnector) echo(ctx *d.ContextInformation) error {
+	_, err := c.roundTrip(ctx, timeout(c.config, echoOperation), iso8583.NewMessage(iso8583.NetworkRequest).Set(iso8583.FieldNetworkCode, iso8583.EchoNetworkCode))
+	return err
+}
+
+// heartbeat echoes the bank every interval, so a broken connection is found and dialed again before a payment needs it.
+// It stops when the connector is closed
+func (c *isoConnector) heartbeat(interval time.Duration) {
+	worker.Until(c.done, interval, interval, func(ctx *d.ContextInformation) {
+		if err := c.echo(ctx); err != nil {
+			logger.Error("the ISO 8583 echo failed", "bank-iso-echo", err, ctx, map[string]any{"bank_id": c.bankID})
+		}
+	})
+}
+
+// Close stops the heartbeat and closes the connection to the bank, the calls made after it fail
+func (c *isoConnector) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+	l := c.link
+	c.link = nil
+	c.mu.Unlock()
+
+	if l != nil {
+		l.close()
+	}
+	return nil
+}
+
+// exchange sends a message through the circuit breaker of the bank. Like the 5xx of the HTTP API, the answers with
+// an error action code count as failures
+func (c *isoConnector) exchange(ctx *d.ContextInformation, operation string, request *iso8583.Message) (*iso8583.Message, error) {
+	// A message that can't be encoded isn't a failure of the bank
+	if _, err := request.Pack(); err != nil {
+		return nil, err
+	}
+
+	if !c.breaker.allow() {
+		return nil, errBankUnavailable
+	}
+
+	res, err := c.roundTrip(ctx, timeout(c.config, operation), request)
+	if err != nil || isSystemError(res) {
+		if c.breaker.failure() {
+			logger.Error("bank circuit breaker opened", "bank-circuit-breaker", errBankUnavailable, ctx, map[string]any{"bank_id": c.bankID})
+		}
+	} else {
+		c.breaker.success()
+	}
+	return res, err
+}
+
+// roundTrip sends a message and waits for its answer
+func (c *isoConnector) roundTrip(ctx *d.ContextInformation, timeout time.Duration, request *iso8583.Message) (*iso8583.Message, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx.GetCtx(), timeout)
+	defer cancel()
+
+	stan := fmt.Sprintf("%06d", c.stan.Add(1)%1000000)
+	request.Set(iso8583.FieldSTAN, stan).
+		Set(iso8583.FieldTransmissionTime, time.Now().UTC().Format(iso8583.TransmissionTimeLayout))
+
+	l, err := c.connect(timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	answer, err := l.send(request, stan, timeout)
+	if err != nil {
+		c.drop(l)
+		return nil, err
+	}
+
+	select {
+	case res, ok := <-answer:
+		if !ok {
+			return nil, errLinkClosed
+		}
+		return res, nil
+	case <-timeoutCtx.Done():
+		l.forget(stan)
+		return nil, timeoutCtx.Err()
+	}
+}
+
+// connect returns the connection to the bank, it's dialed if there's none
+func (c *isoConnector) connect(timeout time.Duration) (*link, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, errLinkClosed
+	}
+
+	if c.link != nil {
+		return c.link, nil
+	}
+
+	conn, err := net.DialTimeout("tcp", c.config.ISOAddress, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	c.link = &link{conn: conn, pending: make(map[string]chan *iso8583.Message)}
+	go c.read(c.link)
+	return c.link, nil
+}
+
+// read hands the answers of the bank to the calls waiting for them until the connection breaks. The answers of the
+// calls that timed out are dropped
+func (c *isoConnector) read(l *link) {
+	for {
+		res, err := iso8583.ReadMessage(l.conn)
+		if err != nil {
+			if !l.isClosed() {
+				logger.Error("the ISO 8583 connection broke", "bank-iso-read", err, nil, map[string]any{"bank_id": c.bankID})
+			}
+			c.drop(l)
+			return
+		}
+
+		if answer := l.forget(res.Get(iso8583.FieldSTAN)); answer != nil {
+			answer <- res
+		}
+	}
+}
+
+// drop closes a broken connection, the calls waiting for an answer on it fail right away
+func (c *isoConnector) drop(l *link) {
+	c.mu.Lock()
+	if c.link == l {
+		c.link = nil
+	}
+	c.mu.Unlock()
+	l.close()
+}
+
+func (l *link) send(request *iso8583.Message, stan string, timeout time.Duration) (chan *iso8583.Message, error) {
+	answer := make(chan *iso8583.Message, 1)
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil, errLinkClosed
+	}
+	l.pending[stan] = answer
+	l.mu.Unlock()
+
+	l.writing.Lock()
+	defer l.writing.Unlock()
+	_ = l.conn.SetWriteDeadline(time.Now().Add(timeout))
+	if err := iso8583.WriteMessage(l.conn, request); err != nil {
+		l.forget(stan)
+		return nil, err
+	}
+	return answer, nil
+}
+
+// forget stops waiting for the answer of a STAN and returns the channel of the call that was waiting for it
+func (l *link) forget(stan string) chan *iso8583.Message {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	answer, ok := l.pending[stan]
+	if !ok {
+		return nil
+	}
+	delete(l.pending, stan)
+	return answer
+}
+
+func (l *link) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return
+	}
+
+	l.closed = true
+	_ = l.conn.Close()
+	for stan, answer := range l.pending {
+		close(answer)
+		delete(l.pending, stan)
+	}
+}
+
+func (l *link) isClosed() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.closed
+}
+
+func isSystemError(res *iso8583.Message) bool {
+	code, _ := iso8583.Lookup(res.Get(iso8583.FieldActionCode))
+	return code.Category == iso8583.ErrorCategory
+}
+
+// isoAmount is the amount of field 4, in hundredths
+func isoAmount(amount money.Amount) string {
+	return strconv.FormatInt(amount.MinorUnits(), 10)
+}
+
+// isoApiError is the error of an answer that wasn't approved. Its code is the decline code of field 44, like the
+// errors of the HTTP API, and it keeps the action code of field 39
+func isoApiError(message string, res *iso8583.Message) apierrors.ApiError {
+	actionCode := res.Get(iso8583.FieldActionCode)
+	if actionCode == iso8583.Approved {
+		return nil
+	}
+
+	declineCode := res.Get(iso8583.FieldAdditionalResponse)
+	if declineCode == "" {
+		declineCode = defines.UNKNOWN_DECLINE
+	}
+
+	status := http.StatusBadRequest
+	code, _ := iso8583.Lookup(actionCode)
+	switch {
+	case declineCode == defines.OPERATION_NOT_FOUND_DECLINE:
+		status = http.StatusNotFound
+	case code.Category == iso8583.ErrorCategory:
+		status = http.StatusBadGateway
+	}
+
+	return &isoError{
+		ApiError:   apierrors.NewApiError(message, declineCode, status, apierrors.CauseList{fmt.Sprintf("action code %s", actionCode)}),
+		actionCode: actionCode,
+	}
+}
+
+func unansweredMessage(operation string) string {
+	return fmt.Sprintf("the bank didn't answer the %s", operationNames[operation])
+}
+
+func declinedMessage(operation string) string {
+	return fmt.Sprintf("can't perform the %s", operationNames[operation])
+}
+
+// isoCallApiError is the error of a call the bank never answered
+func isoCallApiError(message string, err error) apierrors.ApiError {
+	if errors.Is(err, iso8583.ErrInvalidMessage) || errors.Is(err, iso8583.ErrUnknownField) {
+		return apierrors.NewBadRequestApiError(err.Error())
+	}
+	return callApiError(message, err)
+}
+
+// ParseAPIError maps an error of the bank to its ISO 8583 code. The codes of the bank config come first, then the
+// action code the bank answered with
+func (c *isoConnector) ParseAPIError(apierr apierrors.ApiError) string {
+	if code, ok := c.config.ErrorCodes[strings.ToLower(apierr.Code())]; ok {
+		return code
+	}
+
+	var isoErr *isoError
+	if errors.As(apierr, &isoErr) {
+		return isoErr.actionCode
+	}
+	return ParseAPIError(apierr)
+}
+
+func (c *isoConnector) GetBreaker() BreakerState {
+	return c.breaker.snapshot()
+}
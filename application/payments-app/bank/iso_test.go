@@ -0,0 +1,257 @@
+package bank
+
+import (
+	"github.com/negarciacamilo/deuna_challenge/application/defines"
+	d "github.com/negarciacamilo/deuna_challenge/application/domain"
+	"github.com/negarciacamilo/deuna_challenge/application/iso8583"
+	"github.com/negarciacamilo/deuna_challenge/application/money"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/domain"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// isoBank is a fake bank that answers with the handler, a nil answer is never sent
+type isoBank struct {
+	listener net.Listener
+	mu       sync.Mutex
+	received []*iso8583.Message
+	conns    []net.Conn
+}
+
+func setupISOBank(t *testing.T, config d.BankConfig, handler func(request *iso8583.Message) *iso8583.Message) (BankConnector, *isoBank) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	bank := &isoBank{listener: listener}
+	t.Cleanup(bank.close)
+	t.Cleanup(viper.Reset)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			bank.mu.Lock()
+			bank.conns = append(bank.conns, conn)
+			bank.mu.Unlock()
+
+			go func() {
+				var writing sync.Mutex
+				for {
+					request, err := iso8583.ReadMessage(conn)
+					if err != nil {
+						return
+					}
+					bank.mu.Lock()
+					bank.received = append(bank.received, request)
+					bank.mu.Unlock()
+
+					go func() {
+						if res := handler(request); res != nil {
+							writing.Lock()
+							defer writing.Unlock()
+							_ = iso8583.WriteMessage(conn, res)
+						}
+					}()
+				}
+			}()
+		}
+	}()
+
+	viper.Set("BANK_RETRY_MAX_ATTEMPTS", 3)
+	viper.Set("BANK_RETRY_BACKOFF_BASE", "1ms")
+	viper.Set("BANK_RETRY_BACKOFF_MAX", "5ms")
+	viper.Set("BANK_TIMEOUT", "50ms")
+	config.ISOAddress = listener.Addr().String()
+	return NewISOConnector(1, config), bank
+}
+
+func (b *isoBank) messages() []*iso8583.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]*iso8583.Message{}, b.received...)
+}
+
+// dropConnections breaks the connections of the payments app
+func (b *isoBank) dropConnections() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, conn := range b.conns {
+		_ = conn.Close()
+	}
+	b.conns = nil
+}
+
+func (b *isoBank) close() {
+	_ = b.listener.Close()
+	b.dropConnections()
+}
+
+func approve(request *iso8583.Message) *iso8583.Message {
+	return iso8583.NewResponse(request).
+		Set(iso8583.FieldActionCode, iso8583.Approved).
+		Set(iso8583.FieldOperationID, "op-"+request.Get(iso8583.FieldReference))
+}
+
+func TestISOPay(t *testing.T) {
+	ctx := d.BackgroundContext()
+	payment := domain.PaymentRequest{Amount: money.MustParse("10.25"), Currency: "USD", MerchantID: 7, CardHash: "hash", Reference: "ref"}
+
+	t.Run("Approved payments return the operation of the bank", func(t *testing.T) {
+		connector, bank := setupISOBank(t, d.BankConfig{}, approve)
+
+		operationID, apierr := connector.Pay(ctx, payment)
+		require.Nil(t, apierr)
+		require.Equal(t, "op-ref", *operationID)
+
+		request := bank.messages()[0]
+		require.Equal(t, iso8583.FinancialRequest, request.MTI)
+		require.Equal(t, "000000001025", request.Get(iso8583.FieldAmount))
+		require.Equal(t, "840", request.Get(iso8583.FieldCurrency))
+		require.Equal(t, "7", request.Get(iso8583.FieldCardAcceptorID))
+		require.Equal(t, "hash", request.Get(iso8583.FieldCardHash))
+		require.Equal(t, "ref", request.Get(iso8583.FieldReference))
+
+		_, apierr = connector.Authorize(ctx, payment)
+		require.Nil(t, apierr)
+		require.Equal(t, iso8583.AuthorizationRequest, bank.messages()[1].MTI)
+	})
+
+	t.Run("Declines keep the action code of the bank", func(t *testing.T) {
+		connector, _ := setupISOBank(t, d.BankConfig{ErrorCodes: map[string]string{defines.LIMIT_EXCEEDED_DECLINE: "1021"}}, func(request *iso8583.Message) *iso8583.Message {
+			declineCode := defines.INSUFFICIENT_FUNDS_DECLINE
+			if request.Get(iso8583.FieldCardHash) == "limited" {
+				declineCode = defines.LIMIT_EXCEEDED_DECLINE
+			}
+			return iso8583.NewResponse(request).
+				Set(iso8583.FieldActionCode, iso8583.ForDecline(declineCode)).
+				Set(iso8583.FieldAdditionalResponse, declineCode)
+		})
+
+		_, apierr := connector.Pay(ctx, payment)
+		require.Equal(t, defines.INSUFFICIENT_FUNDS_DECLINE, apierr.Code())
+		require.Equal(t, iso8583.InsufficientFunds, connector.ParseAPIError(apierr))
+
+		limited := payment
+		limited.CardHash = "limited"
+		_, apierr = connector.Pay(ctx, limited)
+		require.Equal(t, "1021", connector.ParseAPIError(apierr))
+		require.Equal(t, BreakerClosed, connector.GetBreaker().State)
+	})
+
+	t.Run("Unanswered payments", func(t *testing.T) {
+		connector, bank := setupISOBank(t, d.BankConfig{}, func(request *iso8583.Message) *iso8583.Message {
+			if request.MTI == iso8583.FinancialRequest {
+				return nil
+			}
+			return approve(request)
+		})
+
+		_, apierr := connector.Pay(ctx, payment)
+		require.NotNil(t, apierr)
+		require.True(t, Unanswered(apierr))
+		require.Equal(t, iso8583.SystemError, connector.ParseAPIError(apierr))
+
+		// The payments service reverses it
+		require.Len(t, bank.messages(), 1)
+	})
+
+	t.Run("Invalid messages aren't sent", func(t *testing.T) {
+		connector, bank := setupISOBank(t, d.BankConfig{}, approve)
+
+		invalid := payment
+		invalid.CardHash = string(make([]byte, 100))
+		_, apierr := connector.Pay(ctx, invalid)
+		require.Equal(t, 400, apierr.Status())
+		require.Empty(t, bank.messages())
+	})
+}
+
+func TestISOReversal(t *testing.T) {
+	ctx := d.BackgroundContext()
+	connector, bank := setupISOBank(t, d.BankConfig{}, func(request *iso8583.Message) *iso8583.Message {
+		// The first reversal gets lost
+		if request.MTI == iso8583.ReversalRequest {
+			return nil
+		}
+		return approve(request)
+	})
+
+	require.Nil(t, connector.ReverseOperation(ctx, "op"))
+	messages := bank.messages()
+	require.Len(t, messages, 2)
+	require.Equal(t, iso8583.ReversalRequest, messages[0].MTI)
+	require.Equal(t, iso8583.ReversalRepeat, messages[1].MTI)
+	require.Equal(t, "op", messages[1].Get(iso8583.FieldOperationID))
+}
+
+func TestISOLink(t *testing.T) {
+	ctx := d.BackgroundContext()
+
+	t.Run("Answers are matched to their requests by STAN", func(t *testing.T) {
+		connector, _ := setupISOBank(t, d.BankConfig{}, func(request *iso8583.Message) *iso8583.Message {
+			// The later the request, the sooner the answer
+			stan, _ := strconv.Atoi(request.Get(iso8583.FieldSTAN))
+			time.Sleep(time.Duration(20-stan) * time.Millisecond)
+			return approve(request)
+		})
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(reference string) {
+				defer wg.Done()
+				operationID, apierr := connector.Pay(ctx, domain.PaymentRequest{Amount: 100, Currency: "USD", Reference: reference})
+				require.Nil(t, apierr)
+				require.Equal(t, "op-"+reference, *operationID)
+			}(strconv.Itoa(i))
+		}
+		wg.Wait()
+	})
+
+	t.Run("A broken connection is dialed again", func(t *testing.T) {
+		connector, bank := setupISOBank(t, d.BankConfig{}, approve)
+		iso := connector.(*isoConnector)
+
+		require.NoError(t, iso.echo(ctx))
+		require.Equal(t, iso8583.NetworkRequest, bank.messages()[0].MTI)
+		require.Equal(t, iso8583.EchoNetworkCode, bank.messages()[0].Get(iso8583.FieldNetworkCode))
+
+		bank.dropConnections()
+		require.Eventually(t, func() bool {
+			iso.mu.Lock()
+			defer iso.mu.Unlock()
+			return iso.link == nil
+		}, time.Second, time.Millisecond)
+
+		require.NoError(t, iso.echo(ctx))
+		require.Len(t, bank.messages(), 2)
+	})
+
+	t.Run("The heartbeat stops when the connector is closed", func(t *testing.T) {
+		viper.Set("ISO_ECHO_INTERVAL", "5ms")
+		connector, bank := setupISOBank(t, d.BankConfig{}, approve)
+		iso := connector.(*isoConnector)
+
+		require.Eventually(t, func() bool { return len(bank.messages()) > 0 }, time.Second, time.Millisecond)
+		require.NoError(t, iso.Close())
+		// An echo sent right before closing may still be on its way
+		time.Sleep(10 * time.Millisecond)
+		echoes := len(bank.messages())
+
+		time.Sleep(30 * time.Millisecond)
+		require.Len(t, bank.messages(), echoes)
+		require.ErrorIs(t, iso.echo(ctx), errLinkClosed)
+	})
+
+	t.Run("GetOperation isn't supported", func(t *testing.T) {
+		connector, _ := setupISOBank(t, d.BankConfig{}, approve)
+		_, apierr := connector.GetOperation(ctx, "ref")
+		require.Equal(t, 501, apierr.Status())
+	})
+}
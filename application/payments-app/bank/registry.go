@@ -0,0 +1,68 @@
+package bank
+
+import (
+	"github.com/go-resty/resty/v2"
+	"github.com/negarciacamilo/deuna_challenge/application/apierrors"
+	"github.com/negarciacamilo/deuna_challenge/application/defines"
+	d "github.com/negarciacamilo/deuna_challenge/application/domain"
+	"github.com/negarciacamilo/deuna_challenge/application/logger"
+	"sort"
+)
+
+// Registry has the connector of every bank the payments app works with
+type Registry interface {
+	Get(ctx *d.ContextInformation, bankID uint64) (BankConnector, apierrors.ApiError)
+	GetBreakers() []BreakerState
+}
+
+type registry struct {
+	connectors map[uint64]BankConnector
+}
+
+// NewRegistry creates a connector for every bank in the BANKS config
+func NewRegistry(httpClient *resty.Client) Registry {
+	configs, err := d.GetBankConfigs()
+	if err != nil {
+		logger.Panic("can't read the banks config", "new-bank-registry", err, nil)
+	}
+
+	connectors := make(map[uint64]BankConnector, len(configs))
+	for bankID, config := range configs {
+		switch config.Protocol {
+		case "", defines.HTTP_PROTOCOL:
+			connectors[bankID] = NewHTTPConnector(bankID, config, httpClient)
+		case defines.ISO8583_PROTOCOL:
+			connectors[bankID] = NewISOConnector(bankID, config)
+		default:
+			logger.Panic("unknown bank protocol", "new-bank-registry", nil, nil, map[string]any{"bank_id": bankID, "protocol": config.Protocol})
+		}
+	}
+	return NewStaticRegistry(connectors)
+}
+
+// NewStaticRegistry creates a registry with the given connectors by bank id
+func NewStaticRegistry(connectors map[uint64]BankConnector) Registry {
+	return &registry{connectors: connectors}
+}
+
+// Get returns the connector of a bank, a bank that isn't set up is a bad request
+func (r *registry) Get(ctx *d.ContextInformation, bankID uint64) (BankConnector, apierrors.ApiError) {
+	connector, ok := r.connectors[bankID]
+	if !ok {
+		apierr := apierrors.NewBadRequestApiError("invalid bank id")
+		logger.Error(apierr.Message(), "get-bank-connector", apierr, ctx, map[string]any{"bank_id": bankID})
+		return nil, apierr
+	}
+	return connector, nil
+}
+
+// GetBreakers returns the circuit breaker state of every bank
+func (r *registry) GetBreakers() []BreakerState {
+	states := make([]BreakerState, 0, len(r.connectors))
+	for _, connector := range r.connectors {
+		states = append(states, connector.GetBreaker())
+	}
+
+	sort.Slice(states, func(i, j int) bool { return states[i].BankID < states[j].BankID })
+	return states
+}
@@ -0,0 +1,39 @@
+package code
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/negarciacamilo/deuna_challenge/application/apierrors"
+	"github.com/negarciacamilo/deuna_challenge/application/context"
+	"github.com/negarciacamilo/deuna_challenge/application/iso8583"
+	"github.com/negarciacamilo/deuna_challenge/application/response"
+	"net/http"
+)
+
+type Handler interface {
+	GetCodes(c *gin.Context)
+	GetCode(c *gin.Context)
+}
+
+type handler struct{}
+
+func NewHandler() Handler {
+	return &handler{}
+}
+
+// GetCodes returns the catalogue of the ISO 8583 codes a payment can have
+func (h *handler) GetCodes(c *gin.Context) {
+	ctx := context.GetContextInformation(c)
+	response.Respond(ctx, response.New(http.StatusOK, iso8583.Codes()), nil)
+}
+
+func (h *handler) GetCode(c *gin.Context) {
+	ctx := context.GetContextInformation(c)
+	code, ok := iso8583.Lookup(c.Param("code"))
+	if !ok {
+		response.Respond(ctx, nil, apierrors.NewNotFoundApiError(fmt.Sprintf("code %s not found", c.Param("code"))))
+		return
+	}
+
+	response.Respond(ctx, response.New(http.StatusOK, code), nil)
+}
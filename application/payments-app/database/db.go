@@ -51,6 +51,7 @@ func New(forTest ...bool) Database {
 	}
 
 	createTables(db)
+	migrate(db)
 
 	return &database{db: db, mock: nil}
 }
@@ -64,6 +65,13 @@ func (d *database) GetMock() sqlmock.Sqlmock {
 }
 
 func (d *database) HandleDBError(ctx *domain.ContextInformation, table, operation string, err error) apierrors.ApiError {
+	// Business errors returned within a transaction are kept as they are
+	var apierr apierrors.ApiError
+	if errors.As(err, &apierr) {
+		logger.Error(apierr.Message(), logger.GetCallerFunctionName(), err, ctx)
+		return apierr
+	}
+
 	if errors.Is(err, sql.ErrNoRows) {
 		apierr := apierrors.NewNotFoundApiError(fmt.Sprintf("error, %s not found", table))
 		logger.Error(apierr.Message(), logger.GetCallerFunctionName(), err, ctx)
@@ -81,6 +89,13 @@ func createTables(db *bun.DB) {
 		(*dbd.Customer)(nil),
 		(*dbd.Merchant)(nil),
 		(*dbd.Payment)(nil),
+		(*dbd.Refund)(nil),
+		(*dbd.PaymentStatusHistory)(nil),
+		(*dbd.WebhookEndpoint)(nil),
+		(*dbd.WebhookDelivery)(nil),
+		(*dbd.OutboxEvent)(nil),
+		(*dbd.Reversal)(nil),
+		(*dbd.IdempotencyKey)(nil),
 	}
 
 	for _, model := range models {
@@ -89,3 +104,30 @@ func createTables(db *bun.DB) {
 		}
 	}
 }
+
+// migrations add the columns added to the tables after they were created, which creating them doesn't. They're run in
+// order on every start, so each one must be safe to run again
+var migrations = []string{
+	"ALTER TABLE merchants ADD COLUMN IF NOT EXISTS accepted_currencies varchar[]",
+	"ALTER TABLE payments ADD COLUMN IF NOT EXISTS currency char(3) NOT NULL DEFAULT 'USD'",
+	"ALTER TABLE payments ADD COLUMN IF NOT EXISTS reference varchar UNIQUE",
+	"ALTER TABLE payments ADD COLUMN IF NOT EXISTS reversal_status varchar",
+	"ALTER TABLE payments ADD COLUMN IF NOT EXISTS refunded_amount numeric(12,2) NOT NULL DEFAULT 0",
+	"ALTER TABLE payments ADD COLUMN IF NOT EXISTS refunding_amount numeric(12,2) NOT NULL DEFAULT 0",
+	"ALTER TABLE payments ADD COLUMN IF NOT EXISTS authorized_amount numeric(12,2) NOT NULL DEFAULT 0",
+	"ALTER TABLE payments ADD COLUMN IF NOT EXISTS authorization_expires_at timestamptz",
+	// The bank of the queued reversals is the one of their payment
+	"ALTER TABLE reversals ADD COLUMN IF NOT EXISTS bank_id bigint",
+	"UPDATE reversals SET bank_id = payments.bank_id FROM payments WHERE reversals.payment_id = payments.id AND reversals.bank_id IS NULL",
+	"ALTER TABLE reversals ALTER COLUMN bank_id SET NOT NULL",
+	// The keys stored without a fingerprint expire, a retry with one of them is taken as another request
+	"ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS fingerprint varchar NOT NULL DEFAULT ''",
+}
+
+func migrate(db *bun.DB) {
+	for _, migration := range migrations {
+		if _, err := db.ExecContext(context.Background(), migration); err != nil {
+			logger.Panic(fmt.Sprintf("can't run the migration %s", migration), "migrate", err, nil)
+		}
+	}
+}
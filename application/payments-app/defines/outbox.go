@@ -0,0 +1,10 @@
+package defines
+
+const (
+	PAYMENT_CREATED_EVENT        = "payment.created"
+	PAYMENT_STATUS_CHANGED_EVENT = "payment.status_changed"
+
+	// Outbox sinks
+	LOG_SINK  = "log"
+	HTTP_SINK = "http"
+)
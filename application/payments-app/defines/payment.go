@@ -7,6 +7,14 @@ const (
 	REJECTED_STATUS  = 3
 	REFUNDED_STATUS  = 4
 	REVERSAL_STATUS  = 5
+	// The payment has at least one refund but there's still some balance left
+	PARTIALLY_REFUNDED_STATUS = 6
+	// The funds are on hold waiting to be captured or voided
+	AUTHORIZED_STATUS = 7
 
-	APPROVE_CODE = "0000"
+	// The currency of the payments that don't send one, the same as the default of the column
+	DEFAULT_CURRENCY = "USD"
+
+	AUTOMATIC_CAPTURE = "automatic"
+	MANUAL_CAPTURE    = "manual"
 )
@@ -0,0 +1,6 @@
+package defines
+
+const (
+	REVERSAL_PENDING   = "pending"
+	REVERSAL_CONFIRMED = "confirmed"
+)
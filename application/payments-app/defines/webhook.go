@@ -0,0 +1,14 @@
+package defines
+
+const (
+	PAYMENT_APPROVED_EVENT   = "payment.approved"
+	PAYMENT_REJECTED_EVENT   = "payment.rejected"
+	PAYMENT_REFUNDED_EVENT   = "payment.refunded"
+	PAYMENT_REVERSED_EVENT   = "payment.reversed"
+	PAYMENT_AUTHORIZED_EVENT = "payment.authorized"
+	PAYMENT_CANCELLED_EVENT  = "payment.cancelled"
+
+	DELIVERY_PENDING   = "pending"
+	DELIVERY_SUCCEEDED = "succeeded"
+	DELIVERY_DEAD      = "dead"
+)
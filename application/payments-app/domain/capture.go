@@ -0,0 +1,23 @@
+package domain
+
+import (
+	"github.com/negarciacamilo/deuna_challenge/application/apierrors"
+	"github.com/negarciacamilo/deuna_challenge/application/domain"
+	"github.com/negarciacamilo/deuna_challenge/application/logger"
+	"github.com/negarciacamilo/deuna_challenge/application/money"
+)
+
+type CaptureRequest struct {
+	// If no amount is sent, then the whole authorized amount is captured
+	Amount *money.Amount `json:"amount"`
+}
+
+func (r *CaptureRequest) Validate(ctx *domain.ContextInformation) apierrors.ApiError {
+	if r.Amount != nil && (*r.Amount <= 0 || *r.Amount > money.Max) {
+		apierr := apierrors.NewBadRequestApiError("invalid capture amount")
+		logger.Error(apierr.Error(), "validate-capture-amount", apierr, ctx, map[string]any{"amount": *r.Amount})
+		return apierr
+	}
+
+	return nil
+}
@@ -0,0 +1,225 @@
+package domain
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/negarciacamilo/deuna_challenge/application/apierrors"
+	"github.com/negarciacamilo/deuna_challenge/application/domain"
+	dbd "github.com/negarciacamilo/deuna_challenge/application/domain/database"
+	"github.com/negarciacamilo/deuna_challenge/application/logger"
+	"github.com/negarciacamilo/deuna_challenge/application/money"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/statemachine"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+
+	SortByCreatedAt = "created_at"
+	SortByAmount    = "amount"
+
+	Ascending  = "asc"
+	Descending = "desc"
+)
+
+// PaymentFilter is built from the query params of the payment listings
+type PaymentFilter struct {
+	Statuses    []int
+	MerchantID  *uint64
+	BankID      *uint64
+	CustomerID  *uint64
+	MinAmount   *money.Amount
+	MaxAmount   *money.Amount
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	// CreatedBefore is the exclusive bound of a created_to that's a plain date, so the whole day is included
+	CreatedBefore *time.Time
+	SortBy        string
+	Order         string
+	Limit         int
+	// After is the decoded cursor, the page starts right after it
+	After *Cursor
+}
+
+// Cursor points to the last payment of a page, it has the value of the sorted column and the id as a tiebreaker
+type Cursor struct {
+	Value string `json:"v"`
+	ID    uint64 `json:"id"`
+}
+
+// PaymentsPage is the envelope of every payment listing
+type PaymentsPage struct {
+	Data       []dbd.Payment `json:"data"`
+	NextCursor *string       `json:"next_cursor"`
+	Limit      int           `json:"limit"`
+}
+
+func (c Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// NewCursor builds the cursor of a payment for the given sort
+func NewCursor(p *dbd.Payment, sortBy string) Cursor {
+	if sortBy == SortByAmount {
+		return Cursor{Value: p.Amount.String(), ID: p.ID}
+	}
+	return Cursor{Value: p.CreatedAt.UTC().Format(time.RFC3339Nano), ID: p.ID}
+}
+
+// NewPaymentFilter parses and validates the filters, sorting and pagination query params
+func NewPaymentFilter(ctx *domain.ContextInformation) (PaymentFilter, apierrors.ApiError) {
+	c := ctx.GinContext
+	filter := PaymentFilter{SortBy: SortByCreatedAt, Order: Descending, Limit: DefaultPageSize}
+
+	if statuses := c.Query("status"); statuses != "" {
+		for _, s := range strings.Split(statuses, ",") {
+			status, ok := statemachine.ParseStatus(strings.TrimSpace(s))
+			if !ok {
+				return filter, invalidFilter(ctx, "status", s)
+			}
+			filter.Statuses = append(filter.Statuses, status)
+		}
+	}
+
+	var apierr apierrors.ApiError
+	if filter.MerchantID, apierr = parseUintQuery(ctx, "merchant_id"); apierr != nil {
+		return filter, apierr
+	}
+
+	if filter.BankID, apierr = parseUintQuery(ctx, "bank_id"); apierr != nil {
+		return filter, apierr
+	}
+
+	if filter.MinAmount, apierr = parseAmountQuery(ctx, "min_amount"); apierr != nil {
+		return filter, apierr
+	}
+
+	if filter.MaxAmount, apierr = parseAmountQuery(ctx, "max_amount"); apierr != nil {
+		return filter, apierr
+	}
+
+	if filter.CreatedFrom, _, apierr = parseTimeQuery(ctx, "created_from"); apierr != nil {
+		return filter, apierr
+	}
+
+	var dateOnly bool
+	if filter.CreatedTo, dateOnly, apierr = parseTimeQuery(ctx, "created_to"); apierr != nil {
+		return filter, apierr
+	}
+
+	if dateOnly {
+		before := filter.CreatedTo.AddDate(0, 0, 1)
+		filter.CreatedBefore = &before
+	}
+
+	if sortBy := c.Query("sort_by"); sortBy != "" {
+		if sortBy != SortByCreatedAt && sortBy != SortByAmount {
+			return filter, invalidFilter(ctx, "sort_by", sortBy)
+		}
+		filter.SortBy = sortBy
+	}
+
+	if order := c.Query("order"); order != "" {
+		if order != Ascending && order != Descending {
+			return filter, invalidFilter(ctx, "order", order)
+		}
+		filter.Order = order
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l <= 0 || l > MaxPageSize {
+			return filter, invalidFilter(ctx, "limit", limit)
+		}
+		filter.Limit = l
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		after, err := decodeCursor(cursor, filter.SortBy)
+		if err != nil {
+			return filter, invalidFilter(ctx, "cursor", cursor)
+		}
+		filter.After = after
+	}
+
+	return filter, nil
+}
+
+func decodeCursor(s, sortBy string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var cursor Cursor
+	if err = json.Unmarshal(b, &cursor); err != nil {
+		return nil, err
+	}
+
+	// The cursor has to match the sort, otherwise the page would start anywhere
+	if sortBy == SortByAmount {
+		_, err = money.Parse(cursor.Value)
+	} else {
+		_, err = time.Parse(time.RFC3339Nano, cursor.Value)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &cursor, nil
+}
+
+func parseUintQuery(ctx *domain.ContextInformation, name string) (*uint64, apierrors.ApiError) {
+	value := ctx.GinContext.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	v, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return nil, invalidFilter(ctx, name, value)
+	}
+	return &v, nil
+}
+
+func parseAmountQuery(ctx *domain.ContextInformation, name string) (*money.Amount, apierrors.ApiError) {
+	value := ctx.GinContext.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	v, err := money.Parse(value)
+	if err != nil {
+		return nil, invalidFilter(ctx, name, value)
+	}
+	return &v, nil
+}
+
+// parseTimeQuery accepts both plain dates and RFC 3339 timestamps, and tells if the value was a plain date
+func parseTimeQuery(ctx *domain.ContextInformation, name string) (*time.Time, bool, apierrors.ApiError) {
+	value := ctx.GinContext.Query(name)
+	if value == "" {
+		return nil, false, nil
+	}
+
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return &t, true, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, false, invalidFilter(ctx, name, value)
+	}
+	return &t, false, nil
+}
+
+func invalidFilter(ctx *domain.ContextInformation, name, value string) apierrors.ApiError {
+	apierr := apierrors.NewBadRequestApiError(fmt.Sprintf("invalid value for %s", name))
+	logger.Error(apierr.Message(), "payment-filter", apierr, ctx, map[string]any{name: value})
+	return apierr
+}
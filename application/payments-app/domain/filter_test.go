@@ -0,0 +1,101 @@
+package domain
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/negarciacamilo/deuna_challenge/application/domain"
+	dbd "github.com/negarciacamilo/deuna_challenge/application/domain/database"
+	"github.com/negarciacamilo/deuna_challenge/application/money"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/defines"
+	"github.com/stretchr/testify/require"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func contextWithQuery(query string) *domain.ContextInformation {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/payments?"+query, nil)
+	return &domain.ContextInformation{RequestInfo: &domain.RequestInfo{}, GinContext: c}
+}
+
+func TestNewPaymentFilter(t *testing.T) {
+	cursor := Cursor{Value: "2024-08-01T10:00:00Z", ID: 10}.Encode()
+	amountCursor := NewCursor(&dbd.Payment{Base: dbd.Base{ID: 3}, Amount: money.MustParse("12.50")}, SortByAmount).Encode()
+
+	tests := []struct {
+		name    string
+		query   string
+		want    PaymentFilter
+		wantErr bool
+	}{
+		{
+			name:  "defaults",
+			query: "",
+			want:  PaymentFilter{SortBy: SortByCreatedAt, Order: Descending, Limit: DefaultPageSize},
+		},
+		{
+			name:  "every filter",
+			query: "status=approved,4&merchant_id=2&bank_id=1&min_amount=10&max_amount=99.99&created_from=2024-08-01&sort_by=created_at&order=asc&limit=5&cursor=" + cursor,
+			want: PaymentFilter{
+				Statuses:    []int{defines.APPROVED_STATUS, defines.REFUNDED_STATUS},
+				MerchantID:  ptr(uint64(2)),
+				BankID:      ptr(uint64(1)),
+				MinAmount:   ptr(money.MustParse("10")),
+				MaxAmount:   ptr(money.MustParse("99.99")),
+				CreatedFrom: ptr(time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC)),
+				SortBy:      SortByCreatedAt,
+				Order:       Ascending,
+				Limit:       5,
+				After:       &Cursor{Value: "2024-08-01T10:00:00Z", ID: 10},
+			},
+		},
+		{
+			name:  "amount cursor",
+			query: "sort_by=amount&cursor=" + amountCursor,
+			want:  PaymentFilter{SortBy: SortByAmount, Order: Descending, Limit: DefaultPageSize, After: &Cursor{Value: "12.50", ID: 3}},
+		},
+		{
+			name:  "date only created_to includes the whole day",
+			query: "created_to=2024-08-31",
+			want: PaymentFilter{
+				CreatedTo:     ptr(time.Date(2024, 8, 31, 0, 0, 0, 0, time.UTC)),
+				CreatedBefore: ptr(time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC)),
+				SortBy:        SortByCreatedAt,
+				Order:         Descending,
+				Limit:         DefaultPageSize,
+			},
+		},
+		{
+			name:  "timestamp created_to is inclusive",
+			query: "created_to=2024-08-31T12:00:00Z",
+			want: PaymentFilter{
+				CreatedTo: ptr(time.Date(2024, 8, 31, 12, 0, 0, 0, time.UTC)),
+				SortBy:    SortByCreatedAt,
+				Order:     Descending,
+				Limit:     DefaultPageSize,
+			},
+		},
+		{name: "unknown status", query: "status=lost", wantErr: true},
+		{name: "limit too big", query: "limit=1000", wantErr: true},
+		{name: "invalid sort", query: "sort_by=customer", wantErr: true},
+		{name: "cursor of another sort", query: "sort_by=amount&cursor=" + cursor, wantErr: true},
+		{name: "invalid amount", query: "min_amount=1.001", wantErr: true},
+		{name: "created_to as long as a date that isn't one", query: "created_to=2024-08-3x", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, apierr := NewPaymentFilter(contextWithQuery(tt.query))
+			if tt.wantErr {
+				require.NotNil(t, apierr)
+				return
+			}
+			require.Nil(t, apierr)
+			require.Equal(t, tt.want, filter)
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
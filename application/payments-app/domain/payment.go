@@ -4,20 +4,35 @@ import (
 	"github.com/negarciacamilo/deuna_challenge/application/apierrors"
 	"github.com/negarciacamilo/deuna_challenge/application/domain"
 	"github.com/negarciacamilo/deuna_challenge/application/logger"
+	"github.com/negarciacamilo/deuna_challenge/application/money"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/defines"
 )
 
 type PaymentRequest struct {
-	Amount float64 `json:"amount"`
+	Amount money.Amount `json:"amount"`
+	// ISO 4217 currency code, USD if it's not sent
+	Currency string `json:"currency"`
 	// This is preloaded in the POS
 	MerchantID uint64 `json:"merchant_id"`
 	// This is inferred by the card number
 	BankID uint64 `json:"bank_id"`
 	// This is the hash generated by the POS to avoid sending sensitive information
 	CardHash string `json:"card_hash"`
+	// automatic (default) charges the card right away, manual only holds the funds until the payment is captured
+	CaptureMethod string `json:"capture_method"`
+	// Reference identifies the payment at the bank. It's set by the payments app before calling the bank, so it can ask
+	// for the operation if it never gets the answer
+	Reference string `json:"reference,omitempty"`
+}
+
+// IsManualCapture returns true if the funds should only be authorized and captured later on
+func (p *PaymentRequest) IsManualCapture() bool {
+	return p.CaptureMethod == defines.MANUAL_CAPTURE
 }
 
 func (p *PaymentRequest) Validate(ctx *domain.ContextInformation) apierrors.ApiError {
-	err := p.validateBank(ctx)
+	// The bank is checked against the configured ones by the service
+	err := p.validateCurrency(ctx)
 	if err != nil {
 		return err
 	}
@@ -37,31 +52,45 @@ func (p *PaymentRequest) Validate(ctx *domain.ContextInformation) apierrors.ApiE
 		return err
 	}
 
+	err = p.validateCaptureMethod(ctx)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
-var validBanksID = map[uint64]string{
-	1: "Santander",
-	2: "BBVA",
-	3: "HSBC",
-}
+func (p *PaymentRequest) validateAmount(ctx *domain.ContextInformation) apierrors.ApiError {
+	if p.Amount <= 0 || p.Amount > money.Max {
+		apierr := apierrors.NewBadRequestApiError("invalid amount")
+		logger.Error(apierr.Error(), "validate-amount", apierr, ctx, map[string]any{"amount": p.Amount})
+		return apierr
+	}
 
-func (p *PaymentRequest) validateBank(ctx *domain.ContextInformation) apierrors.ApiError {
-	if _, ok := validBanksID[p.BankID]; !ok {
-		apierr := apierrors.NewBadRequestApiError("invalid bank id")
-		logger.Error(apierr.Error(), "validate-bank", apierr, ctx, map[string]any{"bank_id": p.BankID})
+	// The currency was already validated
+	currency, _ := money.LookupCurrency(p.Currency)
+	if err := currency.Validate(p.Amount); err != nil {
+		apierr := apierrors.NewBadRequestApiError(err.Error())
+		logger.Error(apierr.Error(), "validate-amount", apierr, ctx, map[string]any{"amount": p.Amount, "currency": p.Currency})
 		return apierr
 	}
+
 	return nil
 }
 
-func (p *PaymentRequest) validateAmount(ctx *domain.ContextInformation) apierrors.ApiError {
-	if p.Amount <= 0 {
-		apierr := apierrors.NewBadRequestApiError("invalid amount")
-		logger.Error(apierr.Error(), "validate-amount", apierr, ctx, map[string]any{"amount": p.Amount})
+func (p *PaymentRequest) validateCurrency(ctx *domain.ContextInformation) apierrors.ApiError {
+	if p.Currency == "" {
+		p.Currency = defines.DEFAULT_CURRENCY
+	}
+
+	currency, ok := money.LookupCurrency(p.Currency)
+	if !ok {
+		apierr := apierrors.NewBadRequestApiError("invalid or unsupported currency")
+		logger.Error(apierr.Error(), "validate-currency", apierr, ctx, map[string]any{"currency": p.Currency})
 		return apierr
 	}
 
+	p.Currency = currency.Code
 	return nil
 }
 
@@ -83,3 +112,12 @@ func (p *PaymentRequest) validateCardHash(ctx *domain.ContextInformation) apierr
 	}
 	return nil
 }
+
+func (p *PaymentRequest) validateCaptureMethod(ctx *domain.ContextInformation) apierrors.ApiError {
+	if p.CaptureMethod != "" && p.CaptureMethod != defines.AUTOMATIC_CAPTURE && p.CaptureMethod != defines.MANUAL_CAPTURE {
+		apierr := apierrors.NewBadRequestApiError("invalid capture method")
+		logger.Error(apierr.Error(), "validate-capture-method", apierr, ctx, map[string]any{"capture_method": p.CaptureMethod})
+		return apierr
+	}
+	return nil
+}
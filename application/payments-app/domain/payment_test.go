@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"github.com/negarciacamilo/deuna_challenge/application/apierrors"
+	"github.com/negarciacamilo/deuna_challenge/application/domain"
+	"github.com/negarciacamilo/deuna_challenge/application/money"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestPaymentRequestCurrency(t *testing.T) {
+	request := func(currency string) PaymentRequest {
+		return PaymentRequest{Amount: money.MustParse("10"), Currency: currency, MerchantID: 1, BankID: 1, CardHash: "card"}
+	}
+
+	t.Run("Payments without a currency are in USD", func(t *testing.T) {
+		p := request("")
+		require.Nil(t, p.Validate(domain.TestContext()))
+		require.Equal(t, "USD", p.Currency)
+	})
+
+	t.Run("Unknown currencies are rejected", func(t *testing.T) {
+		p := request("XXX")
+		require.Equal(t, apierrors.NewBadRequestApiError("invalid or unsupported currency"), p.Validate(domain.TestContext()))
+	})
+}
@@ -0,0 +1,30 @@
+package domain
+
+import (
+	"github.com/negarciacamilo/deuna_challenge/application/apierrors"
+	"github.com/negarciacamilo/deuna_challenge/application/domain"
+	"github.com/negarciacamilo/deuna_challenge/application/logger"
+	"github.com/negarciacamilo/deuna_challenge/application/money"
+)
+
+type RefundRequest struct {
+	// If no amount is sent, then the remaining balance of the payment is refunded
+	Amount *money.Amount `json:"amount"`
+	Reason string        `json:"reason"`
+}
+
+func (r *RefundRequest) Validate(ctx *domain.ContextInformation) apierrors.ApiError {
+	if r.Amount != nil && (*r.Amount <= 0 || *r.Amount > money.Max) {
+		apierr := apierrors.NewBadRequestApiError("invalid refund amount")
+		logger.Error(apierr.Error(), "validate-refund-amount", apierr, ctx, map[string]any{"amount": *r.Amount})
+		return apierr
+	}
+
+	if len(r.Reason) > 255 {
+		apierr := apierrors.NewBadRequestApiError("refund reason is too long")
+		logger.Error(apierr.Error(), "validate-refund-reason", apierr, ctx)
+		return apierr
+	}
+
+	return nil
+}
@@ -0,0 +1,28 @@
+package domain
+
+import (
+	"github.com/negarciacamilo/deuna_challenge/application/money"
+	"time"
+)
+
+// MerchantSummary aggregates the payments of a merchant, amounts can't be added across currencies so there's one
+// CurrencySummary per currency
+type MerchantSummary struct {
+	MerchantID  uint64            `json:"merchant_id"`
+	CreatedFrom *time.Time        `json:"created_from,omitempty"`
+	CreatedTo   *time.Time        `json:"created_to,omitempty"`
+	Currencies  []CurrencySummary `json:"currencies"`
+}
+
+type CurrencySummary struct {
+	Currency      string `json:"currency" bun:"currency"`
+	PaymentsCount int64  `json:"payments_count" bun:"payments_count"`
+	// Approved payments are the ones that were charged, even if they were refunded afterwards
+	ApprovedCount int64 `json:"approved_count" bun:"approved_count"`
+	RejectedCount int64 `json:"rejected_count" bun:"rejected_count"`
+	// ApprovalRate is approved / (approved + rejected), pending, cancelled and reversed payments aren't considered
+	ApprovalRate          float64      `json:"approval_rate" bun:"-"`
+	Volume                money.Amount `json:"volume" bun:"volume"`
+	RefundedAmount        money.Amount `json:"refunded_amount" bun:"refunded_amount"`
+	RefundedPaymentsCount int64        `json:"refunded_payments_count" bun:"refunded_payments_count"`
+}
@@ -0,0 +1,51 @@
+package domain
+
+import (
+	"fmt"
+	"github.com/negarciacamilo/deuna_challenge/application/apierrors"
+	"github.com/negarciacamilo/deuna_challenge/application/domain"
+	"github.com/negarciacamilo/deuna_challenge/application/logger"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/defines"
+	"net/url"
+	"slices"
+)
+
+// WebhookEvents are the events a merchant can subscribe to
+var WebhookEvents = []string{
+	defines.PAYMENT_APPROVED_EVENT,
+	defines.PAYMENT_REJECTED_EVENT,
+	defines.PAYMENT_REFUNDED_EVENT,
+	defines.PAYMENT_REVERSED_EVENT,
+	defines.PAYMENT_AUTHORIZED_EVENT,
+	defines.PAYMENT_CANCELLED_EVENT,
+}
+
+type WebhookEndpointRequest struct {
+	URL string `json:"url"`
+	// If no events are sent, then the endpoint is subscribed to every event
+	Events []string `json:"events"`
+}
+
+func (w *WebhookEndpointRequest) Validate(ctx *domain.ContextInformation) apierrors.ApiError {
+	u, err := url.ParseRequestURI(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		apierr := apierrors.NewBadRequestApiError("invalid webhook url")
+		logger.Error(apierr.Error(), "validate-webhook-url", apierr, ctx, map[string]any{"url": w.URL})
+		return apierr
+	}
+
+	if len(w.Events) == 0 {
+		w.Events = WebhookEvents
+		return nil
+	}
+
+	for _, event := range w.Events {
+		if !slices.Contains(WebhookEvents, event) {
+			apierr := apierrors.NewBadRequestApiError(fmt.Sprintf("invalid webhook event %s", event))
+			logger.Error(apierr.Error(), "validate-webhook-events", apierr, ctx, map[string]any{"event": event})
+			return apierr
+		}
+	}
+
+	return nil
+}
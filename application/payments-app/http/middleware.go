@@ -2,6 +2,8 @@ package http
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
@@ -10,13 +12,14 @@ import (
 	"github.com/negarciacamilo/deuna_challenge/application/context"
 	"github.com/negarciacamilo/deuna_challenge/application/defines"
 	"github.com/negarciacamilo/deuna_challenge/application/domain"
+	"github.com/negarciacamilo/deuna_challenge/application/idempotency"
 	"github.com/negarciacamilo/deuna_challenge/application/logger"
-	"github.com/negarciacamilo/deuna_challenge/application/payments-app/idempotency"
 	"github.com/negarciacamilo/deuna_challenge/application/response"
 	"github.com/spf13/viper"
 	"io"
 	"math/rand"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -41,8 +44,16 @@ func GenerateContext() gin.HandlerFunc {
 	}
 }
 
+// generateRequestInformation keeps the faults the bank simulator is asked for only with BANK_FAULTS_PASSTHROUGH on, any
+// caller could break the bank calls otherwise. The header is stripped when it's off
 func generateRequestInformation(r *http.Request) *domain.RequestInfo {
-	return &domain.RequestInfo{RequestID: getOrGenerateRequestID(r)}
+	info := &domain.RequestInfo{RequestID: getOrGenerateRequestID(r)}
+	if viper.GetBool("BANK_FAULTS_PASSTHROUGH") {
+		info.BankFaults = r.Header.Get(defines.BankFaults)
+	} else {
+		r.Header.Del(defines.BankFaults)
+	}
+	return info
 }
 
 func getOrGenerateRequestID(r *http.Request) string {
@@ -173,30 +184,144 @@ func logRequestHandler() gin.HandlerFunc {
 	}
 }
 
-func idempotencyKeyCheck() gin.HandlerFunc {
+// idempotencyKeyCheck works like Stripe's idempotency keys. The response of the first request with a key is stored
+// and replayed as it is for every retry, and a retry that arrives while the first request is still running gets a 409
+// so it can try again later. Only the requests that can change something are checked, reading is idempotent anyway.
+// The keys are scoped by client and route, and reusing one with a different body gets a 422
+func idempotencyKeyCheck(store idempotency.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		shouldCheck := !strings.Contains(c.Request.URL.Path, "/ping")
-		if h := c.GetHeader(defines.IdempotencyKey); h != "" && shouldCheck {
-			ikExists := idempotency.IdempotencyKeyExists(h)
-			if !ikExists {
-				// Then is the first time we see this request
-				ctx := context.GetContextInformation(c)
-				ctx.RequestInfo.IdempotencyKey = &h
-			} else {
-				// Maybe this is a duplicate request
-				apierr := apierrors.NewApiError("invalid request", "request might be duplicated", 409, nil)
+		shouldCheck := !strings.Contains(c.Request.URL.Path, "/ping") && c.Request.Method != http.MethodGet
+		if !shouldCheck {
+			c.Next()
+			return
+		}
+
+		ctx := context.GetContextInformation(c)
+		h := c.GetHeader(defines.IdempotencyKey)
+		if h == "" {
+			if viper.GetBool("IDEMPOTENCY_KEY_REQUIRED") {
+				apierr := apierrors.NewApiError(fmt.Sprintf("the %s header is required", defines.IdempotencyKey), "idempotency_key_required", http.StatusBadRequest, nil)
+				logger.Error(apierr.Message(), "idempotency-key-check", apierr, ctx)
 				c.AbortWithStatusJSON(apierr.Status(), apierr)
+				return
 			}
-		} else {
-			// Normally I would not do this, but just for making the people that are reviewing the challenge life easier
-			ctx := context.GetContextInformation(c)
-			randomKey, _ := uuid.NewV7()
-			r := randomKey.String()
-			ctx.RequestInfo.IdempotencyKey = &r
+
+			// The request is handled without any idempotency guarantee
+			c.Next()
+			return
+		}
+
+		ctx.RequestInfo.IdempotencyKey = &h
+		key := idempotency.Key(idempotencyClient(c, ctx), c.Request.Method, c.FullPath(), h)
+		tags := map[string]any{"idempotency_key": h}
+
+		reqBody, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			apierr := apierrors.NewBadRequestApiError("can't read the request body")
+			logger.Error(apierr.Message(), "idempotency-key-check", err, ctx, tags)
+			c.AbortWithStatusJSON(apierr.Status(), apierr)
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewBuffer(reqBody))
+		fingerprint := idempotency.Fingerprint(reqBody)
+
+		record, first, err := store.Begin(c, key, fingerprint, idempotency.InProgressTTL())
+		if err != nil {
+			apierr := apierrors.NewInternalServerApiError("can't check the idempotency key", err)
+			logger.Error(apierr.Message(), "idempotency-key-check", err, ctx, tags)
+			c.AbortWithStatusJSON(apierr.Status(), apierr)
+			return
+		}
+
+		if !first && record.Fingerprint != fingerprint {
+			apierr := apierrors.NewApiError("the idempotency key was already used with a different request body", "idempotency_key_mismatch", http.StatusUnprocessableEntity, nil)
+			logger.Error(apierr.Message(), "idempotency-key-check", apierr, ctx, tags)
+			c.AbortWithStatusJSON(apierr.Status(), apierr)
+			return
+		}
+
+		if !first {
+			if record.InProgress {
+				apierr := apierrors.NewApiError("a request with the same idempotency key is still being processed, retry later", "idempotency_key_in_use", http.StatusConflict, nil)
+				logger.Error(apierr.Message(), "idempotency-key-check", apierr, ctx, tags)
+				c.Header("Retry-After", "1")
+				c.AbortWithStatusJSON(apierr.Status(), apierr)
+				return
+			}
+
+			c.Header(defines.IdempotentReplayed, "true")
+			c.Keys[response.StatusKey] = record.Status
+			if len(record.Body) > 0 {
+				c.Keys[response.ResponseKey] = record.Body
+			}
+			c.Abort()
+			return
+		}
+
+		c.Next()
+
+		status, resp := getResponseFromContext(c)
+		if !shouldStoreResponse(status) {
+			releaseIdempotencyKey(c, store, key)
+			return
+		}
+
+		var body json.RawMessage
+		if resp != nil {
+			b, err := json.Marshal(resp)
+			if err != nil {
+				logger.Error("can't store the idempotent response", "idempotency-key-check", err, ctx, tags)
+				releaseIdempotencyKey(c, store, key)
+				return
+			}
+			body = b
+		}
+
+		// The response was already sent, if it can't be stored the retries are handled as new requests once the key
+		// in progress expires
+		ttl := idempotency.TTL(c.Request.Method, c.FullPath())
+		if err := store.Complete(c, key, &idempotency.Record{Fingerprint: fingerprint, Status: status, Body: body}, ttl); err != nil {
+			logger.Error("can't store the idempotent response", "idempotency-key-check", err, ctx, tags)
 		}
 	}
 }
 
+// idempotencyClient identifies who sent the request. Since the client id is made up on every request by the fake
+// authorization, the customers are told apart by a hash of their token
+func idempotencyClient(c *gin.Context, ctx *domain.ContextInformation) string {
+	user := ctx.RequestInfo.AuthenticatedUser
+	switch {
+	case user == nil:
+		return ""
+	case user.MerchantID != nil:
+		return fmt.Sprintf("merchant-%d", *user.MerchantID)
+	case user.Operator:
+		return "operator"
+	}
+
+	sum := sha256.Sum256([]byte(c.GetHeader(defines.Authorization)))
+	return "client-" + hex.EncodeToString(sum[:8])
+}
+
+func releaseIdempotencyKey(c *gin.Context, store idempotency.Store, key string) {
+	if err := store.Release(c, key); err != nil {
+		logger.Error("can't release the idempotency key", "idempotency-key-check", err, context.GetContextInformation(c), map[string]any{"idempotency_key": key})
+	}
+}
+
+// shouldStoreResponse tells if a response is replayed. Unlike Stripe, server errors aren't stored since nothing is
+// charged when they happen, so retrying them is safe and the retry might succeed. Neither are the requests that weren't
+// authorized, they were never handled
+func shouldStoreResponse(status int) bool {
+	switch {
+	case status == 0, status >= http.StatusInternalServerError:
+		return false
+	case status == http.StatusUnauthorized, status == http.StatusForbidden:
+		return false
+	}
+	return true
+}
+
 func AuthorizeClient() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		shouldCheck := !strings.Contains(c.Request.URL.Path, "/ping")
@@ -225,6 +350,25 @@ func AuthorizeClient() gin.HandlerFunc {
 		}
 
 		ctx.RequestInfo.AuthenticatedUser = &domain.AuthenticatedUser{ClientID: uint64(rand.Int63n(10))}
+		if merchantID, ok := parseMerchantToken(authHeader); ok {
+			ctx.RequestInfo.AuthenticatedUser.MerchantID = &merchantID
+		}
+		// As fake as the merchant one, the staff uses an "operator" token
+		ctx.RequestInfo.AuthenticatedUser.Operator = authHeader == "operator"
 		c.Next()
 	}
 }
+
+// parseMerchantToken is as fake as the token validation, a merchant is identified by a "merchant-{merchant_id}" token
+func parseMerchantToken(token string) (uint64, bool) {
+	id, found := strings.CutPrefix(token, "merchant-")
+	if !found {
+		return 0, false
+	}
+
+	merchantID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil || merchantID == 0 {
+		return 0, false
+	}
+	return merchantID, true
+}
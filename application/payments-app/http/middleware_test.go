@@ -0,0 +1,148 @@
+package http
+
+import (
+	"bytes"
+	stdcontext "context"
+	"github.com/gin-gonic/gin"
+	"github.com/negarciacamilo/deuna_challenge/application/context"
+	"github.com/negarciacamilo/deuna_challenge/application/defines"
+	"github.com/negarciacamilo/deuna_challenge/application/idempotency"
+	"github.com/negarciacamilo/deuna_challenge/application/response"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// idempotentRouter has the middlewares of the payments app in the same order, and handlers that count how many times
+// they ran
+func idempotentRouter(store idempotency.Store, calls *int) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(logRequestHandler())
+	router.Use(GenerateContext())
+	router.Use(AuthorizeClient())
+	router.Use(idempotencyKeyCheck(store))
+
+	handler := func(c *gin.Context) {
+		*calls++
+		response.Respond(context.GetContextInformation(c), response.New(http.StatusCreated, map[string]int{"call": *calls}), nil)
+	}
+	router.POST("/payments", handler)
+	router.POST("/payments/:payment_id/refunds", handler)
+	return router
+}
+
+func idempotentRequest(router *gin.Engine, path, token, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+	req.Header.Set(defines.Authorization, token)
+	if key != "" {
+		req.Header.Set(defines.IdempotencyKey, key)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotencyKeyCheck(t *testing.T) {
+	viper.Set("AUTH_TOKEN_IS_VALID", true)
+	viper.Set("IDEMPOTENCY_KEY_REQUIRED", false)
+	t.Cleanup(func() {
+		viper.Set("IDEMPOTENCY_KEY_REQUIRED", false)
+	})
+
+	t.Run("A retry gets the stored response back", func(t *testing.T) {
+		var calls int
+		router := idempotentRouter(idempotency.NewMemoryStore(), &calls)
+
+		first := idempotentRequest(router, "/payments", "merchant-3", "key", `{"amount":"10"}`)
+		require.Equal(t, http.StatusCreated, first.Code)
+		require.Empty(t, first.Header().Get(defines.IdempotentReplayed))
+
+		retry := idempotentRequest(router, "/payments", "merchant-3", "key", `{"amount":"10"}`)
+		require.Equal(t, http.StatusCreated, retry.Code)
+		require.Equal(t, "true", retry.Header().Get(defines.IdempotentReplayed))
+		require.JSONEq(t, first.Body.String(), retry.Body.String())
+		require.Equal(t, 1, calls)
+	})
+
+	t.Run("The keys are scoped by client and route", func(t *testing.T) {
+		var calls int
+		router := idempotentRouter(idempotency.NewMemoryStore(), &calls)
+
+		require.Equal(t, http.StatusCreated, idempotentRequest(router, "/payments", "merchant-3", "key", `{}`).Code)
+		other := idempotentRequest(router, "/payments", "merchant-4", "key", `{}`)
+		require.Equal(t, http.StatusCreated, other.Code)
+		require.Empty(t, other.Header().Get(defines.IdempotentReplayed))
+
+		refund := idempotentRequest(router, "/payments/1/refunds", "merchant-3", "key", `{}`)
+		require.Equal(t, http.StatusCreated, refund.Code)
+		require.Empty(t, refund.Header().Get(defines.IdempotentReplayed))
+		require.Equal(t, 3, calls)
+	})
+
+	t.Run("A key reused with a different body", func(t *testing.T) {
+		var calls int
+		router := idempotentRouter(idempotency.NewMemoryStore(), &calls)
+
+		require.Equal(t, http.StatusCreated, idempotentRequest(router, "/payments", "merchant-3", "key", `{"amount":"10"}`).Code)
+		w := idempotentRequest(router, "/payments", "merchant-3", "key", `{"amount":"20"}`)
+		require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		require.Contains(t, w.Body.String(), "idempotency_key_mismatch")
+		require.Equal(t, 1, calls)
+	})
+
+	t.Run("A retry while the first request is running", func(t *testing.T) {
+		var calls int
+		store := idempotency.NewMemoryStore()
+		router := idempotentRouter(store, &calls)
+
+		body := `{"amount":"10"}`
+		key := idempotency.Key("merchant-3", http.MethodPost, "/payments", "key")
+		_, first, err := store.Begin(stdcontext.Background(), key, idempotency.Fingerprint([]byte(body)), time.Minute)
+		require.NoError(t, err)
+		require.True(t, first)
+
+		w := idempotentRequest(router, "/payments", "merchant-3", "key", body)
+		require.Equal(t, http.StatusConflict, w.Code)
+		require.Contains(t, w.Body.String(), "idempotency_key_in_use")
+		require.Equal(t, "1", w.Header().Get("Retry-After"))
+		require.Equal(t, 0, calls)
+	})
+
+	t.Run("The key is required", func(t *testing.T) {
+		var calls int
+		router := idempotentRouter(idempotency.NewMemoryStore(), &calls)
+
+		require.Equal(t, http.StatusCreated, idempotentRequest(router, "/payments", "merchant-3", "", `{}`).Code)
+
+		viper.Set("IDEMPOTENCY_KEY_REQUIRED", true)
+		w := idempotentRequest(router, "/payments", "merchant-3", "", `{}`)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		require.Contains(t, w.Body.String(), "idempotency_key_required")
+		require.Equal(t, 1, calls)
+	})
+}
+
+func TestBankFaultsPassthrough(t *testing.T) {
+	t.Cleanup(func() {
+		viper.Set("BANK_FAULTS_PASSTHROUGH", false)
+	})
+
+	for _, passthrough := range []bool{false, true} {
+		viper.Set("BANK_FAULTS_PASSTHROUGH", passthrough)
+		req := httptest.NewRequest(http.MethodPost, "/payments", nil)
+		req.Header.Set(defines.BankFaults, `{"*": {"error_rate": 1}}`)
+
+		info := generateRequestInformation(req)
+		if passthrough {
+			require.Equal(t, `{"*": {"error_rate": 1}}`, info.BankFaults)
+		} else {
+			require.Empty(t, info.BankFaults)
+			require.Empty(t, req.Header.Get(defines.BankFaults))
+		}
+	}
+}
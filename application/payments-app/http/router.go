@@ -6,9 +6,15 @@ import (
 	"github.com/go-resty/resty/v2"
 	"github.com/negarciacamilo/deuna_challenge/application/context"
 	"github.com/negarciacamilo/deuna_challenge/application/payments-app/bank"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/code"
 	"github.com/negarciacamilo/deuna_challenge/application/payments-app/database"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/idempotency"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/outbox"
 	"github.com/negarciacamilo/deuna_challenge/application/payments-app/payment"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/reversal"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/webhook"
 	"github.com/negarciacamilo/deuna_challenge/application/response"
+	"github.com/spf13/viper"
 	"net/http"
 )
 
@@ -20,27 +26,61 @@ func NewRouter() *gin.Engine {
 	router.Use(logRequestHandler())
 	router.Use(GenerateContext())
 	router.NoRoute(noRouteHandler)
-	router.Use(idempotencyKeyCheck())
+
+	db := database.New()
 	router.Use(AuthorizeClient())
-	mapRoutes(router)
+	// After the authorization, since the keys are scoped by client
+	router.Use(idempotencyKeyCheck(idempotency.NewStore(db)))
+	mapRoutes(router, db)
 	return router
 }
 
-func mapRoutes(router *gin.Engine) {
-	db := database.New()
+func mapRoutes(router *gin.Engine, db database.Database) {
 	httpClient := resty.New()
 
 	paymentsRepo := payment.NewRepository(db)
-	bankRepo := bank.NewRepository(httpClient)
+	banks := bank.NewRegistry(httpClient)
+	bankHandler := bank.NewHandler(banks)
+	codeHandler := code.NewHandler()
 
-	paymentsService := payment.NewService(bankRepo, paymentsRepo)
+	paymentsService := payment.NewService(banks, paymentsRepo)
 	paymentsHandler := payment.NewHandler(paymentsService)
 
+	webhookRepo := webhook.NewRepository(db)
+	webhookService := webhook.NewService(resty.New().SetTimeout(viper.GetDuration("WEBHOOK_TIMEOUT")), webhookRepo)
+	webhookHandler := webhook.NewHandler(webhookService)
+
+	reversalService := reversal.NewService(banks, reversal.NewRepository(db))
+	reversalHandler := reversal.NewHandler(reversalService)
+
+	outboxRelay := outbox.NewRelay(outbox.NewRepository(db), outbox.NewSink())
+
+	go payment.StartAuthorizationExpirer(paymentsService, viper.GetDuration("AUTHORIZATION_EXPIRER_INTERVAL"))
+	go payment.StartPendingPaymentSweeper(paymentsService, viper.GetDuration("PENDING_SWEEPER_INTERVAL"))
+	go webhook.StartDispatcher(webhookService, viper.GetDuration("WEBHOOK_DISPATCH_INTERVAL"))
+	go reversal.StartRetrier(reversalService, viper.GetDuration("REVERSAL_RETRY_INTERVAL"))
+	go outbox.StartRelay(outboxRelay, viper.GetDuration("OUTBOX_RELAY_INTERVAL"))
+
 	router.POST("/pay", paymentsHandler.Pay)
 	router.GET("/payments/:payment_id", paymentsHandler.GetPaymentByID)
 	router.GET("/customers/:customer_id/payments", paymentsHandler.GetCustomerPayments)
 	router.GET("/payments", paymentsHandler.GetAllPayments)
+	router.GET("/merchants/:merchant_id/payments", paymentsHandler.GetMerchantPayments)
+	router.GET("/merchants/:merchant_id/summary", paymentsHandler.GetMerchantSummary)
 	router.PUT("/payments/:payment_id/refund", paymentsHandler.RefundPaymentByID)
+	router.POST("/payments/:payment_id/capture", paymentsHandler.CapturePaymentByID)
+	router.POST("/payments/:payment_id/void", paymentsHandler.VoidPaymentByID)
+	router.GET("/payments/:payment_id/timeline", paymentsHandler.GetPaymentTimeline)
+	router.POST("/merchants/:merchant_id/webhooks", webhookHandler.CreateEndpoint)
+	router.GET("/merchants/:merchant_id/webhooks", webhookHandler.GetEndpoints)
+	router.DELETE("/merchants/:merchant_id/webhooks/:webhook_id", webhookHandler.DeleteEndpoint)
+	router.GET("/merchants/:merchant_id/webhooks/deliveries", webhookHandler.GetDeliveries)
+	router.POST("/merchants/:merchant_id/webhooks/deliveries/:delivery_id/redeliver", webhookHandler.Redeliver)
+	router.GET("/reversals", reversalHandler.GetReversals)
+	router.POST("/reversals/:reversal_id/retry", reversalHandler.RetryReversal)
+	router.GET("/banks/breakers", bankHandler.GetBreakers)
+	router.GET("/codes", codeHandler.GetCodes)
+	router.GET("/codes/:code", codeHandler.GetCode)
 	router.GET("/ping", ping)
 }
 
@@ -0,0 +1,73 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	dbd "github.com/negarciacamilo/deuna_challenge/application/domain/database"
+	"github.com/negarciacamilo/deuna_challenge/application/idempotency"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/database"
+	"time"
+)
+
+type postgresStore struct {
+	db database.Database
+}
+
+// NewPostgresStore returns a store that keeps the keys in the idempotency_keys table
+func NewPostgresStore(db database.Database) idempotency.Store {
+	return &postgresStore{db: db}
+}
+
+func (p *postgresStore) Begin(ctx context.Context, key, fingerprint string, inProgressTTL time.Duration) (*idempotency.Record, bool, error) {
+	now := time.Now().UTC()
+	row := &dbd.IdempotencyKey{Key: key, InProgress: true, Fingerprint: fingerprint, ExpiresAt: now.Add(inProgressTTL), CreatedAt: now}
+
+	// The primary key makes it atomic, the key is only taken if it's new or has expired
+	res, err := p.db.GetDB().NewInsert().Model(row).
+		On("CONFLICT (key) DO UPDATE").
+		Set("in_progress = EXCLUDED.in_progress").
+		Set("fingerprint = EXCLUDED.fingerprint").
+		Set("status = EXCLUDED.status").
+		Set("body = EXCLUDED.body").
+		Set("expires_at = EXCLUDED.expires_at").
+		Set("created_at = EXCLUDED.created_at").
+		Where("idempotency_key.expires_at <= ?", now).
+		Exec(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if affected, _ := res.RowsAffected(); affected > 0 {
+		return nil, true, nil
+	}
+
+	var stored dbd.IdempotencyKey
+	err = p.db.GetDB().NewSelect().Model(&stored).Where("key = ?", key).Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		// It was released in the meantime
+		return p.Begin(ctx, key, fingerprint, inProgressTTL)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &idempotency.Record{InProgress: stored.InProgress, Fingerprint: stored.Fingerprint, Status: stored.Status, Body: stored.Body}, false, nil
+}
+
+func (p *postgresStore) Complete(ctx context.Context, key string, record *idempotency.Record, ttl time.Duration) error {
+	_, err := p.db.GetDB().NewUpdate().Model((*dbd.IdempotencyKey)(nil)).
+		Set("in_progress = ?", false).
+		Set("fingerprint = ?", record.Fingerprint).
+		Set("status = ?", record.Status).
+		Set("body = ?", []byte(record.Body)).
+		Set("expires_at = ?", time.Now().UTC().Add(ttl)).
+		Where("key = ?", key).
+		Exec(ctx)
+	return err
+}
+
+func (p *postgresStore) Release(ctx context.Context, key string) error {
+	_, err := p.db.GetDB().NewDelete().Model((*dbd.IdempotencyKey)(nil)).Where("key = ?", key).Exec(ctx)
+	return err
+}
@@ -0,0 +1,26 @@
+package idempotency
+
+import (
+	"github.com/negarciacamilo/deuna_challenge/application/idempotency"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/database"
+	"github.com/spf13/viper"
+)
+
+const (
+	MemoryStore   = "memory"
+	PostgresStore = "postgres"
+	RedisStore    = "redis"
+)
+
+// NewStore returns the store set in IDEMPOTENCY_STORE. The in-memory one is the default, keep in mind that it's
+// neither shared between replicas nor survives a restart
+func NewStore(db database.Database) idempotency.Store {
+	switch viper.GetString("IDEMPOTENCY_STORE") {
+	case PostgresStore:
+		return NewPostgresStore(db)
+	case RedisStore:
+		return idempotency.NewRedisStore(viper.GetString("IDEMPOTENCY_REDIS_ADDR"))
+	default:
+		return idempotency.NewMemoryStore()
+	}
+}
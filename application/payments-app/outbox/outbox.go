@@ -0,0 +1,33 @@
+package outbox
+
+import (
+	"context"
+	dbd "github.com/negarciacamilo/deuna_challenge/application/domain/database"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/defines"
+	"github.com/uptrace/bun"
+)
+
+// Record writes the outbox event of a status change. It must be called within the transaction that stores the
+// change, that's what makes the relay never miss an event nor publish one that didn't happen
+func Record(c context.Context, tx bun.IDB, payment *dbd.Payment, history *dbd.PaymentStatusHistory) error {
+	eventType := defines.PAYMENT_STATUS_CHANGED_EVENT
+	if history.FromStatus == nil {
+		eventType = defines.PAYMENT_CREATED_EVENT
+	}
+
+	event := &dbd.OutboxEvent{
+		AggregateID: payment.ID,
+		Type:        eventType,
+		Payload: &dbd.PaymentEvent{
+			PaymentID:  payment.ID,
+			FromStatus: history.FromStatus,
+			ToStatus:   history.ToStatus,
+			Actor:      history.Actor,
+			Reason:     history.Reason,
+			Payment:    payment,
+		},
+	}
+
+	_, err := tx.NewInsert().Model(event).Exec(c)
+	return err
+}
@@ -0,0 +1,72 @@
+package outbox
+
+import (
+	"github.com/negarciacamilo/deuna_challenge/application/apierrors"
+	d "github.com/negarciacamilo/deuna_challenge/application/domain"
+	"github.com/negarciacamilo/deuna_challenge/application/logger"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/worker"
+	"time"
+)
+
+// How many events are read on every run
+const relayBatchSize = 100
+
+type Relay interface {
+	RelayPendingEvents(ctx *d.ContextInformation) apierrors.ApiError
+}
+
+type relay struct {
+	outboxRepository Repository
+	sink             Sink
+}
+
+func NewRelay(outboxRepository Repository, sink Sink) Relay {
+	return &relay{
+		outboxRepository: outboxRepository,
+		sink:             sink,
+	}
+}
+
+// RelayPendingEvents publishes the unpublished events in the order they were written. When an event can't be published
+// the following events of the same payment are held back until the next run, so every payment's events keep their
+// order while the rest of the payments aren't blocked by it
+func (r *relay) RelayPendingEvents(ctx *d.ContextInformation) apierrors.ApiError {
+	return r.outboxRepository.WithRelayLock(ctx, func() apierrors.ApiError {
+		events, apierr := r.outboxRepository.GetUnpublishedEvents(ctx, relayBatchSize)
+		if apierr != nil {
+			return apierr
+		}
+
+		held := make(map[uint64]bool)
+		published := make([]uint64, 0, len(*events))
+		for i := range *events {
+			event := &(*events)[i]
+			if held[event.AggregateID] {
+				continue
+			}
+
+			if err := r.sink.Publish(ctx, event); err != nil {
+				held[event.AggregateID] = true
+				logger.Error("error publishing outbox event", "outbox-relay", err, ctx, map[string]any{"event_id": event.ID, "payment_id": event.AggregateID})
+				if apierr = r.outboxRepository.MarkFailed(ctx, event.ID, err.Error()); apierr != nil {
+					return apierr
+				}
+				continue
+			}
+
+			published = append(published, event.ID)
+		}
+
+		// If this fails the events are published again on the next run, which is fine for an at least once delivery
+		return r.outboxRepository.MarkPublished(ctx, published, time.Now().UTC())
+	})
+}
+
+// StartRelay periodically publishes the outbox events
+func StartRelay(relay Relay, interval time.Duration) {
+	worker.Every(interval, time.Second, func(ctx *d.ContextInformation) {
+		if apierr := relay.RelayPendingEvents(ctx); apierr != nil {
+			logger.Error("error relaying outbox events", "outbox-relay", apierr, ctx)
+		}
+	})
+}
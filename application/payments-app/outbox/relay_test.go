@@ -0,0 +1,76 @@
+package outbox
+
+import (
+	"github.com/negarciacamilo/deuna_challenge/application/apierrors"
+	d "github.com/negarciacamilo/deuna_challenge/application/domain"
+	"github.com/negarciacamilo/deuna_challenge/application/domain/database"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func event(id, paymentID uint64) database.OutboxEvent {
+	return database.OutboxEvent{Base: database.Base{ID: id}, AggregateID: paymentID}
+}
+
+func TestRelayPendingEvents(t *testing.T) {
+	tests := []struct {
+		name              string
+		events            []database.OutboxEvent
+		failing           map[uint64]bool
+		expectedPublished []uint64
+		expectedFailed    []uint64
+	}{
+		{
+			name:              "Every event is published in order",
+			events:            []database.OutboxEvent{event(1, 10), event(2, 20), event(3, 10)},
+			expectedPublished: []uint64{1, 2, 3},
+		},
+		{
+			name:              "A failed event holds back the next events of its payment",
+			events:            []database.OutboxEvent{event(1, 10), event(2, 20), event(3, 10), event(4, 20)},
+			failing:           map[uint64]bool{1: true},
+			expectedPublished: []uint64{2, 4},
+			expectedFailed:    []uint64{1},
+		},
+		{
+			name:              "Nothing to publish",
+			events:            []database.OutboxEvent{},
+			expectedPublished: []uint64{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := NewChannelSink(len(tt.events))
+			sink.Fail = func(e *database.OutboxEvent) bool { return tt.failing[e.ID] }
+
+			repoMock := new(RepositoryMock)
+			repoMock.On("GetUnpublishedEvents", mock.Anything, relayBatchSize).Return(&tt.events, nil)
+			repoMock.On("MarkPublished", mock.Anything, tt.expectedPublished, mock.Anything).Return(nil)
+			for _, id := range tt.expectedFailed {
+				repoMock.On("MarkFailed", mock.Anything, id, mock.Anything).Return(nil)
+			}
+
+			apierr := NewRelay(repoMock, sink).RelayPendingEvents(d.BackgroundContext())
+			require.Nil(t, apierr)
+			repoMock.AssertExpectations(t)
+
+			close(sink.Events)
+			published := make([]uint64, 0)
+			for e := range sink.Events {
+				published = append(published, e.ID)
+			}
+			require.Equal(t, tt.expectedPublished, published)
+		})
+	}
+}
+
+func TestRelayPendingEventsRepositoryError(t *testing.T) {
+	repoMock := new(RepositoryMock)
+	repoMock.On("GetUnpublishedEvents", mock.Anything, relayBatchSize).Return(nil, apierrors.NewInternalServerApiError("error fetching outbox_events", nil))
+
+	apierr := NewRelay(repoMock, NewChannelSink(1)).RelayPendingEvents(d.BackgroundContext())
+	require.NotNil(t, apierr)
+	repoMock.AssertNotCalled(t, "MarkPublished", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,98 @@
+package outbox
+
+import (
+	"context"
+	"github.com/negarciacamilo/deuna_challenge/application/apierrors"
+	d "github.com/negarciacamilo/deuna_challenge/application/domain"
+	dbd "github.com/negarciacamilo/deuna_challenge/application/domain/database"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/database"
+	"github.com/uptrace/bun"
+	"time"
+)
+
+// Any number that's unique among the advisory locks of the application
+const relayLockKey = 8_009_001
+
+type Repository interface {
+	WithRelayLock(ctx *d.ContextInformation, fn func() apierrors.ApiError) apierrors.ApiError
+	GetUnpublishedEvents(ctx *d.ContextInformation, limit int) (*[]dbd.OutboxEvent, apierrors.ApiError)
+	MarkPublished(ctx *d.ContextInformation, ids []uint64, publishedAt time.Time) apierrors.ApiError
+	MarkFailed(ctx *d.ContextInformation, id uint64, lastError string) apierrors.ApiError
+}
+
+type repository struct {
+	db database.Database
+}
+
+func NewRepository(db database.Database) Repository {
+	return &repository{
+		db: db,
+	}
+}
+
+// WithRelayLock runs fn only if no other relay is running, so the events of a payment are never published by two
+// instances at the same time and out of order. If the lock is taken fn is skipped
+func (r *repository) WithRelayLock(ctx *d.ContextInformation, fn func() apierrors.ApiError) apierrors.ApiError {
+	// The lock belongs to the transaction, so it's released when it ends whatever happens to fn or the connection
+	err := r.db.GetDB().RunInTx(ctx.GetCtx(), nil, func(c context.Context, tx bun.Tx) error {
+		var locked bool
+		if err := tx.NewRaw("SELECT pg_try_advisory_xact_lock(?)", relayLockKey).Scan(c, &locked); err != nil {
+			return err
+		}
+
+		if !locked {
+			return nil
+		}
+
+		if apierr := fn(); apierr != nil {
+			return apierr
+		}
+		return nil
+	})
+	if err != nil {
+		return r.db.HandleDBError(ctx, "outbox_events", database.Fetching, err)
+	}
+
+	return nil
+}
+
+func (r *repository) GetUnpublishedEvents(ctx *d.ContextInformation, limit int) (*[]dbd.OutboxEvent, apierrors.ApiError) {
+	events := make([]dbd.OutboxEvent, 0, limit)
+	err := r.db.GetDB().NewSelect().Model(&events).
+		Where("published_at IS NULL").
+		Order("id ASC").
+		Limit(limit).Scan(ctx.GetCtx())
+	if err != nil {
+		return nil, r.db.HandleDBError(ctx, "outbox_events", database.Fetching, err)
+	}
+
+	return &events, nil
+}
+
+func (r *repository) MarkPublished(ctx *d.ContextInformation, ids []uint64, publishedAt time.Time) apierrors.ApiError {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	_, err := r.db.GetDB().NewUpdate().Model((*dbd.OutboxEvent)(nil)).
+		Set("published_at = ?", publishedAt).
+		Set("attempts = attempts + 1").
+		Where("id IN (?)", bun.In(ids)).Exec(ctx.GetCtx())
+	if err != nil {
+		return r.db.HandleDBError(ctx, "outbox_events", database.Updating, err)
+	}
+
+	return nil
+}
+
+func (r *repository) MarkFailed(ctx *d.ContextInformation, id uint64, lastError string) apierrors.ApiError {
+	_, err := r.db.GetDB().NewUpdate().Model((*dbd.OutboxEvent)(nil)).
+		Set("attempts = attempts + 1").
+		Set("last_error = ?", lastError).
+		Where("id = ?", id).Exec(ctx.GetCtx())
+	if err != nil {
+		return r.db.HandleDBError(ctx, "outbox_events", database.Updating, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package outbox
+
+import (
+	"github.com/negarciacamilo/deuna_challenge/application/apierrors"
+	d "github.com/negarciacamilo/deuna_challenge/application/domain"
+	"github.com/negarciacamilo/deuna_challenge/application/domain/database"
+	"github.com/stretchr/testify/mock"
+	"time"
+)
+
+type RepositoryMock struct {
+	mock.Mock
+}
+
+// WithRelayLock always gets the lock, so fn is run
+func (r *RepositoryMock) WithRelayLock(ctx *d.ContextInformation, fn func() apierrors.ApiError) apierrors.ApiError {
+	return fn()
+}
+
+func (r *RepositoryMock) GetUnpublishedEvents(ctx *d.ContextInformation, limit int) (*[]database.OutboxEvent, apierrors.ApiError) {
+	args := r.Called(ctx, limit)
+	err := args.Get(1)
+	if err != nil {
+		return nil, err.(apierrors.ApiError)
+	}
+	return args.Get(0).(*[]database.OutboxEvent), nil
+}
+
+func (r *RepositoryMock) MarkPublished(ctx *d.ContextInformation, ids []uint64, publishedAt time.Time) apierrors.ApiError {
+	args := r.Called(ctx, ids, publishedAt)
+	err := args.Get(0)
+	if err != nil {
+		return err.(apierrors.ApiError)
+	}
+	return nil
+}
+
+func (r *RepositoryMock) MarkFailed(ctx *d.ContextInformation, id uint64, lastError string) apierrors.ApiError {
+	args := r.Called(ctx, id, lastError)
+	err := args.Get(0)
+	if err != nil {
+		return err.(apierrors.ApiError)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package outbox
+
+import (
+	"fmt"
+	"github.com/go-resty/resty/v2"
+	"github.com/negarciacamilo/deuna_challenge/application/defines"
+	d "github.com/negarciacamilo/deuna_challenge/application/domain"
+	dbd "github.com/negarciacamilo/deuna_challenge/application/domain/database"
+	"github.com/negarciacamilo/deuna_challenge/application/logger"
+	pdefines "github.com/negarciacamilo/deuna_challenge/application/payments-app/defines"
+	"github.com/spf13/viper"
+	"strconv"
+)
+
+// Sink is where the relay publishes the outbox events. Delivery is at least once, so an event can be published more
+// than once and the consumers should deduplicate them by id
+type Sink interface {
+	Publish(ctx *d.ContextInformation, event *dbd.OutboxEvent) error
+}
+
+// NewSink returns the sink set in the OUTBOX_SINK config, the log sink is the default one
+func NewSink() Sink {
+	switch viper.GetString("OUTBOX_SINK") {
+	case pdefines.HTTP_SINK:
+		return NewHTTPSink(resty.New().SetTimeout(viper.GetDuration("OUTBOX_HTTP_SINK_TIMEOUT")), viper.GetString("OUTBOX_HTTP_SINK_URL"))
+	default:
+		return NewLogSink()
+	}
+}
+
+type logSink struct{}
+
+// NewLogSink returns a sink that writes the events to the application log
+func NewLogSink() Sink {
+	return &logSink{}
+}
+
+func (l *logSink) Publish(ctx *d.ContextInformation, event *dbd.OutboxEvent) error {
+	logger.Info("payment event", "outbox-log-sink", ctx, map[string]any{"event_id": event.ID, "type": event.Type, "payment_id": event.AggregateID, "payload": event.Payload})
+	return nil
+}
+
+type httpSink struct {
+	httpClient *resty.Client
+	url        string
+}
+
+// NewHTTPSink returns a sink that posts every event to the url, any answer that's not a 2xx is a failure
+func NewHTTPSink(httpClient *resty.Client, url string) Sink {
+	return &httpSink{
+		httpClient: httpClient,
+		url:        url,
+	}
+}
+
+func (h *httpSink) Publish(ctx *d.ContextInformation, event *dbd.OutboxEvent) error {
+	res, err := h.httpClient.R().
+		SetContext(ctx.GetCtx()).
+		SetHeader(defines.OutboxEventID, strconv.FormatUint(event.ID, 10)).
+		SetBody(event).
+		Post(h.url)
+	if err != nil {
+		return err
+	}
+
+	if res.IsError() {
+		return fmt.Errorf("the sink answered with status %d", res.StatusCode())
+	}
+
+	return nil
+}
+
+// ChannelSink sends the events to an in-process channel, it's meant to be used in tests. Publish blocks when the
+// channel is full
+type ChannelSink struct {
+	Events chan *dbd.OutboxEvent
+	// Fail makes Publish return an error for the matching events
+	Fail func(event *dbd.OutboxEvent) bool
+}
+
+func NewChannelSink(size int) *ChannelSink {
+	return &ChannelSink{Events: make(chan *dbd.OutboxEvent, size)}
+}
+
+func (c *ChannelSink) Publish(ctx *d.ContextInformation, event *dbd.OutboxEvent) error {
+	if c.Fail != nil && c.Fail(event) {
+		return fmt.Errorf("event %d rejected", event.ID)
+	}
+
+	c.Events <- event
+	return nil
+}
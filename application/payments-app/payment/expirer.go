@@ -0,0 +1,17 @@
+package payment
+
+import (
+	d "github.com/negarciacamilo/deuna_challenge/application/domain"
+	"github.com/negarciacamilo/deuna_challenge/application/logger"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/worker"
+	"time"
+)
+
+// StartAuthorizationExpirer periodically cancels the authorizations that weren't captured in time
+func StartAuthorizationExpirer(service Service, interval time.Duration) {
+	worker.Every(interval, time.Minute, func(ctx *d.ContextInformation) {
+		if apierr := service.ExpireAuthorizations(ctx); apierr != nil {
+			logger.Error("error expiring authorizations", "authorization-expirer", apierr, ctx)
+		}
+	})
+}
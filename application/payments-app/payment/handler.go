@@ -13,6 +13,11 @@ type Handler interface {
 	GetAllPayments(c *gin.Context)
 	GetCustomerPayments(c *gin.Context)
 	RefundPaymentByID(c *gin.Context)
+	CapturePaymentByID(c *gin.Context)
+	VoidPaymentByID(c *gin.Context)
+	GetPaymentTimeline(c *gin.Context)
+	GetMerchantPayments(c *gin.Context)
+	GetMerchantSummary(c *gin.Context)
 }
 
 type handler struct {
@@ -66,13 +71,25 @@ func (h *handler) GetCustomerPayments(c *gin.Context) {
 		return
 	}
 
-	p, apierr := h.service.GetCustomerPayments(ctx, customerID)
+	filter, apierr := domain.NewPaymentFilter(ctx)
+	if apierr != nil {
+		response.Respond(ctx, nil, apierr)
+		return
+	}
+
+	p, apierr := h.service.GetCustomerPayments(ctx, customerID, filter)
 	response.Respond(ctx, p, apierr)
 }
 
 func (h *handler) GetAllPayments(c *gin.Context) {
 	ctx := context.GetContextInformation(c)
-	p, apierr := h.service.GetAllPayments(ctx)
+	filter, apierr := domain.NewPaymentFilter(ctx)
+	if apierr != nil {
+		response.Respond(ctx, nil, apierr)
+		return
+	}
+
+	p, apierr := h.service.GetAllPayments(ctx, filter)
 	response.Respond(ctx, p, apierr)
 }
 
@@ -84,6 +101,104 @@ func (h *handler) RefundPaymentByID(c *gin.Context) {
 		return
 	}
 
-	res, apierr := h.service.RefundPayment(ctx, paymentID)
+	var refundRequest domain.RefundRequest
+	apierr = context.ShouldBindOptionalJSON(ctx, &refundRequest)
+	if apierr != nil {
+		response.Respond(ctx, nil, apierr)
+		return
+	}
+
+	apierr = refundRequest.Validate(ctx)
+	if apierr != nil {
+		response.Respond(ctx, nil, apierr)
+		return
+	}
+
+	res, apierr := h.service.RefundPayment(ctx, paymentID, refundRequest)
+	response.Respond(ctx, res, apierr)
+}
+
+func (h *handler) CapturePaymentByID(c *gin.Context) {
+	ctx := context.GetContextInformation(c)
+	paymentID, apierr := context.ParseParamToUInt(ctx, "payment_id")
+	if apierr != nil {
+		response.Respond(ctx, nil, apierr)
+		return
+	}
+
+	var captureRequest domain.CaptureRequest
+	apierr = context.ShouldBindOptionalJSON(ctx, &captureRequest)
+	if apierr != nil {
+		response.Respond(ctx, nil, apierr)
+		return
+	}
+
+	apierr = captureRequest.Validate(ctx)
+	if apierr != nil {
+		response.Respond(ctx, nil, apierr)
+		return
+	}
+
+	res, apierr := h.service.CapturePayment(ctx, paymentID, captureRequest)
+	response.Respond(ctx, res, apierr)
+}
+
+func (h *handler) VoidPaymentByID(c *gin.Context) {
+	ctx := context.GetContextInformation(c)
+	paymentID, apierr := context.ParseParamToUInt(ctx, "payment_id")
+	if apierr != nil {
+		response.Respond(ctx, nil, apierr)
+		return
+	}
+
+	res, apierr := h.service.VoidPayment(ctx, paymentID)
+	response.Respond(ctx, res, apierr)
+}
+
+func (h *handler) GetPaymentTimeline(c *gin.Context) {
+	ctx := context.GetContextInformation(c)
+	paymentID, apierr := context.ParseParamToUInt(ctx, "payment_id")
+	if apierr != nil {
+		response.Respond(ctx, nil, apierr)
+		return
+	}
+
+	res, apierr := h.service.GetPaymentTimeline(ctx, paymentID)
+	response.Respond(ctx, res, apierr)
+}
+
+func (h *handler) GetMerchantPayments(c *gin.Context) {
+	ctx := context.GetContextInformation(c)
+	merchantID, apierr := context.ParseMerchantParam(ctx, "merchant_id")
+	if apierr != nil {
+		response.Respond(ctx, nil, apierr)
+		return
+	}
+
+	filter, apierr := domain.NewPaymentFilter(ctx)
+	if apierr != nil {
+		response.Respond(ctx, nil, apierr)
+		return
+	}
+
+	p, apierr := h.service.GetMerchantPayments(ctx, merchantID, filter)
+	response.Respond(ctx, p, apierr)
+}
+
+func (h *handler) GetMerchantSummary(c *gin.Context) {
+	ctx := context.GetContextInformation(c)
+	merchantID, apierr := context.ParseMerchantParam(ctx, "merchant_id")
+	if apierr != nil {
+		response.Respond(ctx, nil, apierr)
+		return
+	}
+
+	filter, apierr := domain.NewPaymentFilter(ctx)
+	if apierr != nil {
+		response.Respond(ctx, nil, apierr)
+		return
+	}
+
+	res, apierr := h.service.GetMerchantSummary(ctx, merchantID, filter)
 	response.Respond(ctx, res, apierr)
 }
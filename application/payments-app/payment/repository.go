@@ -1,18 +1,38 @@
 package payment
 
 import (
+	"context"
+	"fmt"
 	"github.com/negarciacamilo/deuna_challenge/application/apierrors"
 	d "github.com/negarciacamilo/deuna_challenge/application/domain"
 	dbd "github.com/negarciacamilo/deuna_challenge/application/domain/database"
+	"github.com/negarciacamilo/deuna_challenge/application/money"
 	"github.com/negarciacamilo/deuna_challenge/application/payments-app/database"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/defines"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/domain"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/outbox"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/statemachine"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/webhook"
+	"github.com/uptrace/bun"
+	"time"
 )
 
 type Repository interface {
 	AddPayment(ctx *d.ContextInformation, payment *dbd.Payment) apierrors.ApiError
-	ChangePaymentStatus(ctx *d.ContextInformation, payment *dbd.Payment) apierrors.ApiError
-	GetAllPayments(ctx *d.ContextInformation) (*[]dbd.Payment, apierrors.ApiError)
+	ChangePaymentStatus(ctx *d.ContextInformation, payment *dbd.Payment, reason string) apierrors.ApiError
+	ReversePayment(ctx *d.ContextInformation, payment *dbd.Payment, reversal *dbd.Reversal, reason string) apierrors.ApiError
+	GetAllPayments(ctx *d.ContextInformation, filter domain.PaymentFilter) (*domain.PaymentsPage, apierrors.ApiError)
 	GetPaymentByID(ctx *d.ContextInformation, id uint64) (*dbd.Payment, apierrors.ApiError)
-	GetCustomerPayments(ctx *d.ContextInformation, id uint64) (*[]dbd.Payment, apierrors.ApiError)
+	GetCustomerPayments(ctx *d.ContextInformation, id uint64, filter domain.PaymentFilter) (*domain.PaymentsPage, apierrors.ApiError)
+	ReserveRefund(ctx *d.ContextInformation, payment *dbd.Payment, amount money.Amount) apierrors.ApiError
+	ReleaseRefund(ctx *d.ContextInformation, payment *dbd.Payment, amount money.Amount) apierrors.ApiError
+	AddRefund(ctx *d.ContextInformation, payment *dbd.Payment, refund *dbd.Refund) apierrors.ApiError
+	GetExpiredAuthorizations(ctx *d.ContextInformation, now time.Time) (*[]dbd.Payment, apierrors.ApiError)
+	GetStalePendingPayments(ctx *d.ContextInformation, createdBefore time.Time) (*[]dbd.Payment, apierrors.ApiError)
+	GetPaymentStatusHistory(ctx *d.ContextInformation, paymentID uint64) (*[]dbd.PaymentStatusHistory, apierrors.ApiError)
+	GetMerchantByID(ctx *d.ContextInformation, id uint64) (*dbd.Merchant, apierrors.ApiError)
+	GetMerchantPayments(ctx *d.ContextInformation, merchantID uint64, filter domain.PaymentFilter) (*domain.PaymentsPage, apierrors.ApiError)
+	GetMerchantSummary(ctx *d.ContextInformation, merchantID uint64, filter domain.PaymentFilter) (*[]domain.CurrencySummary, apierrors.ApiError)
 }
 
 type repository struct {
@@ -26,7 +46,17 @@ func NewRepository(db database.Database) Repository {
 }
 
 func (r *repository) AddPayment(ctx *d.ContextInformation, payment *dbd.Payment) apierrors.ApiError {
-	_, err := r.db.GetDB().NewInsert().Model(payment).Exec(ctx.GetCtx())
+	if apierr := statemachine.ValidateStart(payment.Status); apierr != nil {
+		return apierr
+	}
+
+	err := r.db.GetDB().RunInTx(ctx.GetCtx(), nil, func(c context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(payment).Exec(c); err != nil {
+			return err
+		}
+
+		return addStatusHistory(c, tx, ctx, payment, nil, "payment created")
+	})
 	if err != nil {
 		return r.db.HandleDBError(ctx, "payments", database.Creating, err)
 	}
@@ -34,29 +64,48 @@ func (r *repository) AddPayment(ctx *d.ContextInformation, payment *dbd.Payment)
 	return nil
 }
 
-func (r *repository) ChangePaymentStatus(ctx *d.ContextInformation, payment *dbd.Payment) apierrors.ApiError {
-	_, err := r.db.GetDB().NewUpdate().Model(payment).Where("id = ?", payment.ID).Exec(ctx.GetCtx())
+func (r *repository) ChangePaymentStatus(ctx *d.ContextInformation, payment *dbd.Payment, reason string) apierrors.ApiError {
+	err := r.db.GetDB().RunInTx(ctx.GetCtx(), nil, func(c context.Context, tx bun.Tx) error {
+		if err := transition(c, tx, ctx, payment, reason); err != nil {
+			return err
+		}
+
+		_, err := tx.NewUpdate().Model(payment).Where("id = ?", payment.ID).Exec(c)
+		return err
+	})
 	if err != nil {
 		return r.db.HandleDBError(ctx, "payments", database.Updating, err)
 	}
 	return nil
 }
 
-func (r *repository) GetAllPayments(ctx *d.ContextInformation) (*[]dbd.Payment, apierrors.ApiError) {
-	var payments []dbd.Payment
-	err := r.db.GetDB().NewSelect().Model(&payments).
-		Relation("Customer").
-		Relation("Merchant").
-		Relation("Bank").Scan(ctx.GetCtx())
-	if err != nil {
-		return nil, r.db.HandleDBError(ctx, "payments", database.Fetching, err)
-	}
+// ReversePayment stores the reversal status of the payment and, if the bank didn't confirm the reversal, queues it to
+// be retried in the same transaction
+func (r *repository) ReversePayment(ctx *d.ContextInformation, payment *dbd.Payment, reversal *dbd.Reversal, reason string) apierrors.ApiError {
+	err := r.db.GetDB().RunInTx(ctx.GetCtx(), nil, func(c context.Context, tx bun.Tx) error {
+		if err := transition(c, tx, ctx, payment, reason); err != nil {
+			return err
+		}
+
+		if _, err := tx.NewUpdate().Model(payment).Where("id = ?", payment.ID).Exec(c); err != nil {
+			return err
+		}
+
+		if reversal == nil {
+			return nil
+		}
 
-	if len(payments) == 0 {
-		return nil, apierrors.NewNotFoundApiError("no payments found")
+		_, err := tx.NewInsert().Model(reversal).Exec(c)
+		return err
+	})
+	if err != nil {
+		return r.db.HandleDBError(ctx, "payments", database.Updating, err)
 	}
+	return nil
+}
 
-	return &payments, nil
+func (r *repository) GetAllPayments(ctx *d.ContextInformation, filter domain.PaymentFilter) (*domain.PaymentsPage, apierrors.ApiError) {
+	return r.listPayments(ctx, filter)
 }
 
 func (r *repository) GetPaymentByID(ctx *d.ContextInformation, id uint64) (*dbd.Payment, apierrors.ApiError) {
@@ -64,7 +113,8 @@ func (r *repository) GetPaymentByID(ctx *d.ContextInformation, id uint64) (*dbd.
 	err := r.db.GetDB().NewSelect().Model(&payment).Where("?TableAlias.id = ?", id).
 		Relation("Customer").
 		Relation("Merchant").
-		Relation("Bank").Scan(ctx.GetCtx())
+		Relation("Bank").
+		Relation("Refunds").Scan(ctx.GetCtx())
 	if err != nil {
 		return nil, r.db.HandleDBError(ctx, "payment", database.Fetching, err)
 	}
@@ -72,20 +122,283 @@ func (r *repository) GetPaymentByID(ctx *d.ContextInformation, id uint64) (*dbd.
 	return &payment, nil
 }
 
-func (r *repository) GetCustomerPayments(ctx *d.ContextInformation, id uint64) (*[]dbd.Payment, apierrors.ApiError) {
-	var payments []dbd.Payment
-	err := r.db.GetDB().NewSelect().Model(&payments).
-		Where("customer_id = ?", id).
+func (r *repository) GetCustomerPayments(ctx *d.ContextInformation, id uint64, filter domain.PaymentFilter) (*domain.PaymentsPage, apierrors.ApiError) {
+	filter.CustomerID = &id
+	return r.listPayments(ctx, filter)
+}
+
+func (r *repository) GetMerchantPayments(ctx *d.ContextInformation, merchantID uint64, filter domain.PaymentFilter) (*domain.PaymentsPage, apierrors.ApiError) {
+	filter.MerchantID = &merchantID
+	return r.listPayments(ctx, filter)
+}
+
+func (r *repository) GetMerchantSummary(ctx *d.ContextInformation, merchantID uint64, filter domain.PaymentFilter) (*[]domain.CurrencySummary, apierrors.ApiError) {
+	filter.MerchantID = &merchantID
+	charged := bun.In([]int{defines.APPROVED_STATUS, defines.PARTIALLY_REFUNDED_STATUS, defines.REFUNDED_STATUS})
+
+	summaries := make([]domain.CurrencySummary, 0)
+	query := r.db.GetDB().NewSelect().Model((*dbd.Payment)(nil)).
+		ColumnExpr("payment.currency").
+		ColumnExpr("count(*) AS payments_count").
+		ColumnExpr("count(*) FILTER (WHERE payment.status IN (?)) AS approved_count", charged).
+		ColumnExpr("count(*) FILTER (WHERE payment.status = ?) AS rejected_count", defines.REJECTED_STATUS).
+		ColumnExpr("coalesce(sum(payment.amount) FILTER (WHERE payment.status IN (?)), 0) AS volume", charged).
+		ColumnExpr("coalesce(sum(payment.refunded_amount), 0) AS refunded_amount").
+		ColumnExpr("count(*) FILTER (WHERE payment.refunded_amount > 0) AS refunded_payments_count")
+
+	applyPaymentFilter(query, filter)
+
+	err := query.GroupExpr("payment.currency").OrderExpr("payment.currency").Scan(ctx.GetCtx(), &summaries)
+	if err != nil {
+		return nil, r.db.HandleDBError(ctx, "payments", database.Fetching, err)
+	}
+
+	return &summaries, nil
+}
+
+// listPayments returns a page of payments using keyset pagination over the sorted column and the id, so the cost of
+// fetching a page doesn't depend on how deep it is
+func (r *repository) listPayments(ctx *d.ContextInformation, filter domain.PaymentFilter) (*domain.PaymentsPage, apierrors.ApiError) {
+	payments := make([]dbd.Payment, 0, filter.Limit+1)
+	query := r.db.GetDB().NewSelect().Model(&payments).
 		Relation("Customer").
 		Relation("Merchant").
-		Relation("Bank").Scan(ctx.GetCtx())
+		Relation("Bank")
+
+	applyPaymentFilter(query, filter)
+
+	column := "payment.created_at"
+	if filter.SortBy == domain.SortByAmount {
+		column = "payment.amount"
+	}
+
+	if filter.After != nil {
+		operator := "<"
+		if filter.Order == domain.Ascending {
+			operator = ">"
+		}
+		query.Where(fmt.Sprintf("(%s, payment.id) %s (?, ?)", column, operator), filter.After.Value, filter.After.ID)
+	}
+
+	direction := "DESC"
+	if filter.Order == domain.Ascending {
+		direction = "ASC"
+	}
+
+	// One extra row tells if there's a next page
+	err := query.OrderExpr(fmt.Sprintf("%s %s, payment.id %s", column, direction, direction)).
+		Limit(filter.Limit + 1).Scan(ctx.GetCtx())
 	if err != nil {
 		return nil, r.db.HandleDBError(ctx, "payments", database.Fetching, err)
 	}
 
-	if len(payments) == 0 {
-		return nil, apierrors.NewNotFoundApiError("no payments found")
+	page := &domain.PaymentsPage{Data: payments, Limit: filter.Limit}
+	if len(payments) > filter.Limit {
+		page.Data = payments[:filter.Limit]
+		next := domain.NewCursor(&page.Data[filter.Limit-1], filter.SortBy).Encode()
+		page.NextCursor = &next
+	}
+
+	return page, nil
+}
+
+func applyPaymentFilter(query *bun.SelectQuery, filter domain.PaymentFilter) {
+	if len(filter.Statuses) > 0 {
+		query.Where("payment.status IN (?)", bun.In(filter.Statuses))
+	}
+
+	if filter.MerchantID != nil {
+		query.Where("payment.merchant_id = ?", *filter.MerchantID)
+	}
+
+	if filter.BankID != nil {
+		query.Where("payment.bank_id = ?", *filter.BankID)
+	}
+
+	if filter.CustomerID != nil {
+		query.Where("payment.customer_id = ?", *filter.CustomerID)
+	}
+
+	if filter.MinAmount != nil {
+		query.Where("payment.amount >= ?", *filter.MinAmount)
+	}
+
+	if filter.MaxAmount != nil {
+		query.Where("payment.amount <= ?", *filter.MaxAmount)
+	}
+
+	if filter.CreatedFrom != nil {
+		query.Where("payment.created_at >= ?", *filter.CreatedFrom)
+	}
+
+	if filter.CreatedBefore != nil {
+		query.Where("payment.created_at < ?", *filter.CreatedBefore)
+	} else if filter.CreatedTo != nil {
+		query.Where("payment.created_at <= ?", *filter.CreatedTo)
+	}
+}
+
+// ReserveRefund holds the amount of a refund before it's sent to the bank, so concurrent refunds can't refund more than
+// what's left of the payment between them. The check and the update are a single statement, so they can't interleave
+func (r *repository) ReserveRefund(ctx *d.ContextInformation, payment *dbd.Payment, amount money.Amount) apierrors.ApiError {
+	res, err := r.db.GetDB().NewUpdate().Model((*dbd.Payment)(nil)).
+		Set("refunding_amount = refunding_amount + ?", amount).
+		Where("id = ?", payment.ID).
+		Where("refunded_amount + refunding_amount + ? <= amount", amount).Exec(ctx.GetCtx())
+	if err != nil {
+		return r.db.HandleDBError(ctx, "payments", database.Updating, err)
+	}
+
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return apierrors.NewBadRequestApiError("refund amount exceeds the remaining balance of the payment")
+	}
+
+	payment.RefundingAmount += amount
+	return nil
+}
+
+// ReleaseRefund gives back the amount of a refund the bank didn't perform
+func (r *repository) ReleaseRefund(ctx *d.ContextInformation, payment *dbd.Payment, amount money.Amount) apierrors.ApiError {
+	_, err := r.db.GetDB().NewUpdate().Model((*dbd.Payment)(nil)).
+		Set("refunding_amount = refunding_amount - ?", amount).
+		Where("id = ?", payment.ID).Exec(ctx.GetCtx())
+	if err != nil {
+		return r.db.HandleDBError(ctx, "payments", database.Updating, err)
+	}
+
+	payment.RefundingAmount -= amount
+	return nil
+}
+
+// AddRefund moves the amount of a reserved refund to the refunded amount of the payment as it's stored, not as it was
+// read, so concurrent refunds don't overwrite each other. The status is set by what's left to refund
+func (r *repository) AddRefund(ctx *d.ContextInformation, payment *dbd.Payment, refund *dbd.Refund) apierrors.ApiError {
+	err := r.db.GetDB().RunInTx(ctx.GetCtx(), nil, func(c context.Context, tx bun.Tx) error {
+		var stored dbd.Payment
+		err := tx.NewSelect().Model(&stored).Column("amount", "refunded_amount", "refunding_amount").
+			Where("id = ?", payment.ID).For("UPDATE").Scan(c)
+		if err != nil {
+			return err
+		}
+
+		payment.RefundedAmount = stored.RefundedAmount + refund.Amount
+		payment.RefundingAmount = stored.RefundingAmount - refund.Amount
+		if payment.RefundedAmount < stored.Amount {
+			payment.Status = defines.PARTIALLY_REFUNDED_STATUS
+		} else {
+			payment.Status = defines.REFUNDED_STATUS
+		}
+
+		if err := transition(c, tx, ctx, payment, refund.Reason); err != nil {
+			return err
+		}
+
+		if _, err := tx.NewInsert().Model(refund).Exec(c); err != nil {
+			return err
+		}
+
+		_, err = tx.NewUpdate().Model(payment).
+			Column("refunded_amount", "refunding_amount", "status", "code").
+			Where("id = ?", payment.ID).Exec(c)
+		return err
+	})
+	if err != nil {
+		return r.db.HandleDBError(ctx, "refunds", database.Creating, err)
+	}
+
+	return nil
+}
+
+func (r *repository) GetExpiredAuthorizations(ctx *d.ContextInformation, now time.Time) (*[]dbd.Payment, apierrors.ApiError) {
+	var payments []dbd.Payment
+	err := r.db.GetDB().NewSelect().Model(&payments).
+		Where("status = ?", defines.AUTHORIZED_STATUS).
+		Where("authorization_expires_at < ?", now).Scan(ctx.GetCtx())
+	if err != nil {
+		return nil, r.db.HandleDBError(ctx, "payments", database.Fetching, err)
+	}
+
+	return &payments, nil
+}
+
+func (r *repository) GetStalePendingPayments(ctx *d.ContextInformation, createdBefore time.Time) (*[]dbd.Payment, apierrors.ApiError) {
+	var payments []dbd.Payment
+	err := r.db.GetDB().NewSelect().Model(&payments).
+		Where("status = ?", defines.PENDING_STATUS).
+		Where("created_at < ?", createdBefore).
+		Order("id ASC").
+		Limit(100).Scan(ctx.GetCtx())
+	if err != nil {
+		return nil, r.db.HandleDBError(ctx, "payments", database.Fetching, err)
 	}
 
 	return &payments, nil
 }
+
+func (r *repository) GetPaymentStatusHistory(ctx *d.ContextInformation, paymentID uint64) (*[]dbd.PaymentStatusHistory, apierrors.ApiError) {
+	var history []dbd.PaymentStatusHistory
+	err := r.db.GetDB().NewSelect().Model(&history).
+		Where("payment_id = ?", paymentID).
+		Order("created_at ASC", "id ASC").Scan(ctx.GetCtx())
+	if err != nil {
+		return nil, r.db.HandleDBError(ctx, "payment_status_history", database.Fetching, err)
+	}
+
+	return &history, nil
+}
+
+func (r *repository) GetMerchantByID(ctx *d.ContextInformation, id uint64) (*dbd.Merchant, apierrors.ApiError) {
+	var merchant dbd.Merchant
+	err := r.db.GetDB().NewSelect().Model(&merchant).Where("id = ?", id).Scan(ctx.GetCtx())
+	if err != nil {
+		return nil, r.db.HandleDBError(ctx, "merchant", database.Fetching, err)
+	}
+
+	return &merchant, nil
+}
+
+// transition locks the payment row, checks that the new status is allowed by the state machine and stores it in the
+// history. It must be called within the same transaction that updates the payment
+func transition(c context.Context, tx bun.Tx, ctx *d.ContextInformation, payment *dbd.Payment, reason string) error {
+	var current int
+	err := tx.NewSelect().Model((*dbd.Payment)(nil)).Column("status").
+		Where("id = ?", payment.ID).For("UPDATE").Scan(c, &current)
+	if err != nil {
+		return err
+	}
+
+	if apierr := statemachine.ValidateTransition(current, payment.Status); apierr != nil {
+		return apierr
+	}
+
+	return addStatusHistory(c, tx, ctx, payment, &current, reason)
+}
+
+func addStatusHistory(c context.Context, tx bun.Tx, ctx *d.ContextInformation, payment *dbd.Payment, from *int, reason string) error {
+	history := &dbd.PaymentStatusHistory{
+		PaymentID:  payment.ID,
+		FromStatus: from,
+		ToStatus:   payment.Status,
+		Actor:      actor(ctx),
+		Reason:     reason,
+		Code:       payment.Code,
+	}
+
+	if _, err := tx.NewInsert().Model(history).Exec(c); err != nil {
+		return err
+	}
+
+	if err := outbox.Record(c, tx, payment, history); err != nil {
+		return err
+	}
+
+	return webhook.EnqueueDeliveries(c, tx, payment)
+}
+
+// actor is who triggered the transition, the background jobs don't have an authenticated user
+func actor(ctx *d.ContextInformation) string {
+	if ctx != nil && ctx.RequestInfo != nil && ctx.RequestInfo.AuthenticatedUser != nil {
+		return fmt.Sprintf("client:%d", ctx.RequestInfo.AuthenticatedUser.ClientID)
+	}
+	return "system"
+}
@@ -4,7 +4,10 @@ import (
 	"github.com/negarciacamilo/deuna_challenge/application/apierrors"
 	d "github.com/negarciacamilo/deuna_challenge/application/domain"
 	"github.com/negarciacamilo/deuna_challenge/application/domain/database"
+	"github.com/negarciacamilo/deuna_challenge/application/money"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/domain"
 	"github.com/stretchr/testify/mock"
+	"time"
 )
 
 type RepositoryMock struct {
@@ -20,8 +23,8 @@ func (r *RepositoryMock) AddPayment(ctx *d.ContextInformation, payment *database
 	return nil
 }
 
-func (r *RepositoryMock) ChangePaymentStatus(ctx *d.ContextInformation, payment *database.Payment) apierrors.ApiError {
-	args := r.Called(ctx, payment)
+func (r *RepositoryMock) ChangePaymentStatus(ctx *d.ContextInformation, payment *database.Payment, reason string) apierrors.ApiError {
+	args := r.Called(ctx, payment, reason)
 	err := args.Get(0)
 	if err != nil {
 		return err.(apierrors.ApiError)
@@ -29,8 +32,83 @@ func (r *RepositoryMock) ChangePaymentStatus(ctx *d.ContextInformation, payment
 	return nil
 }
 
-func (r *RepositoryMock) GetAllPayments(ctx *d.ContextInformation) (*[]database.Payment, apierrors.ApiError) {
-	args := r.Called(ctx)
+func (r *RepositoryMock) ReversePayment(ctx *d.ContextInformation, payment *database.Payment, reversal *database.Reversal, reason string) apierrors.ApiError {
+	args := r.Called(ctx, payment, reversal, reason)
+	err := args.Get(0)
+	if err != nil {
+		return err.(apierrors.ApiError)
+	}
+	return nil
+}
+
+func (r *RepositoryMock) GetAllPayments(ctx *d.ContextInformation, filter domain.PaymentFilter) (*domain.PaymentsPage, apierrors.ApiError) {
+	args := r.Called(ctx, filter)
+	p := args.Get(0)
+	err := args.Get(1)
+	if err != nil {
+		if p != nil {
+			return p.(*domain.PaymentsPage), err.(apierrors.ApiError)
+		}
+		return nil, err.(apierrors.ApiError)
+	}
+	return p.(*domain.PaymentsPage), nil
+}
+
+func (r *RepositoryMock) GetCustomerPayments(ctx *d.ContextInformation, id uint64, filter domain.PaymentFilter) (*domain.PaymentsPage, apierrors.ApiError) {
+	args := r.Called(ctx, id, filter)
+	p := args.Get(0)
+	err := args.Get(1)
+	if err != nil {
+		if p != nil {
+			return p.(*domain.PaymentsPage), err.(apierrors.ApiError)
+		}
+		return nil, err.(apierrors.ApiError)
+	}
+	return p.(*domain.PaymentsPage), nil
+}
+
+func (r *RepositoryMock) GetPaymentByID(ctx *d.ContextInformation, id uint64) (*database.Payment, apierrors.ApiError) {
+	args := r.Called(ctx, id)
+	p := args.Get(0)
+	err := args.Get(1)
+	if err != nil {
+		if p != nil {
+			return p.(*database.Payment), err.(apierrors.ApiError)
+		}
+		return nil, err.(apierrors.ApiError)
+	}
+	return p.(*database.Payment), nil
+}
+
+func (r *RepositoryMock) ReserveRefund(ctx *d.ContextInformation, payment *database.Payment, amount money.Amount) apierrors.ApiError {
+	args := r.Called(ctx, payment, amount)
+	err := args.Get(0)
+	if err != nil {
+		return err.(apierrors.ApiError)
+	}
+	return nil
+}
+
+func (r *RepositoryMock) ReleaseRefund(ctx *d.ContextInformation, payment *database.Payment, amount money.Amount) apierrors.ApiError {
+	args := r.Called(ctx, payment, amount)
+	err := args.Get(0)
+	if err != nil {
+		return err.(apierrors.ApiError)
+	}
+	return nil
+}
+
+func (r *RepositoryMock) AddRefund(ctx *d.ContextInformation, payment *database.Payment, refund *database.Refund) apierrors.ApiError {
+	args := r.Called(ctx, payment, refund)
+	err := args.Get(0)
+	if err != nil {
+		return err.(apierrors.ApiError)
+	}
+	return nil
+}
+
+func (r *RepositoryMock) GetExpiredAuthorizations(ctx *d.ContextInformation, now time.Time) (*[]database.Payment, apierrors.ApiError) {
+	args := r.Called(ctx, now)
 	p := args.Get(0)
 	err := args.Get(1)
 	if err != nil {
@@ -42,8 +120,8 @@ func (r *RepositoryMock) GetAllPayments(ctx *d.ContextInformation) (*[]database.
 	return p.(*[]database.Payment), nil
 }
 
-func (r *RepositoryMock) GetCustomerPayments(ctx *d.ContextInformation, id uint64) (*[]database.Payment, apierrors.ApiError) {
-	args := r.Called(ctx, id)
+func (r *RepositoryMock) GetStalePendingPayments(ctx *d.ContextInformation, createdBefore time.Time) (*[]database.Payment, apierrors.ApiError) {
+	args := r.Called(ctx, createdBefore)
 	p := args.Get(0)
 	err := args.Get(1)
 	if err != nil {
@@ -55,15 +133,54 @@ func (r *RepositoryMock) GetCustomerPayments(ctx *d.ContextInformation, id uint6
 	return p.(*[]database.Payment), nil
 }
 
-func (r *RepositoryMock) GetPaymentByID(ctx *d.ContextInformation, id uint64) (*database.Payment, apierrors.ApiError) {
+func (r *RepositoryMock) GetPaymentStatusHistory(ctx *d.ContextInformation, paymentID uint64) (*[]database.PaymentStatusHistory, apierrors.ApiError) {
+	args := r.Called(ctx, paymentID)
+	h := args.Get(0)
+	err := args.Get(1)
+	if err != nil {
+		if h != nil {
+			return h.(*[]database.PaymentStatusHistory), err.(apierrors.ApiError)
+		}
+		return nil, err.(apierrors.ApiError)
+	}
+	return h.(*[]database.PaymentStatusHistory), nil
+}
+
+func (r *RepositoryMock) GetMerchantByID(ctx *d.ContextInformation, id uint64) (*database.Merchant, apierrors.ApiError) {
 	args := r.Called(ctx, id)
+	m := args.Get(0)
+	err := args.Get(1)
+	if err != nil {
+		if m != nil {
+			return m.(*database.Merchant), err.(apierrors.ApiError)
+		}
+		return nil, err.(apierrors.ApiError)
+	}
+	return m.(*database.Merchant), nil
+}
+
+func (r *RepositoryMock) GetMerchantPayments(ctx *d.ContextInformation, merchantID uint64, filter domain.PaymentFilter) (*domain.PaymentsPage, apierrors.ApiError) {
+	args := r.Called(ctx, merchantID, filter)
 	p := args.Get(0)
 	err := args.Get(1)
 	if err != nil {
 		if p != nil {
-			return p.(*database.Payment), err.(apierrors.ApiError)
+			return p.(*domain.PaymentsPage), err.(apierrors.ApiError)
 		}
 		return nil, err.(apierrors.ApiError)
 	}
-	return p.(*database.Payment), nil
+	return p.(*domain.PaymentsPage), nil
+}
+
+func (r *RepositoryMock) GetMerchantSummary(ctx *d.ContextInformation, merchantID uint64, filter domain.PaymentFilter) (*[]domain.CurrencySummary, apierrors.ApiError) {
+	args := r.Called(ctx, merchantID, filter)
+	s := args.Get(0)
+	err := args.Get(1)
+	if err != nil {
+		if s != nil {
+			return s.(*[]domain.CurrencySummary), err.(apierrors.ApiError)
+		}
+		return nil, err.(apierrors.ApiError)
+	}
+	return s.(*[]domain.CurrencySummary), nil
 }
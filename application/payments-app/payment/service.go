@@ -1,66 +1,128 @@
 package payment
 
 import (
+	"fmt"
+	"github.com/google/uuid"
 	"github.com/negarciacamilo/deuna_challenge/application/apierrors"
+	sdefines "github.com/negarciacamilo/deuna_challenge/application/defines"
 	d "github.com/negarciacamilo/deuna_challenge/application/domain"
 	dbd "github.com/negarciacamilo/deuna_challenge/application/domain/database"
+	"github.com/negarciacamilo/deuna_challenge/application/iso8583"
 	"github.com/negarciacamilo/deuna_challenge/application/logger"
+	"github.com/negarciacamilo/deuna_challenge/application/money"
 	"github.com/negarciacamilo/deuna_challenge/application/payments-app/bank"
 	"github.com/negarciacamilo/deuna_challenge/application/payments-app/defines"
 	"github.com/negarciacamilo/deuna_challenge/application/payments-app/domain"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/reversal"
 	"github.com/negarciacamilo/deuna_challenge/application/response"
+	"github.com/spf13/viper"
+	"math"
 	"net/http"
+	"time"
 )
 
 type Service interface {
 	Pay(ctx *d.ContextInformation, payment domain.PaymentRequest) (response.Response, apierrors.ApiError)
 	GetPaymentByID(ctx *d.ContextInformation, id uint64) (response.Response, apierrors.ApiError)
-	GetCustomerPayments(ctx *d.ContextInformation, id uint64) (response.Response, apierrors.ApiError)
-	GetAllPayments(ctx *d.ContextInformation) (response.Response, apierrors.ApiError)
-	RefundPayment(ctx *d.ContextInformation, paymentID uint64) (response.Response, apierrors.ApiError)
+	GetCustomerPayments(ctx *d.ContextInformation, id uint64, filter domain.PaymentFilter) (response.Response, apierrors.ApiError)
+	GetAllPayments(ctx *d.ContextInformation, filter domain.PaymentFilter) (response.Response, apierrors.ApiError)
+	RefundPayment(ctx *d.ContextInformation, paymentID uint64, refundRequest domain.RefundRequest) (response.Response, apierrors.ApiError)
+	CapturePayment(ctx *d.ContextInformation, paymentID uint64, captureRequest domain.CaptureRequest) (response.Response, apierrors.ApiError)
+	VoidPayment(ctx *d.ContextInformation, paymentID uint64) (response.Response, apierrors.ApiError)
+	ExpireAuthorizations(ctx *d.ContextInformation) apierrors.ApiError
+	RecoverPendingPayments(ctx *d.ContextInformation) apierrors.ApiError
+	GetPaymentTimeline(ctx *d.ContextInformation, paymentID uint64) (response.Response, apierrors.ApiError)
+	GetMerchantPayments(ctx *d.ContextInformation, merchantID uint64, filter domain.PaymentFilter) (response.Response, apierrors.ApiError)
+	GetMerchantSummary(ctx *d.ContextInformation, merchantID uint64, filter domain.PaymentFilter) (response.Response, apierrors.ApiError)
 }
 
 type service struct {
-	bankRepository    bank.Repository
+	banks             bank.Registry
 	paymentRepository Repository
 }
 
-func NewService(bankRepository bank.Repository, paymentRepository Repository) Service {
+func NewService(banks bank.Registry, paymentRepository Repository) Service {
 	return &service{
-		bankRepository:    bankRepository,
+		banks:             banks,
 		paymentRepository: paymentRepository,
 	}
 }
 
 func (s *service) Pay(ctx *d.ContextInformation, payment domain.PaymentRequest) (response.Response, apierrors.ApiError) {
+	connector, apierr := s.banks.Get(ctx, payment.BankID)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	merchant, apierr := s.paymentRepository.GetMerchantByID(ctx, payment.MerchantID)
+	if apierr != nil {
+		if apierr.Status() == http.StatusNotFound {
+			return nil, apierrors.NewBadRequestApiError("invalid merchant id")
+		}
+		return nil, apierr
+	}
+
+	if !merchant.AcceptsCurrency(payment.Currency) {
+		apierr = apierrors.NewBadRequestApiError(fmt.Sprintf("the merchant doesn't accept %s payments", payment.Currency))
+		logger.Error(apierr.Message(), "payment-service-pay", apierr, ctx, map[string]any{"merchant_id": merchant.ID, "currency": payment.Currency})
+		return nil, apierr
+	}
+
 	p := &dbd.Payment{
-		Amount:     payment.Amount,
-		CustomerID: ctx.RequestInfo.AuthenticatedUser.ClientID,
-		MerchantID: payment.MerchantID,
-		BankID:     payment.BankID,
-		Status:     defines.APPROVED_STATUS,
-		Code:       defines.APPROVE_CODE,
+		Amount:           payment.Amount,
+		Currency:         payment.Currency,
+		AuthorizedAmount: payment.Amount,
+		CustomerID:       ctx.RequestInfo.AuthenticatedUser.ClientID,
+		MerchantID:       payment.MerchantID,
+		BankID:           payment.BankID,
+		Status:           defines.PENDING_STATUS,
+		Reference:        uuid.NewString(),
+	}
+	payment.Reference = p.Reference
+
+	// The payment is stored before calling the bank, so if the process dies in the meantime it's left pending and the
+	// sweeper resolves it with the bank instead of the customer being charged for a payment we don't know about
+	apierr = s.paymentRepository.AddPayment(ctx, p)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	var operationID *string
+	p.Code = iso8583.Approved
+	if payment.IsManualCapture() {
+		operationID, apierr = connector.Authorize(ctx, payment)
+		expiresAt := time.Now().Add(viper.GetDuration("AUTHORIZATION_TTL"))
+		p.Status = defines.AUTHORIZED_STATUS
+		p.AuthorizationExpiresAt = &expiresAt
+	} else {
+		operationID, apierr = connector.Pay(ctx, payment)
+		p.Status = defines.APPROVED_STATUS
+	}
+
+	if apierr != nil && bank.Unanswered(apierr) {
+		// The bank might have approved it, so it's reversed by its reference like acquirers do. Only a decline rejects it
+		p.Code = connector.ParseAPIError(apierr)
+		p.AuthorizationExpiresAt = nil
+		if err := s.reverse(ctx, p, p.Reference, "the bank didn't answer the payment, the operation was reversed"); err != nil {
+			// The payment is still pending and the sweeper takes care of it
+			logger.Error("error changing payment status", "payment-service-pay", err, ctx)
+		}
+		return response.New(http.StatusCreated, p), nil
 	}
 
-	operationID, apierr := s.bankRepository.Pay(ctx, payment)
 	if apierr != nil {
-		code := s.bankRepository.ParseAPIError(apierr)
+		code := connector.ParseAPIError(apierr)
 		p.Code = code
 		p.Status = defines.REJECTED_STATUS
+		p.AuthorizationExpiresAt = nil
 	} else {
 		p.OperationID = operationID
 	}
 
-	apierr = s.paymentRepository.AddPayment(ctx, p)
-	if apierr != nil && p.Status == defines.APPROVED_STATUS {
-		err := s.bankRepository.ReverseOperation(ctx, *operationID)
-		// Best effort to reverse the payment
-		if err != nil {
-			logger.Error("error reversing payment", "payment-service-pay", err, ctx)
-		}
-		p.Status = defines.REVERSAL_STATUS
-		err = s.paymentRepository.ChangePaymentStatus(ctx, p)
-		if err != nil {
+	apierr = s.paymentRepository.ChangePaymentStatus(ctx, p, "bank answer")
+	if apierr != nil && (p.Status == defines.APPROVED_STATUS || p.Status == defines.AUTHORIZED_STATUS) {
+		// If this can't be stored either, the payment is still pending and the sweeper takes care of it
+		if err := s.reverse(ctx, p, *operationID, "the payment couldn't be stored, the operation was reversed"); err != nil {
 			logger.Error("error changing payment status", "payment-service-pay", err, ctx)
 		}
 	}
@@ -68,6 +130,104 @@ func (s *service) Pay(ctx *d.ContextInformation, payment domain.PaymentRequest)
 	return response.New(http.StatusCreated, p), nil
 }
 
+// RecoverPendingPayments resolves the payments that have been pending for too long, which means that the process
+// died (or the database failed) between storing them and storing the bank answer. The bank is asked for the operation
+// of the payment reference and, if it has no answer, the operation is reversed so the customer isn't charged
+func (s *service) RecoverPendingPayments(ctx *d.ContextInformation) apierrors.ApiError {
+	staleBefore := time.Now().Add(-viper.GetDuration("PENDING_PAYMENT_TIMEOUT"))
+	payments, apierr := s.paymentRepository.GetStalePendingPayments(ctx, staleBefore)
+	if apierr != nil {
+		return apierr
+	}
+
+	for i := range *payments {
+		s.recoverPendingPayment(ctx, &(*payments)[i])
+	}
+
+	return nil
+}
+
+func (s *service) recoverPendingPayment(ctx *d.ContextInformation, payment *dbd.Payment) {
+	connector, apierr := s.banks.Get(ctx, payment.BankID)
+	if apierr != nil {
+		logger.Error("can't recover the pending payment", "payment-service-recover-pending-payment", apierr, ctx, map[string]any{"payment_id": payment.ID})
+		return
+	}
+
+	operation, apierr := connector.GetOperation(ctx, payment.Reference)
+	if apierr != nil && !operationNotFound(apierr) {
+		// The bank may have the operation, it's looked up again on the next sweep
+		logger.Error("can't look up the operation of the pending payment", "payment-service-recover-pending-payment", apierr, ctx, map[string]any{"payment_id": payment.ID})
+		return
+	}
+
+	if apierr != nil {
+		apierr = s.reverse(ctx, payment, payment.Reference, "the bank has no answer for the payment, the operation was reversed")
+	} else {
+		applyBankOperation(connector, payment, operation)
+		apierr = s.paymentRepository.ChangePaymentStatus(ctx, payment, "recovered from the bank operation")
+	}
+
+	if apierr != nil {
+		logger.Error("error changing payment status", "payment-service-recover-pending-payment", apierr, ctx, map[string]any{"payment_id": payment.ID})
+	}
+}
+
+// reverse reverses the bank operation and stores the payment as reversed. If the bank doesn't confirm the reversal,
+// it's queued to be retried until it does
+func (s *service) reverse(ctx *d.ContextInformation, payment *dbd.Payment, operationID, reason string) apierrors.ApiError {
+	payment.Status = defines.REVERSAL_STATUS
+	payment.ReversalStatus = defines.REVERSAL_CONFIRMED
+
+	var queued *dbd.Reversal
+	connector, apierr := s.banks.Get(ctx, payment.BankID)
+	if apierr == nil {
+		apierr = connector.ReverseOperation(ctx, operationID)
+	}
+
+	if apierr != nil {
+		logger.Error("error reversing payment, queueing it", "payment-service-reverse", apierr, ctx, map[string]any{"payment_id": payment.ID})
+		payment.ReversalStatus = defines.REVERSAL_PENDING
+		queued = reversal.New(payment, operationID, apierr)
+	}
+
+	return s.paymentRepository.ReversePayment(ctx, payment, queued, reason)
+}
+
+// operationNotFound tells if the bank answered it never got the operation, or that it can't be asked for operations at
+// all like the ISO 8583 banks. Any other error says nothing about it
+func operationNotFound(apierr apierrors.ApiError) bool {
+	return apierr.Status() == http.StatusNotFound || apierr.Code() == sdefines.OPERATION_NOT_FOUND_DECLINE ||
+		apierr.Status() == http.StatusNotImplemented
+}
+
+// applyBankOperation sets the status of the payment based on what the bank knows about its operation
+func applyBankOperation(connector bank.BankConnector, payment *dbd.Payment, operation *d.BankOperation) {
+	if operation.OperationID != "" {
+		payment.OperationID = &operation.OperationID
+	}
+
+	payment.Code = iso8583.Approved
+	switch operation.Status {
+	case sdefines.OPERATION_APPROVED:
+		payment.Status = defines.APPROVED_STATUS
+	case sdefines.OPERATION_AUTHORIZED:
+		expiresAt := payment.CreatedAt.Add(viper.GetDuration("AUTHORIZATION_TTL"))
+		payment.Status = defines.AUTHORIZED_STATUS
+		payment.AuthorizationExpiresAt = &expiresAt
+	case sdefines.OPERATION_DECLINED:
+		payment.Status = defines.REJECTED_STATUS
+		payment.Code = iso8583.SystemError
+		if operation.Error != nil {
+			payment.Code = connector.ParseAPIError(operation.Error)
+		}
+	default:
+		// Voided or reversed
+		payment.Status = defines.REVERSAL_STATUS
+		payment.ReversalStatus = defines.REVERSAL_CONFIRMED
+	}
+}
+
 func (s *service) GetPaymentByID(ctx *d.ContextInformation, id uint64) (response.Response, apierrors.ApiError) {
 	payments, apierr := s.paymentRepository.GetPaymentByID(ctx, id)
 	if apierr != nil {
@@ -77,8 +237,17 @@ func (s *service) GetPaymentByID(ctx *d.ContextInformation, id uint64) (response
 	return response.New(http.StatusOK, payments), nil
 }
 
-func (s *service) GetCustomerPayments(ctx *d.ContextInformation, id uint64) (response.Response, apierrors.ApiError) {
-	payments, apierr := s.paymentRepository.GetCustomerPayments(ctx, id)
+func (s *service) GetCustomerPayments(ctx *d.ContextInformation, id uint64, filter domain.PaymentFilter) (response.Response, apierrors.ApiError) {
+	payments, apierr := s.paymentRepository.GetCustomerPayments(ctx, id, filter)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	return response.New(http.StatusOK, payments), nil
+}
+
+func (s *service) GetAllPayments(ctx *d.ContextInformation, filter domain.PaymentFilter) (response.Response, apierrors.ApiError) {
+	payments, apierr := s.paymentRepository.GetAllPayments(ctx, filter)
 	if apierr != nil {
 		return nil, apierr
 	}
@@ -86,8 +255,8 @@ func (s *service) GetCustomerPayments(ctx *d.ContextInformation, id uint64) (res
 	return response.New(http.StatusOK, payments), nil
 }
 
-func (s *service) GetAllPayments(ctx *d.ContextInformation) (response.Response, apierrors.ApiError) {
-	payments, apierr := s.paymentRepository.GetAllPayments(ctx)
+func (s *service) GetMerchantPayments(ctx *d.ContextInformation, merchantID uint64, filter domain.PaymentFilter) (response.Response, apierrors.ApiError) {
+	payments, apierr := s.paymentRepository.GetMerchantPayments(ctx, merchantID, filter)
 	if apierr != nil {
 		return nil, apierr
 	}
@@ -95,28 +264,238 @@ func (s *service) GetAllPayments(ctx *d.ContextInformation) (response.Response,
 	return response.New(http.StatusOK, payments), nil
 }
 
-func (s *service) RefundPayment(ctx *d.ContextInformation, paymentID uint64) (response.Response, apierrors.ApiError) {
+func (s *service) GetMerchantSummary(ctx *d.ContextInformation, merchantID uint64, filter domain.PaymentFilter) (response.Response, apierrors.ApiError) {
+	currencies, apierr := s.paymentRepository.GetMerchantSummary(ctx, merchantID, filter)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	for i := range *currencies {
+		c := &(*currencies)[i]
+		if decided := c.ApprovedCount + c.RejectedCount; decided > 0 {
+			c.ApprovalRate = math.Round(float64(c.ApprovedCount)/float64(decided)*10000) / 10000
+		}
+	}
+
+	summary := domain.MerchantSummary{
+		MerchantID:  merchantID,
+		CreatedFrom: filter.CreatedFrom,
+		CreatedTo:   filter.CreatedTo,
+		Currencies:  *currencies,
+	}
+	return response.New(http.StatusOK, summary), nil
+}
+
+func (s *service) GetPaymentTimeline(ctx *d.ContextInformation, paymentID uint64) (response.Response, apierrors.ApiError) {
+	_, apierr := s.paymentRepository.GetPaymentByID(ctx, paymentID)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	history, apierr := s.paymentRepository.GetPaymentStatusHistory(ctx, paymentID)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	return response.New(http.StatusOK, history), nil
+}
+
+func (s *service) RefundPayment(ctx *d.ContextInformation, paymentID uint64, refundRequest domain.RefundRequest) (response.Response, apierrors.ApiError) {
 	payment, apierr := s.paymentRepository.GetPaymentByID(ctx, paymentID)
 	if apierr != nil {
 		return nil, apierr
 	}
 
-	if payment.Status != defines.APPROVED_STATUS {
+	if payment.Status != defines.APPROVED_STATUS && payment.Status != defines.PARTIALLY_REFUNDED_STATUS {
 		return nil, apierrors.NewBadRequestApiError("can't refund an unapproved payment")
 	}
 
-	apierr = s.bankRepository.RefundPayment(ctx, *payment.OperationID)
+	remaining := payment.Amount - payment.RefundedAmount - payment.RefundingAmount
+	amount := remaining
+	if refundRequest.Amount != nil {
+		amount = *refundRequest.Amount
+		if apierr = validatePrecision(ctx, payment, amount); apierr != nil {
+			return nil, apierr
+		}
+	}
+
+	if amount <= 0 || amount > remaining {
+		apierr = apierrors.NewBadRequestApiError("refund amount exceeds the remaining balance of the payment")
+		logger.Error(apierr.Message(), "payment-service-refund", apierr, ctx, map[string]any{"amount": amount, "remaining": remaining})
+		return nil, apierr
+	}
+
+	connector, apierr := s.banks.Get(ctx, payment.BankID)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	// The amount is held before calling the bank, so a concurrent refund can't be paid by the bank for what this one
+	// is refunding
+	if apierr = s.paymentRepository.ReserveRefund(ctx, payment, amount); apierr != nil {
+		return nil, apierr
+	}
+
+	apierr = connector.RefundPayment(ctx, *payment.OperationID, amount)
+	if apierr != nil {
+		if err := s.paymentRepository.ReleaseRefund(ctx, payment, amount); err != nil {
+			logger.Error("error releasing the refund amount", "payment-service-refund", err, ctx, map[string]any{"payment_id": payment.ID, "amount": amount})
+		}
+		return nil, apierr
+	}
+
+	refund := &dbd.Refund{
+		Amount:    amount,
+		Reason:    refundRequest.Reason,
+		PaymentID: payment.ID,
+		Code:      iso8583.RefundApproved,
+	}
+
+	payment.RefundedAmount = payment.RefundedAmount + amount
+	payment.Code = iso8583.RefundApproved
+	if payment.RefundedAmount < payment.Amount {
+		payment.Status = defines.PARTIALLY_REFUNDED_STATUS
+	} else {
+		payment.Status = defines.REFUNDED_STATUS
+	}
+
+	apierr = s.paymentRepository.AddRefund(ctx, payment, refund)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	payment.Refunds = append(payment.Refunds, refund)
+	return response.New(http.StatusOK, payment), nil
+}
+
+func (s *service) CapturePayment(ctx *d.ContextInformation, paymentID uint64, captureRequest domain.CaptureRequest) (response.Response, apierrors.ApiError) {
+	payment, apierr := s.paymentRepository.GetPaymentByID(ctx, paymentID)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	if payment.Status != defines.AUTHORIZED_STATUS {
+		return nil, apierrors.NewBadRequestApiError("only authorized payments can be captured")
+	}
+
+	if authorizationExpired(payment) {
+		s.expireAuthorization(ctx, payment)
+		return nil, apierrors.NewBadRequestApiError("the authorization has expired")
+	}
+
+	amount := payment.AuthorizedAmount
+	if captureRequest.Amount != nil {
+		amount = *captureRequest.Amount
+		if apierr = validatePrecision(ctx, payment, amount); apierr != nil {
+			return nil, apierr
+		}
+	}
+
+	if amount > payment.AuthorizedAmount {
+		apierr = apierrors.NewBadRequestApiError("capture amount exceeds the authorized amount")
+		logger.Error(apierr.Message(), "payment-service-capture", apierr, ctx, map[string]any{"amount": amount, "authorized": payment.AuthorizedAmount})
+		return nil, apierr
+	}
+
+	connector, apierr := s.banks.Get(ctx, payment.BankID)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	apierr = connector.Capture(ctx, *payment.OperationID, amount)
 	if apierr != nil {
 		return nil, apierr
 	}
 
-	payment.Status = defines.REFUNDED_STATUS
-	payment.Code = "0008"
-	apierr = s.paymentRepository.ChangePaymentStatus(ctx, payment)
+	// Whatever wasn't captured is released by the bank
+	payment.Amount = amount
+	payment.Status = defines.APPROVED_STATUS
+	payment.AuthorizationExpiresAt = nil
+	apierr = s.paymentRepository.ChangePaymentStatus(ctx, payment, "payment captured")
 	if apierr != nil {
 		return nil, apierr
 	}
 
 	return response.New(http.StatusOK, payment), nil
+}
+
+func (s *service) VoidPayment(ctx *d.ContextInformation, paymentID uint64) (response.Response, apierrors.ApiError) {
+	payment, apierr := s.paymentRepository.GetPaymentByID(ctx, paymentID)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	if payment.Status != defines.AUTHORIZED_STATUS {
+		return nil, apierrors.NewBadRequestApiError("only authorized payments can be voided")
+	}
+
+	connector, apierr := s.banks.Get(ctx, payment.BankID)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	apierr = connector.Void(ctx, *payment.OperationID)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	payment.Status = defines.CANCELLED_STATUS
+	payment.AuthorizationExpiresAt = nil
+	apierr = s.paymentRepository.ChangePaymentStatus(ctx, payment, "payment voided")
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	return response.New(http.StatusOK, payment), nil
+}
+
+// ExpireAuthorizations cancels every hold that wasn't captured in time
+func (s *service) ExpireAuthorizations(ctx *d.ContextInformation) apierrors.ApiError {
+	payments, apierr := s.paymentRepository.GetExpiredAuthorizations(ctx, time.Now())
+	if apierr != nil {
+		return apierr
+	}
+
+	for i := range *payments {
+		s.expireAuthorization(ctx, &(*payments)[i])
+	}
+
+	return nil
+}
+
+func (s *service) expireAuthorization(ctx *d.ContextInformation, payment *dbd.Payment) {
+	// Best effort, the bank releases the hold on its own once it expires
+	connector, apierr := s.banks.Get(ctx, payment.BankID)
+	if apierr == nil {
+		apierr = connector.Void(ctx, *payment.OperationID)
+	}
+
+	if apierr != nil {
+		logger.Error("error voiding expired authorization", "payment-service-expire-authorization", apierr, ctx, map[string]any{"payment_id": payment.ID})
+	}
+
+	payment.Status = defines.CANCELLED_STATUS
+	payment.AuthorizationExpiresAt = nil
+	if apierr := s.paymentRepository.ChangePaymentStatus(ctx, payment, "authorization expired"); apierr != nil {
+		logger.Error("error changing payment status", "payment-service-expire-authorization", apierr, ctx, map[string]any{"payment_id": payment.ID})
+	}
+}
+
+// validatePrecision checks that a refund or capture amount has the decimal places allowed by the payment currency
+func validatePrecision(ctx *d.ContextInformation, payment *dbd.Payment, amount money.Amount) apierrors.ApiError {
+	currency, ok := money.LookupCurrency(payment.Currency)
+	if !ok {
+		return nil
+	}
+
+	if err := currency.ValidatePrecision(amount); err != nil {
+		apierr := apierrors.NewBadRequestApiError(err.Error())
+		logger.Error(apierr.Message(), "validate-precision", apierr, ctx, map[string]any{"amount": amount, "currency": payment.Currency})
+		return apierr
+	}
+	return nil
+}
 
+func authorizationExpired(payment *dbd.Payment) bool {
+	return payment.AuthorizationExpiresAt != nil && payment.AuthorizationExpiresAt.Before(time.Now())
 }
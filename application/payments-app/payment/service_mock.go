@@ -40,8 +40,8 @@ func (s *ServiceMock) GetPaymentByID(ctx *d.ContextInformation, id uint64) (resp
 	return resp.(response.Response), err.(apierrors.ApiError)
 }
 
-func (s *ServiceMock) GetCustomerPayments(ctx *d.ContextInformation, id uint64) (response.Response, apierrors.ApiError) {
-	args := s.Called(ctx, id)
+func (s *ServiceMock) GetCustomerPayments(ctx *d.ContextInformation, id uint64, filter domain.PaymentFilter) (response.Response, apierrors.ApiError) {
+	args := s.Called(ctx, id, filter)
 	resp := args.Get(0)
 	err := args.Get(1)
 	if resp != nil {
@@ -54,8 +54,8 @@ func (s *ServiceMock) GetCustomerPayments(ctx *d.ContextInformation, id uint64)
 	return resp.(response.Response), err.(apierrors.ApiError)
 }
 
-func (s *ServiceMock) GetAllPayments(ctx *d.ContextInformation) (response.Response, apierrors.ApiError) {
-	args := s.Called(ctx)
+func (s *ServiceMock) GetAllPayments(ctx *d.ContextInformation, filter domain.PaymentFilter) (response.Response, apierrors.ApiError) {
+	args := s.Called(ctx, filter)
 	resp := args.Get(0)
 	err := args.Get(1)
 	if resp != nil {
@@ -68,7 +68,35 @@ func (s *ServiceMock) GetAllPayments(ctx *d.ContextInformation) (response.Respon
 	return resp.(response.Response), err.(apierrors.ApiError)
 }
 
-func (s *ServiceMock) RefundPayment(ctx *d.ContextInformation, paymentID uint64) (response.Response, apierrors.ApiError) {
+func (s *ServiceMock) RefundPayment(ctx *d.ContextInformation, paymentID uint64, refundRequest domain.RefundRequest) (response.Response, apierrors.ApiError) {
+	args := s.Called(ctx, paymentID, refundRequest)
+	resp := args.Get(0)
+	err := args.Get(1)
+	if resp != nil {
+		return resp.(response.Response), nil
+	}
+	if err != nil {
+		return nil, err.(apierrors.ApiError)
+	}
+
+	return resp.(response.Response), err.(apierrors.ApiError)
+}
+
+func (s *ServiceMock) CapturePayment(ctx *d.ContextInformation, paymentID uint64, captureRequest domain.CaptureRequest) (response.Response, apierrors.ApiError) {
+	args := s.Called(ctx, paymentID, captureRequest)
+	resp := args.Get(0)
+	err := args.Get(1)
+	if resp != nil {
+		return resp.(response.Response), nil
+	}
+	if err != nil {
+		return nil, err.(apierrors.ApiError)
+	}
+
+	return resp.(response.Response), err.(apierrors.ApiError)
+}
+
+func (s *ServiceMock) VoidPayment(ctx *d.ContextInformation, paymentID uint64) (response.Response, apierrors.ApiError) {
 	args := s.Called(ctx, paymentID)
 	resp := args.Get(0)
 	err := args.Get(1)
@@ -81,3 +109,63 @@ func (s *ServiceMock) RefundPayment(ctx *d.ContextInformation, paymentID uint64)
 
 	return resp.(response.Response), err.(apierrors.ApiError)
 }
+
+func (s *ServiceMock) ExpireAuthorizations(ctx *d.ContextInformation) apierrors.ApiError {
+	args := s.Called(ctx)
+	err := args.Get(0)
+	if err != nil {
+		return err.(apierrors.ApiError)
+	}
+	return nil
+}
+
+func (s *ServiceMock) RecoverPendingPayments(ctx *d.ContextInformation) apierrors.ApiError {
+	args := s.Called(ctx)
+	err := args.Get(0)
+	if err != nil {
+		return err.(apierrors.ApiError)
+	}
+	return nil
+}
+
+func (s *ServiceMock) GetPaymentTimeline(ctx *d.ContextInformation, paymentID uint64) (response.Response, apierrors.ApiError) {
+	args := s.Called(ctx, paymentID)
+	resp := args.Get(0)
+	err := args.Get(1)
+	if resp != nil {
+		return resp.(response.Response), nil
+	}
+	if err != nil {
+		return nil, err.(apierrors.ApiError)
+	}
+
+	return resp.(response.Response), err.(apierrors.ApiError)
+}
+
+func (s *ServiceMock) GetMerchantPayments(ctx *d.ContextInformation, merchantID uint64, filter domain.PaymentFilter) (response.Response, apierrors.ApiError) {
+	args := s.Called(ctx, merchantID, filter)
+	resp := args.Get(0)
+	err := args.Get(1)
+	if resp != nil {
+		return resp.(response.Response), nil
+	}
+	if err != nil {
+		return nil, err.(apierrors.ApiError)
+	}
+
+	return resp.(response.Response), err.(apierrors.ApiError)
+}
+
+func (s *ServiceMock) GetMerchantSummary(ctx *d.ContextInformation, merchantID uint64, filter domain.PaymentFilter) (response.Response, apierrors.ApiError) {
+	args := s.Called(ctx, merchantID, filter)
+	resp := args.Get(0)
+	err := args.Get(1)
+	if resp != nil {
+		return resp.(response.Response), nil
+	}
+	if err != nil {
+		return nil, err.(apierrors.ApiError)
+	}
+
+	return resp.(response.Response), err.(apierrors.ApiError)
+}
@@ -3,25 +3,32 @@ package payment
 import (
 	"github.com/google/uuid"
 	"github.com/negarciacamilo/deuna_challenge/application/apierrors"
+	sdefines "github.com/negarciacamilo/deuna_challenge/application/defines"
 	d "github.com/negarciacamilo/deuna_challenge/application/domain"
 	"github.com/negarciacamilo/deuna_challenge/application/domain/database"
+	"github.com/negarciacamilo/deuna_challenge/application/iso8583"
+	"github.com/negarciacamilo/deuna_challenge/application/money"
 	"github.com/negarciacamilo/deuna_challenge/application/payments-app/bank"
 	"github.com/negarciacamilo/deuna_challenge/application/payments-app/defines"
 	"github.com/negarciacamilo/deuna_challenge/application/payments-app/domain"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"net/http"
 	"testing"
+	"time"
 )
 
 func TestPay(t *testing.T) {
 	tests := []struct {
 		name             string
+		request          domain.PaymentRequest
 		bankPayReturn    string
 		bankPayError     error
 		paymentAddReturn error
 		expectedStatus   int
+		expectedReversal string
 		expectedErr      error
-		setupMocks       func(bankMock *bank.RepositoryMock, paymentRepoMock *RepositoryMock)
+		setupMocks       func(bankMock *bank.ConnectorMock, paymentRepoMock *RepositoryMock)
 	}{
 		{
 			name:             "Happy path",
@@ -30,9 +37,11 @@ func TestPay(t *testing.T) {
 			paymentAddReturn: nil,
 			expectedStatus:   defines.APPROVED_STATUS,
 			expectedErr:      nil,
-			setupMocks: func(bankMock *bank.RepositoryMock, paymentRepoMock *RepositoryMock) {
+			setupMocks: func(bankMock *bank.ConnectorMock, paymentRepoMock *RepositoryMock) {
+				paymentRepoMock.On("GetMerchantByID", mock.Anything, mock.Anything).Return(&database.Merchant{}, nil)
 				bankMock.On("Pay", mock.Anything, mock.Anything).Return("some-unique-id", nil)
 				paymentRepoMock.On("AddPayment", mock.Anything, mock.Anything).Return(nil)
+				paymentRepoMock.On("ChangePaymentStatus", mock.Anything, mock.Anything, "bank answer").Return(nil)
 			},
 		},
 		{
@@ -42,46 +51,124 @@ func TestPay(t *testing.T) {
 			paymentAddReturn: nil,
 			expectedStatus:   defines.REJECTED_STATUS,
 			expectedErr:      nil,
-			setupMocks: func(bankMock *bank.RepositoryMock, paymentRepoMock *RepositoryMock) {
+			setupMocks: func(bankMock *bank.ConnectorMock, paymentRepoMock *RepositoryMock) {
+				paymentRepoMock.On("GetMerchantByID", mock.Anything, mock.Anything).Return(&database.Merchant{}, nil)
 				bankMock.On("Pay", mock.Anything, mock.Anything).Return("", apierrors.NewBadRequestApiError("invalid card"))
 				paymentRepoMock.On("AddPayment", mock.Anything, mock.Anything).Return(nil)
+				paymentRepoMock.On("ChangePaymentStatus", mock.Anything, mock.Anything, "bank answer").Return(nil)
 			},
 		},
 		{
-			name:             "Repository error",
+			name:             "The bank doesn't answer",
+			expectedStatus:   defines.REVERSAL_STATUS,
+			expectedReversal: defines.REVERSAL_CONFIRMED,
+			setupMocks: func(bankMock *bank.ConnectorMock, paymentRepoMock *RepositoryMock) {
+				paymentRepoMock.On("GetMerchantByID", mock.Anything, mock.Anything).Return(&database.Merchant{}, nil)
+				bankMock.On("Pay", mock.Anything, mock.Anything).Return("", apierrors.NewInternalServerApiError("something happened paying", nil))
+				bankMock.On("ReverseOperation", mock.Anything, mock.Anything).Return(nil)
+				paymentRepoMock.On("AddPayment", mock.Anything, mock.Anything).Return(nil)
+				paymentRepoMock.On("ReversePayment", mock.Anything, mock.Anything, (*database.Reversal)(nil), mock.Anything).Return(nil)
+			},
+		},
+		{
+			name:           "The breaker of the bank is open",
+			expectedStatus: defines.REJECTED_STATUS,
+			setupMocks: func(bankMock *bank.ConnectorMock, paymentRepoMock *RepositoryMock) {
+				paymentRepoMock.On("GetMerchantByID", mock.Anything, mock.Anything).Return(&database.Merchant{}, nil)
+				bankMock.On("Pay", mock.Anything, mock.Anything).Return("", apierrors.NewApiError(sdefines.BANK_UNAVAILABLE, sdefines.BANK_UNAVAILABLE_DECLINE, http.StatusServiceUnavailable, nil))
+				paymentRepoMock.On("AddPayment", mock.Anything, mock.Anything).Return(nil)
+				paymentRepoMock.On("ChangePaymentStatus", mock.Anything, mock.Anything, "bank answer").Return(nil)
+			},
+		},
+		{
+			name:             "Manual capture",
+			request:          domain.PaymentRequest{CaptureMethod: defines.MANUAL_CAPTURE},
 			bankPayReturn:    "some-unique-id",
 			bankPayError:     nil,
-			paymentAddReturn: apierrors.NewBadRequestApiError("invalid card"),
+			paymentAddReturn: nil,
+			expectedStatus:   defines.AUTHORIZED_STATUS,
+			expectedErr:      nil,
+			setupMocks: func(bankMock *bank.ConnectorMock, paymentRepoMock *RepositoryMock) {
+				paymentRepoMock.On("GetMerchantByID", mock.Anything, mock.Anything).Return(&database.Merchant{}, nil)
+				bankMock.On("Authorize", mock.Anything, mock.Anything).Return("some-unique-id", nil)
+				paymentRepoMock.On("AddPayment", mock.Anything, mock.Anything).Return(nil)
+				paymentRepoMock.On("ChangePaymentStatus", mock.Anything, mock.Anything, "bank answer").Return(nil)
+			},
+		},
+		{
+			name:             "Bank answer can't be stored",
+			bankPayReturn:    "some-unique-id",
+			bankPayError:     nil,
+			paymentAddReturn: nil,
 			expectedStatus:   defines.REVERSAL_STATUS,
 			expectedErr:      nil,
-			setupMocks: func(bankMock *bank.RepositoryMock, paymentRepoMock *RepositoryMock) {
+			setupMocks: func(bankMock *bank.ConnectorMock, paymentRepoMock *RepositoryMock) {
+				paymentRepoMock.On("GetMerchantByID", mock.Anything, mock.Anything).Return(&database.Merchant{}, nil)
 				bankMock.On("Pay", mock.Anything, mock.Anything).Return("some-unique-id", nil)
 				bankMock.On("ReverseOperation", mock.Anything, "some-unique-id").Return(nil)
-				paymentRepoMock.On("AddPayment", mock.Anything, mock.Anything).Return(apierrors.NewBadRequestApiError("invalid card"))
-				paymentRepoMock.On("ChangePaymentStatus", mock.Anything, mock.Anything).Return(nil)
+				paymentRepoMock.On("AddPayment", mock.Anything, mock.Anything).Return(nil)
+				paymentRepoMock.On("ChangePaymentStatus", mock.Anything, mock.Anything, "bank answer").Return(apierrors.NewInternalServerApiError("error updating payments", nil))
+				paymentRepoMock.On("ReversePayment", mock.Anything, mock.Anything, (*database.Reversal)(nil), mock.Anything).Return(nil)
+			},
+		},
+		{
+			name:             "Bank answer can't be stored and the reversal fails",
+			bankPayReturn:    "some-unique-id",
+			expectedStatus:   defines.REVERSAL_STATUS,
+			expectedReversal: defines.REVERSAL_PENDING,
+			setupMocks: func(bankMock *bank.ConnectorMock, paymentRepoMock *RepositoryMock) {
+				paymentRepoMock.On("GetMerchantByID", mock.Anything, mock.Anything).Return(&database.Merchant{}, nil)
+				bankMock.On("Pay", mock.Anything, mock.Anything).Return("some-unique-id", nil)
+				bankMock.On("ReverseOperation", mock.Anything, "some-unique-id").Return(apierrors.NewInternalServerApiError("something happened reversing", nil))
+				paymentRepoMock.On("AddPayment", mock.Anything, mock.Anything).Return(nil)
+				paymentRepoMock.On("ChangePaymentStatus", mock.Anything, mock.Anything, "bank answer").Return(apierrors.NewInternalServerApiError("error updating payments", nil))
+				paymentRepoMock.On("ReversePayment", mock.Anything, mock.Anything, mock.MatchedBy(func(r *database.Reversal) bool {
+					return r != nil && r.OperationID == "some-unique-id" && r.Status == defines.REVERSAL_PENDING && r.NextAttemptAt != nil
+				}), mock.Anything).Return(nil)
+			},
+		},
+		{
+			name:             "Pending payment can't be stored",
+			paymentAddReturn: apierrors.NewInternalServerApiError("error creating payments", nil),
+			expectedErr:      apierrors.NewInternalServerApiError("error creating payments", nil),
+			setupMocks: func(bankMock *bank.ConnectorMock, paymentRepoMock *RepositoryMock) {
+				paymentRepoMock.On("GetMerchantByID", mock.Anything, mock.Anything).Return(&database.Merchant{}, nil)
+				paymentRepoMock.On("AddPayment", mock.Anything, mock.Anything).Return(apierrors.NewInternalServerApiError("error creating payments", nil))
+			},
+		},
+		{
+			name:        "Merchant doesn't accept the currency",
+			request:     domain.PaymentRequest{Currency: "USD"},
+			expectedErr: apierrors.NewBadRequestApiError("the merchant doesn't accept USD payments"),
+			setupMocks: func(bankMock *bank.ConnectorMock, paymentRepoMock *RepositoryMock) {
+				paymentRepoMock.On("GetMerchantByID", mock.Anything, mock.Anything).Return(&database.Merchant{AcceptedCurrencies: []string{"MXN"}}, nil)
 			},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			bankMock := new(bank.RepositoryMock)
+			bankMock := new(bank.ConnectorMock)
 			paymentRepoMock := new(RepositoryMock)
 
 			tt.setupMocks(bankMock, paymentRepoMock)
 
-			paymentService := NewService(bankMock, paymentRepoMock)
-			resp, err := paymentService.Pay(d.TestContext(), domain.PaymentRequest{})
+			paymentService := NewService(&bank.RegistryMock{Connector: bankMock}, paymentRepoMock)
+			resp, err := paymentService.Pay(d.TestContext(), tt.request)
 
 			if tt.expectedErr != nil {
-				require.ErrorIs(t, err, tt.expectedErr)
-			} else {
-				require.NoError(t, err)
+				require.Equal(t, tt.expectedErr, err)
+				bankMock.AssertNotCalled(t, "Pay", mock.Anything, mock.Anything)
+				return
 			}
+			require.NoError(t, err)
 
 			if tt.expectedStatus != 0 {
 				require.NotNil(t, resp)
 				require.Equal(t, tt.expectedStatus, resp.Response().(*database.Payment).Status)
+				if tt.expectedReversal != "" {
+					require.Equal(t, tt.expectedReversal, resp.Response().(*database.Payment).ReversalStatus)
+				}
 			} else {
 				require.NotNil(t, resp)
 				require.NotNil(t, resp.Response().(*database.Payment))
@@ -146,7 +233,7 @@ func TestGetCustomerPayments(t *testing.T) {
 			expectedPayment: []database.Payment{},
 			expectedErr:     nil,
 			setupMocks: func(paymentRepoMock *RepositoryMock) {
-				paymentRepoMock.On("GetCustomerPayments", mock.Anything, mock.Anything).Return(&[]database.Payment{}, nil)
+				paymentRepoMock.On("GetCustomerPayments", mock.Anything, mock.Anything, mock.Anything).Return(&domain.PaymentsPage{Data: []database.Payment{}, Limit: domain.DefaultPageSize}, nil)
 			},
 		},
 		{
@@ -154,7 +241,7 @@ func TestGetCustomerPayments(t *testing.T) {
 			expectedPayment: []database.Payment{},
 			expectedErr:     apierrors.NewBadRequestApiError("test"),
 			setupMocks: func(paymentRepoMock *RepositoryMock) {
-				paymentRepoMock.On("GetCustomerPayments", mock.Anything, mock.Anything).Return(nil, apierrors.NewBadRequestApiError("test"))
+				paymentRepoMock.On("GetCustomerPayments", mock.Anything, mock.Anything, mock.Anything).Return(nil, apierrors.NewBadRequestApiError("test"))
 			},
 		},
 	}
@@ -166,10 +253,10 @@ func TestGetCustomerPayments(t *testing.T) {
 			tt.setupMocks(paymentRepoMock)
 
 			paymentService := NewService(nil, paymentRepoMock)
-			payments, err := paymentService.GetCustomerPayments(d.TestContext(), 1)
+			payments, err := paymentService.GetCustomerPayments(d.TestContext(), 1, domain.PaymentFilter{Limit: domain.DefaultPageSize})
 			require.Equal(t, tt.expectedErr, err)
 			if tt.expectedErr == nil {
-				require.Equal(t, tt.expectedPayment, *payments.Response().(*[]database.Payment))
+				require.Equal(t, tt.expectedPayment, payments.Response().(*domain.PaymentsPage).Data)
 			}
 		})
 	}
@@ -188,7 +275,7 @@ func TestGetAllPayments(t *testing.T) {
 			expectedPayment: []database.Payment{},
 			expectedErr:     nil,
 			setupMocks: func(paymentRepoMock *RepositoryMock) {
-				paymentRepoMock.On("GetAllPayments", mock.Anything).Return(&[]database.Payment{}, nil)
+				paymentRepoMock.On("GetAllPayments", mock.Anything, mock.Anything).Return(&domain.PaymentsPage{Data: []database.Payment{}, Limit: domain.DefaultPageSize}, nil)
 			},
 		},
 		{
@@ -196,7 +283,7 @@ func TestGetAllPayments(t *testing.T) {
 			expectedPayment: []database.Payment{},
 			expectedErr:     apierrors.NewBadRequestApiError("test"),
 			setupMocks: func(paymentRepoMock *RepositoryMock) {
-				paymentRepoMock.On("GetAllPayments", mock.Anything).Return(nil, apierrors.NewBadRequestApiError("test"))
+				paymentRepoMock.On("GetAllPayments", mock.Anything, mock.Anything).Return(nil, apierrors.NewBadRequestApiError("test"))
 			},
 		},
 	}
@@ -208,37 +295,225 @@ func TestGetAllPayments(t *testing.T) {
 			tt.setupMocks(paymentRepoMock)
 
 			paymentService := NewService(nil, paymentRepoMock)
-			payments, err := paymentService.GetAllPayments(d.TestContext())
+			payments, err := paymentService.GetAllPayments(d.TestContext(), domain.PaymentFilter{Limit: domain.DefaultPageSize})
 			require.Equal(t, tt.expectedErr, err)
 			if tt.expectedErr == nil {
-				require.Equal(t, tt.expectedPayment, *payments.Response().(*[]database.Payment))
+				require.Equal(t, tt.expectedPayment, payments.Response().(*domain.PaymentsPage).Data)
 			}
 		})
 	}
 }
 
 func TestRefundPayment(t *testing.T) {
+	id, _ := uuid.NewV7()
+	i := id.String()
+	partialAmount := money.MustParse("40")
+	exceededAmount := money.MustParse("100.01")
+	tests := []struct {
+		name           string
+		refundRequest  domain.RefundRequest
+		expectedErr    apierrors.ApiError
+		expectedStatus int
+		setupMocks     func(paymentRepoMock *RepositoryMock, bankRepo *bank.ConnectorMock)
+	}{
+		{
+			name:           "Happy path",
+			expectedErr:    nil,
+			expectedStatus: defines.REFUNDED_STATUS,
+			setupMocks: func(paymentRepoMock *RepositoryMock, bankRepo *bank.ConnectorMock) {
+				paymentRepoMock.On("GetPaymentByID", mock.Anything, mock.Anything).Return(&database.Payment{Amount: money.MustParse("100"), Status: defines.APPROVED_STATUS, OperationID: &i}, nil)
+				paymentRepoMock.On("ReserveRefund", mock.Anything, mock.Anything, money.MustParse("100")).Return(nil)
+				bankRepo.On("RefundPayment", mock.Anything, mock.Anything, money.MustParse("100")).Return(nil)
+				paymentRepoMock.On("AddRefund", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+			},
+		},
+		{
+			name:           "Partial refund",
+			refundRequest:  domain.RefundRequest{Amount: &partialAmount, Reason: "one item was returned"},
+			expectedErr:    nil,
+			expectedStatus: defines.PARTIALLY_REFUNDED_STATUS,
+			setupMocks: func(paymentRepoMock *RepositoryMock, bankRepo *bank.ConnectorMock) {
+				paymentRepoMock.On("GetPaymentByID", mock.Anything, mock.Anything).Return(&database.Payment{Amount: money.MustParse("100"), Status: defines.APPROVED_STATUS, OperationID: &i}, nil)
+				paymentRepoMock.On("ReserveRefund", mock.Anything, mock.Anything, partialAmount).Return(nil)
+				bankRepo.On("RefundPayment", mock.Anything, mock.Anything, partialAmount).Return(nil)
+				paymentRepoMock.On("AddRefund", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+			},
+		},
+		{
+			name:           "Remaining balance of a partially refunded payment",
+			expectedErr:    nil,
+			expectedStatus: defines.REFUNDED_STATUS,
+			setupMocks: func(paymentRepoMock *RepositoryMock, bankRepo *bank.ConnectorMock) {
+				paymentRepoMock.On("GetPaymentByID", mock.Anything, mock.Anything).Return(&database.Payment{Amount: money.MustParse("100"), RefundedAmount: money.MustParse("40"), Status: defines.PARTIALLY_REFUNDED_STATUS, OperationID: &i}, nil)
+				paymentRepoMock.On("ReserveRefund", mock.Anything, mock.Anything, money.MustParse("60")).Return(nil)
+				bankRepo.On("RefundPayment", mock.Anything, mock.Anything, money.MustParse("60")).Return(nil)
+				paymentRepoMock.On("AddRefund", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+			},
+		},
+		{
+			name:          "Refund exceeds the remaining balance",
+			refundRequest: domain.RefundRequest{Amount: &exceededAmount},
+			expectedErr:   apierrors.NewBadRequestApiError("refund amount exceeds the remaining balance of the payment"),
+			setupMocks: func(paymentRepoMock *RepositoryMock, bankRepo *bank.ConnectorMock) {
+				paymentRepoMock.On("GetPaymentByID", mock.Anything, mock.Anything).Return(&database.Payment{Amount: money.MustParse("100"), Status: defines.APPROVED_STATUS, OperationID: &i}, nil)
+			},
+		},
+		{
+			name:          "A concurrent refund reserved what was left",
+			refundRequest: domain.RefundRequest{Amount: &partialAmount},
+			expectedErr:   apierrors.NewBadRequestApiError("refund amount exceeds the remaining balance of the payment"),
+			setupMocks: func(paymentRepoMock *RepositoryMock, bankRepo *bank.ConnectorMock) {
+				paymentRepoMock.On("GetPaymentByID", mock.Anything, mock.Anything).Return(&database.Payment{Amount: money.MustParse("100"), Status: defines.APPROVED_STATUS, OperationID: &i}, nil)
+				paymentRepoMock.On("ReserveRefund", mock.Anything, mock.Anything, partialAmount).Return(apierrors.NewBadRequestApiError("refund amount exceeds the remaining balance of the payment"))
+			},
+		},
+		{
+			name:        "The bank fails the refund and the reservation is released",
+			expectedErr: apierrors.NewInternalServerApiError("bank error", nil),
+			setupMocks: func(paymentRepoMock *RepositoryMock, bankRepo *bank.ConnectorMock) {
+				paymentRepoMock.On("GetPaymentByID", mock.Anything, mock.Anything).Return(&database.Payment{Amount: money.MustParse("100"), RefundedAmount: money.MustParse("40"), RefundingAmount: money.MustParse("20"), Status: defines.PARTIALLY_REFUNDED_STATUS, OperationID: &i}, nil)
+				paymentRepoMock.On("ReserveRefund", mock.Anything, mock.Anything, partialAmount).Return(nil)
+				bankRepo.On("RefundPayment", mock.Anything, mock.Anything, partialAmount).Return(apierrors.NewInternalServerApiError("bank error", nil))
+				paymentRepoMock.On("ReleaseRefund", mock.Anything, mock.Anything, partialAmount).Return(nil)
+			},
+		},
+		{
+			name:        "Repository error",
+			expectedErr: apierrors.NewBadRequestApiError("test"),
+			setupMocks: func(paymentRepoMock *RepositoryMock, bankRepo *bank.ConnectorMock) {
+				paymentRepoMock.On("GetPaymentByID", mock.Anything, mock.Anything).Return(nil, apierrors.NewBadRequestApiError("test"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paymentRepoMock := new(RepositoryMock)
+			bankRepo := new(bank.ConnectorMock)
+			tt.setupMocks(paymentRepoMock, bankRepo)
+
+			paymentService := NewService(&bank.RegistryMock{Connector: bankRepo}, paymentRepoMock)
+			payments, err := paymentService.RefundPayment(d.TestContext(), 1, tt.refundRequest)
+			require.Equal(t, tt.expectedErr, err)
+			if tt.expectedErr == nil {
+				require.Equal(t, tt.expectedStatus, payments.Response().(*database.Payment).Status)
+			}
+			bankRepo.AssertExpectations(t)
+			paymentRepoMock.AssertExpectations(t)
+		})
+	}
+
+}
+
+func TestCapturePayment(t *testing.T) {
+	id, _ := uuid.NewV7()
+	i := id.String()
+	partialAmount := money.MustParse("60")
+	exceededAmount := money.MustParse("150")
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name           string
+		captureRequest domain.CaptureRequest
+		expectedErr    apierrors.ApiError
+		expectedAmount money.Amount
+		setupMocks     func(paymentRepoMock *RepositoryMock, bankRepo *bank.ConnectorMock)
+	}{
+		{
+			name:           "Happy path",
+			expectedErr:    nil,
+			expectedAmount: money.MustParse("100"),
+			setupMocks: func(paymentRepoMock *RepositoryMock, bankRepo *bank.ConnectorMock) {
+				paymentRepoMock.On("GetPaymentByID", mock.Anything, mock.Anything).Return(&database.Payment{Amount: money.MustParse("100"), AuthorizedAmount: money.MustParse("100"), Status: defines.AUTHORIZED_STATUS, OperationID: &i, AuthorizationExpiresAt: &future}, nil)
+				bankRepo.On("Capture", mock.Anything, i, money.MustParse("100")).Return(nil)
+				paymentRepoMock.On("ChangePaymentStatus", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+			},
+		},
+		{
+			name:           "Partial capture",
+			captureRequest: domain.CaptureRequest{Amount: &partialAmount},
+			expectedErr:    nil,
+			expectedAmount: partialAmount,
+			setupMocks: func(paymentRepoMock *RepositoryMock, bankRepo *bank.ConnectorMock) {
+				paymentRepoMock.On("GetPaymentByID", mock.Anything, mock.Anything).Return(&database.Payment{Amount: money.MustParse("100"), AuthorizedAmount: money.MustParse("100"), Status: defines.AUTHORIZED_STATUS, OperationID: &i, AuthorizationExpiresAt: &future}, nil)
+				bankRepo.On("Capture", mock.Anything, i, partialAmount).Return(nil)
+				paymentRepoMock.On("ChangePaymentStatus", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+			},
+		},
+		{
+			name:           "Capture exceeds the authorized amount",
+			captureRequest: domain.CaptureRequest{Amount: &exceededAmount},
+			expectedErr:    apierrors.NewBadRequestApiError("capture amount exceeds the authorized amount"),
+			setupMocks: func(paymentRepoMock *RepositoryMock, bankRepo *bank.ConnectorMock) {
+				paymentRepoMock.On("GetPaymentByID", mock.Anything, mock.Anything).Return(&database.Payment{Amount: money.MustParse("100"), AuthorizedAmount: money.MustParse("100"), Status: defines.AUTHORIZED_STATUS, OperationID: &i, AuthorizationExpiresAt: &future}, nil)
+			},
+		},
+		{
+			name:        "Expired authorization",
+			expectedErr: apierrors.NewBadRequestApiError("the authorization has expired"),
+			setupMocks: func(paymentRepoMock *RepositoryMock, bankRepo *bank.ConnectorMock) {
+				paymentRepoMock.On("GetPaymentByID", mock.Anything, mock.Anything).Return(&database.Payment{Amount: money.MustParse("100"), AuthorizedAmount: money.MustParse("100"), Status: defines.AUTHORIZED_STATUS, OperationID: &i, AuthorizationExpiresAt: &past}, nil)
+				bankRepo.On("Void", mock.Anything, i).Return(nil)
+				paymentRepoMock.On("ChangePaymentStatus", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+			},
+		},
+		{
+			name:        "Payment is not authorized",
+			expectedErr: apierrors.NewBadRequestApiError("only authorized payments can be captured"),
+			setupMocks: func(paymentRepoMock *RepositoryMock, bankRepo *bank.ConnectorMock) {
+				paymentRepoMock.On("GetPaymentByID", mock.Anything, mock.Anything).Return(&database.Payment{Amount: money.MustParse("100"), Status: defines.APPROVED_STATUS, OperationID: &i}, nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paymentRepoMock := new(RepositoryMock)
+			bankRepo := new(bank.ConnectorMock)
+			tt.setupMocks(paymentRepoMock, bankRepo)
+
+			paymentService := NewService(&bank.RegistryMock{Connector: bankRepo}, paymentRepoMock)
+			payment, err := paymentService.CapturePayment(d.TestContext(), 1, tt.captureRequest)
+			require.Equal(t, tt.expectedErr, err)
+			if tt.expectedErr == nil {
+				require.Equal(t, defines.APPROVED_STATUS, payment.Response().(*database.Payment).Status)
+				require.Equal(t, tt.expectedAmount, payment.Response().(*database.Payment).Amount)
+			}
+			bankRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestVoidPayment(t *testing.T) {
 	id, _ := uuid.NewV7()
 	i := id.String()
 	tests := []struct {
 		name        string
 		expectedErr apierrors.ApiError
-		setupMocks  func(paymentRepoMock *RepositoryMock, bankRepo *bank.RepositoryMock)
+		setupMocks  func(paymentRepoMock *RepositoryMock, bankRepo *bank.ConnectorMock)
 	}{
 		{
 			name:        "Happy path",
 			expectedErr: nil,
-			setupMocks: func(paymentRepoMock *RepositoryMock, bankRepo *bank.RepositoryMock) {
-				paymentRepoMock.On("GetPaymentByID", mock.Anything, mock.Anything).Return(&database.Payment{Status: defines.APPROVED_STATUS, OperationID: &i}, nil)
-				bankRepo.On("RefundPayment", mock.Anything, mock.Anything).Return(nil)
-				paymentRepoMock.On("ChangePaymentStatus", mock.Anything, mock.Anything).Return(nil)
+			setupMocks: func(paymentRepoMock *RepositoryMock, bankRepo *bank.ConnectorMock) {
+				paymentRepoMock.On("GetPaymentByID", mock.Anything, mock.Anything).Return(&database.Payment{Amount: money.MustParse("100"), Status: defines.AUTHORIZED_STATUS, OperationID: &i}, nil)
+				bankRepo.On("Void", mock.Anything, i).Return(nil)
+				paymentRepoMock.On("ChangePaymentStatus", mock.Anything, mock.Anything, mock.Anything).Return(nil)
 			},
 		},
 		{
-			name:        "Repository error",
+			name:        "Payment is not authorized",
+			expectedErr: apierrors.NewBadRequestApiError("only authorized payments can be voided"),
+			setupMocks: func(paymentRepoMock *RepositoryMock, bankRepo *bank.ConnectorMock) {
+				paymentRepoMock.On("GetPaymentByID", mock.Anything, mock.Anything).Return(&database.Payment{Amount: money.MustParse("100"), Status: defines.APPROVED_STATUS, OperationID: &i}, nil)
+			},
+		},
+		{
+			name:        "Bank error",
 			expectedErr: apierrors.NewBadRequestApiError("test"),
-			setupMocks: func(paymentRepoMock *RepositoryMock, bankRepo *bank.RepositoryMock) {
-				paymentRepoMock.On("GetPaymentByID", mock.Anything, mock.Anything).Return(nil, apierrors.NewBadRequestApiError("test"))
+			setupMocks: func(paymentRepoMock *RepositoryMock, bankRepo *bank.ConnectorMock) {
+				paymentRepoMock.On("GetPaymentByID", mock.Anything, mock.Anything).Return(&database.Payment{Amount: money.MustParse("100"), Status: defines.AUTHORIZED_STATUS, OperationID: &i}, nil)
+				bankRepo.On("Void", mock.Anything, i).Return(apierrors.NewBadRequestApiError("test"))
 			},
 		},
 	}
@@ -246,16 +521,198 @@ func TestRefundPayment(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			paymentRepoMock := new(RepositoryMock)
-			bankRepo := new(bank.RepositoryMock)
+			bankRepo := new(bank.ConnectorMock)
 			tt.setupMocks(paymentRepoMock, bankRepo)
 
-			paymentService := NewService(bankRepo, paymentRepoMock)
-			payments, err := paymentService.RefundPayment(d.TestContext(), 1)
+			paymentService := NewService(&bank.RegistryMock{Connector: bankRepo}, paymentRepoMock)
+			payment, err := paymentService.VoidPayment(d.TestContext(), 1)
+			require.Equal(t, tt.expectedErr, err)
+			if tt.expectedErr == nil {
+				require.Equal(t, defines.CANCELLED_STATUS, payment.Response().(*database.Payment).Status)
+			}
+		})
+	}
+}
+
+func TestRecoverPendingPayments(t *testing.T) {
+	tests := []struct {
+		name             string
+		operation        *d.BankOperation
+		operationErr     apierrors.ApiError
+		reversalErr      apierrors.ApiError
+		expectedStatus   int
+		expectedCode     string
+		expectedReversal string
+	}{
+		{
+			name:           "Approved by the bank",
+			operation:      &d.BankOperation{OperationID: "op", Status: sdefines.OPERATION_APPROVED},
+			expectedStatus: defines.APPROVED_STATUS,
+			expectedCode:   iso8583.Approved,
+		},
+		{
+			name:           "Authorized by the bank",
+			operation:      &d.BankOperation{OperationID: "op", Status: sdefines.OPERATION_AUTHORIZED},
+			expectedStatus: defines.AUTHORIZED_STATUS,
+			expectedCode:   iso8583.Approved,
+		},
+		{
+			name:           "Declined by the bank",
+			operation:      &d.BankOperation{Status: sdefines.OPERATION_DECLINED, Error: d.NewBankError(http.StatusBadRequest, sdefines.INVALID_CARD_DECLINE, sdefines.INVALID_CARD_HASH, false)},
+			expectedStatus: defines.REJECTED_STATUS,
+			expectedCode:   "1011",
+		},
+		{
+			name:             "The bank has no answer",
+			operationErr:     apierrors.NewNotFoundApiError("operation not found"),
+			expectedStatus:   defines.REVERSAL_STATUS,
+			expectedReversal: defines.REVERSAL_CONFIRMED,
+		},
+		{
+			name:             "The bank can't look up operations",
+			operationErr:     apierrors.NewApiError("the ISO 8583 link can't look up operations", "not_supported", http.StatusNotImplemented, nil),
+			expectedStatus:   defines.REVERSAL_STATUS,
+			expectedReversal: defines.REVERSAL_CONFIRMED,
+		},
+		{
+			name:           "The bank can't be asked",
+			operationErr:   apierrors.NewApiError("can't fetch the operation", "", http.StatusBadGateway, nil),
+			expectedStatus: defines.PENDING_STATUS,
+		},
+		{
+			name:             "The reversal fails and it's queued",
+			operationErr:     apierrors.NewNotFoundApiError("operation not found"),
+			reversalErr:      apierrors.NewInternalServerApiError("something happened reversing", nil),
+			expectedStatus:   defines.REVERSAL_STATUS,
+			expectedReversal: defines.REVERSAL_PENDING,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payment := &database.Payment{Base: database.Base{ID: 1}, Status: defines.PENDING_STATUS, Reference: "ref"}
+
+			paymentRepoMock := new(RepositoryMock)
+			bankRepo := new(bank.ConnectorMock)
+			paymentRepoMock.On("GetStalePendingPayments", mock.Anything, mock.Anything).Return(&[]database.Payment{*payment}, nil)
+			if tt.operationErr != nil {
+				bankRepo.On("GetOperation", mock.Anything, "ref").Return(nil, tt.operationErr)
+				if tt.expectedStatus == defines.REVERSAL_STATUS {
+					bankRepo.On("ReverseOperation", mock.Anything, "ref").Return(tt.reversalErr)
+				}
+			} else {
+				bankRepo.On("GetOperation", mock.Anything, "ref").Return(tt.operation, nil)
+			}
+
+			var updated *database.Payment
+			var queued *database.Reversal
+			paymentRepoMock.On("ChangePaymentStatus", mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+				updated = args.Get(1).(*database.Payment)
+			}).Return(nil)
+			paymentRepoMock.On("ReversePayment", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+				updated = args.Get(1).(*database.Payment)
+				queued = args.Get(2).(*database.Reversal)
+			}).Return(nil)
+
+			paymentService := NewService(&bank.RegistryMock{Connector: bankRepo}, paymentRepoMock)
+			err := paymentService.RecoverPendingPayments(d.TestContext())
+			require.Nil(t, err)
+			bankRepo.AssertExpectations(t)
+
+			if tt.expectedStatus == defines.PENDING_STATUS {
+				require.Nil(t, updated)
+				paymentRepoMock.AssertNotCalled(t, "ChangePaymentStatus", mock.Anything, mock.Anything, mock.Anything)
+				return
+			}
+
+			require.NotNil(t, updated)
+			require.Equal(t, tt.expectedReversal, updated.ReversalStatus)
+			require.Equal(t, tt.reversalErr != nil, queued != nil)
+			require.Equal(t, tt.expectedStatus, updated.Status)
+			require.Equal(t, tt.expectedCode, updated.Code)
+			if tt.operation != nil && tt.operation.OperationID != "" {
+				require.Equal(t, tt.operation.OperationID, *updated.OperationID)
+			}
+		})
+	}
+}
+
+func TestGetPaymentTimeline(t *testing.T) {
+	tests := []struct {
+		name            string
+		expectedHistory []database.PaymentStatusHistory
+		expectedErr     apierrors.ApiError
+		setupMocks      func(paymentRepoMock *RepositoryMock)
+	}{
+		{
+			name:            "Happy path",
+			expectedHistory: []database.PaymentStatusHistory{{PaymentID: 1, ToStatus: defines.APPROVED_STATUS}},
+			expectedErr:     nil,
+			setupMocks: func(paymentRepoMock *RepositoryMock) {
+				paymentRepoMock.On("GetPaymentByID", mock.Anything, mock.Anything).Return(&database.Payment{}, nil)
+				paymentRepoMock.On("GetPaymentStatusHistory", mock.Anything, mock.Anything).Return(&[]database.PaymentStatusHistory{{PaymentID: 1, ToStatus: defines.APPROVED_STATUS}}, nil)
+			},
+		},
+		{
+			name:        "Payment not found",
+			expectedErr: apierrors.NewNotFoundApiError("error, payment not found"),
+			setupMocks: func(paymentRepoMock *RepositoryMock) {
+				paymentRepoMock.On("GetPaymentByID", mock.Anything, mock.Anything).Return(nil, apierrors.NewNotFoundApiError("error, payment not found"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paymentRepoMock := new(RepositoryMock)
+
+			tt.setupMocks(paymentRepoMock)
+
+			paymentService := NewService(nil, paymentRepoMock)
+			history, err := paymentService.GetPaymentTimeline(d.TestContext(), 1)
 			require.Equal(t, tt.expectedErr, err)
 			if tt.expectedErr == nil {
-				require.Equal(t, defines.REFUNDED_STATUS, payments.Response().(*database.Payment).Status)
+				require.Equal(t, tt.expectedHistory, *history.Response().(*[]database.PaymentStatusHistory))
 			}
 		})
 	}
+}
+
+func TestGetMerchantSummary(t *testing.T) {
+	paymentRepoMock := new(RepositoryMock)
+	paymentRepoMock.On("GetMerchantSummary", mock.Anything, uint64(1), mock.Anything).Return(&[]domain.CurrencySummary{
+		{Currency: "MXN", PaymentsCount: 4, ApprovedCount: 2, RejectedCount: 1, Volume: money.MustParse("150.50")},
+		{Currency: "USD", PaymentsCount: 1},
+	}, nil)
+
+	paymentService := NewService(nil, paymentRepoMock)
+	res, err := paymentService.GetMerchantSummary(d.TestContext(), 1, domain.PaymentFilter{})
+	require.Nil(t, err)
+
+	summary := res.Response().(domain.MerchantSummary)
+	require.Equal(t, uint64(1), summary.MerchantID)
+	require.Len(t, summary.Currencies, 2)
+	require.Equal(t, 0.6667, summary.Currencies[0].ApprovalRate)
+	require.Equal(t, 0.0, summary.Currencies[1].ApprovalRate)
+}
+
+func TestPayPicksTheConnectorOfTheBank(t *testing.T) {
+	santander := new(bank.ConnectorMock)
+	bbva := new(bank.ConnectorMock)
+	banks := bank.NewStaticRegistry(map[uint64]bank.BankConnector{1: santander, 2: bbva})
+
+	paymentRepoMock := new(RepositoryMock)
+	paymentRepoMock.On("GetMerchantByID", mock.Anything, mock.Anything).Return(&database.Merchant{}, nil)
+	paymentRepoMock.On("AddPayment", mock.Anything, mock.Anything).Return(nil)
+	paymentRepoMock.On("ChangePaymentStatus", mock.Anything, mock.Anything, "bank answer").Return(nil)
+	bbva.On("Pay", mock.Anything, mock.Anything).Return("op", nil)
+
+	paymentService := NewService(banks, paymentRepoMock)
+	_, apierr := paymentService.Pay(d.TestContext(), domain.PaymentRequest{BankID: 2, Currency: "USD", Amount: money.MustParse("10")})
+	require.Nil(t, apierr)
+	bbva.AssertExpectations(t)
+	santander.AssertNotCalled(t, "Pay", mock.Anything, mock.Anything)
 
+	_, apierr = paymentService.Pay(d.TestContext(), domain.PaymentRequest{BankID: 4, Currency: "USD", Amount: money.MustParse("10")})
+	require.Equal(t, apierrors.NewBadRequestApiError("invalid bank id"), apierr)
 }
@@ -0,0 +1,17 @@
+package payment
+
+import (
+	d "github.com/negarciacamilo/deuna_challenge/application/domain"
+	"github.com/negarciacamilo/deuna_challenge/application/logger"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/worker"
+	"time"
+)
+
+// StartPendingPaymentSweeper periodically resolves the payments that were left pending
+func StartPendingPaymentSweeper(service Service, interval time.Duration) {
+	worker.Every(interval, 30*time.Second, func(ctx *d.ContextInformation) {
+		if apierr := service.RecoverPendingPayments(ctx); apierr != nil {
+			logger.Error("error recovering pending payments", "pending-payment-sweeper", apierr, ctx)
+		}
+	})
+}
@@ -0,0 +1,50 @@
+package reversal
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/negarciacamilo/deuna_challenge/application/context"
+	"github.com/negarciacamilo/deuna_challenge/application/response"
+)
+
+type Handler interface {
+	GetReversals(c *gin.Context)
+	RetryReversal(c *gin.Context)
+}
+
+type handler struct {
+	service Service
+}
+
+func NewHandler(service Service) Handler {
+	return &handler{
+		service: service,
+	}
+}
+
+func (h *handler) GetReversals(c *gin.Context) {
+	ctx := context.GetContextInformation(c)
+	if apierr := context.RequireOperator(ctx); apierr != nil {
+		response.Respond(ctx, nil, apierr)
+		return
+	}
+
+	r, apierr := h.service.GetReversals(ctx, c.Query("status"), c.Query("failing") == "true")
+	response.Respond(ctx, r, apierr)
+}
+
+func (h *handler) RetryReversal(c *gin.Context) {
+	ctx := context.GetContextInformation(c)
+	if apierr := context.RequireOperator(ctx); apierr != nil {
+		response.Respond(ctx, nil, apierr)
+		return
+	}
+
+	reversalID, apierr := context.ParseParamToUInt(ctx, "reversal_id")
+	if apierr != nil {
+		response.Respond(ctx, nil, apierr)
+		return
+	}
+
+	r, apierr := h.service.RetryReversal(ctx, reversalID)
+	response.Respond(ctx, r, apierr)
+}
@@ -0,0 +1,136 @@
+package reversal
+
+import (
+	"context"
+	"github.com/negarciacamilo/deuna_challenge/application/apierrors"
+	d "github.com/negarciacamilo/deuna_challenge/application/domain"
+	dbd "github.com/negarciacamilo/deuna_challenge/application/domain/database"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/database"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/defines"
+	"github.com/uptrace/bun"
+	"time"
+)
+
+type Repository interface {
+	ClaimDueReversals(ctx *d.ContextInformation, now time.Time, lease time.Duration, limit int) (*[]dbd.Reversal, apierrors.ApiError)
+	ClaimReversal(ctx *d.ContextInformation, id uint64, now time.Time, lease time.Duration) (*dbd.Reversal, apierrors.ApiError)
+	ConfirmReversal(ctx *d.ContextInformation, reversal *dbd.Reversal) apierrors.ApiError
+	UpdateReversal(ctx *d.ContextInformation, reversal *dbd.Reversal) apierrors.ApiError
+	GetReversals(ctx *d.ContextInformation, status string, minAttempts int) (*[]dbd.Reversal, apierrors.ApiError)
+	GetReversalByID(ctx *d.ContextInformation, id uint64) (*dbd.Reversal, apierrors.ApiError)
+}
+
+type repository struct {
+	db database.Database
+}
+
+func NewRepository(db database.Database) Repository {
+	return &repository{
+		db: db,
+	}
+}
+
+// ClaimDueReversals leases the pending reversals whose next attempt is due, so two workers don't retry the same one
+func (r *repository) ClaimDueReversals(ctx *d.ContextInformation, now time.Time, lease time.Duration, limit int) (*[]dbd.Reversal, apierrors.ApiError) {
+	db := r.db.GetDB()
+	due := db.NewSelect().Model((*dbd.Reversal)(nil)).Column("id").
+		Where("status = ?", defines.REVERSAL_PENDING).
+		Where("next_attempt_at <= ?", now).
+		OrderExpr("next_attempt_at ASC").
+		Limit(limit).For("UPDATE SKIP LOCKED")
+
+	reversals := make([]dbd.Reversal, 0)
+	_, err := db.NewUpdate().Model((*dbd.Reversal)(nil)).
+		Set("next_attempt_at = ?", now.Add(lease)).
+		Where("id IN (?)", due).
+		Returning("*").Exec(ctx.GetCtx(), &reversals)
+	if err != nil {
+		return nil, r.db.HandleDBError(ctx, "reversals", database.Updating, err)
+	}
+
+	return &reversals, nil
+}
+
+// ClaimReversal leases a pending reversal whether it's due or not, it returns nil if it's confirmed or someone else is
+// claiming it right now
+func (r *repository) ClaimReversal(ctx *d.ContextInformation, id uint64, now time.Time, lease time.Duration) (*dbd.Reversal, apierrors.ApiError) {
+	db := r.db.GetDB()
+	pending := db.NewSelect().Model((*dbd.Reversal)(nil)).Column("id").
+		Where("id = ?", id).
+		Where("status = ?", defines.REVERSAL_PENDING).
+		For("UPDATE SKIP LOCKED")
+
+	reversals := make([]dbd.Reversal, 0, 1)
+	_, err := db.NewUpdate().Model((*dbd.Reversal)(nil)).
+		Set("next_attempt_at = ?", now.Add(lease)).
+		Where("id IN (?)", pending).
+		Returning("*").Exec(ctx.GetCtx(), &reversals)
+	if err != nil {
+		return nil, r.db.HandleDBError(ctx, "reversals", database.Updating, err)
+	}
+
+	if len(reversals) == 0 {
+		return nil, nil
+	}
+	return &reversals[0], nil
+}
+
+// ConfirmReversal marks both the reversal and its payment as confirmed
+func (r *repository) ConfirmReversal(ctx *d.ContextInformation, reversal *dbd.Reversal) apierrors.ApiError {
+	err := r.db.GetDB().RunInTx(ctx.GetCtx(), nil, func(c context.Context, tx bun.Tx) error {
+		_, err := tx.NewUpdate().Model(reversal).
+			Column("status", "attempts", "next_attempt_at", "last_error", "confirmed_at").
+			Where("id = ?", reversal.ID).Exec(c)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.NewUpdate().Model((*dbd.Payment)(nil)).
+			Set("reversal_status = ?", defines.REVERSAL_CONFIRMED).
+			Where("id = ?", reversal.PaymentID).Exec(c)
+		return err
+	})
+	if err != nil {
+		return r.db.HandleDBError(ctx, "reversals", database.Updating, err)
+	}
+
+	return nil
+}
+
+func (r *repository) UpdateReversal(ctx *d.ContextInformation, reversal *dbd.Reversal) apierrors.ApiError {
+	_, err := r.db.GetDB().NewUpdate().Model(reversal).
+		Column("attempts", "next_attempt_at", "last_error").
+		Where("id = ?", reversal.ID).Exec(ctx.GetCtx())
+	if err != nil {
+		return r.db.HandleDBError(ctx, "reversals", database.Updating, err)
+	}
+
+	return nil
+}
+
+func (r *repository) GetReversals(ctx *d.ContextInformation, status string, minAttempts int) (*[]dbd.Reversal, apierrors.ApiError) {
+	reversals := make([]dbd.Reversal, 0)
+	query := r.db.GetDB().NewSelect().Model(&reversals)
+	if status != "" {
+		query.Where("status = ?", status)
+	}
+
+	if minAttempts > 0 {
+		query.Where("attempts >= ?", minAttempts)
+	}
+
+	if err := query.Order("id DESC").Limit(100).Scan(ctx.GetCtx()); err != nil {
+		return nil, r.db.HandleDBError(ctx, "reversals", database.Fetching, err)
+	}
+
+	return &reversals, nil
+}
+
+func (r *repository) GetReversalByID(ctx *d.ContextInformation, id uint64) (*dbd.Reversal, apierrors.ApiError) {
+	var reversal dbd.Reversal
+	if err := r.db.GetDB().NewSelect().Model(&reversal).Where("id = ?", id).Scan(ctx.GetCtx()); err != nil {
+		return nil, r.db.HandleDBError(ctx, "reversal", database.Fetching, err)
+	}
+
+	return &reversal, nil
+}
@@ -0,0 +1,71 @@
+package reversal
+
+import (
+	"github.com/negarciacamilo/deuna_challenge/application/apierrors"
+	d "github.com/negarciacamilo/deuna_challenge/application/domain"
+	"github.com/negarciacamilo/deuna_challenge/application/domain/database"
+	"github.com/stretchr/testify/mock"
+	"time"
+)
+
+type RepositoryMock struct {
+	mock.Mock
+}
+
+func (r *RepositoryMock) ClaimDueReversals(ctx *d.ContextInformation, now time.Time, lease time.Duration, limit int) (*[]database.Reversal, apierrors.ApiError) {
+	args := r.Called(ctx, now, lease, limit)
+	err := args.Get(1)
+	if err != nil {
+		return nil, err.(apierrors.ApiError)
+	}
+	return args.Get(0).(*[]database.Reversal), nil
+}
+
+func (r *RepositoryMock) ClaimReversal(ctx *d.ContextInformation, id uint64, now time.Time, lease time.Duration) (*database.Reversal, apierrors.ApiError) {
+	args := r.Called(ctx, id, now, lease)
+	err := args.Get(1)
+	if err != nil {
+		return nil, err.(apierrors.ApiError)
+	}
+	reversal := args.Get(0)
+	if reversal == nil {
+		return nil, nil
+	}
+	return reversal.(*database.Reversal), nil
+}
+
+func (r *RepositoryMock) ConfirmReversal(ctx *d.ContextInformation, reversal *database.Reversal) apierrors.ApiError {
+	args := r.Called(ctx, reversal)
+	err := args.Get(0)
+	if err != nil {
+		return err.(apierrors.ApiError)
+	}
+	return nil
+}
+
+func (r *RepositoryMock) UpdateReversal(ctx *d.ContextInformation, reversal *database.Reversal) apierrors.ApiError {
+	args := r.Called(ctx, reversal)
+	err := args.Get(0)
+	if err != nil {
+		return err.(apierrors.ApiError)
+	}
+	return nil
+}
+
+func (r *RepositoryMock) GetReversals(ctx *d.ContextInformation, status string, minAttempts int) (*[]database.Reversal, apierrors.ApiError) {
+	args := r.Called(ctx, status, minAttempts)
+	err := args.Get(1)
+	if err != nil {
+		return nil, err.(apierrors.ApiError)
+	}
+	return args.Get(0).(*[]database.Reversal), nil
+}
+
+func (r *RepositoryMock) GetReversalByID(ctx *d.ContextInformation, id uint64) (*database.Reversal, apierrors.ApiError) {
+	args := r.Called(ctx, id)
+	err := args.Get(1)
+	if err != nil {
+		return nil, err.(apierrors.ApiError)
+	}
+	return args.Get(0).(*database.Reversal), nil
+}
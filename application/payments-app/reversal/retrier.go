@@ -0,0 +1,17 @@
+package reversal
+
+import (
+	d "github.com/negarciacamilo/deuna_challenge/application/domain"
+	"github.com/negarciacamilo/deuna_challenge/application/logger"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/worker"
+	"time"
+)
+
+// StartRetrier periodically retries the queued reversals
+func StartRetrier(service Service, interval time.Duration) {
+	worker.Every(interval, 10*time.Second, func(ctx *d.ContextInformation) {
+		if apierr := service.RetryDueReversals(ctx); apierr != nil {
+			logger.Error("error retrying reversals", "reversal-retrier", apierr, ctx)
+		}
+	})
+}
@@ -0,0 +1,169 @@
+package reversal
+
+import (
+	"fmt"
+	"github.com/negarciacamilo/deuna_challenge/application/apierrors"
+	d "github.com/negarciacamilo/deuna_challenge/application/domain"
+	dbd "github.com/negarciacamilo/deuna_challenge/application/domain/database"
+	"github.com/negarciacamilo/deuna_challenge/application/logger"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/bank"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/defines"
+	"github.com/negarciacamilo/deuna_challenge/application/response"
+	"github.com/spf13/viper"
+	"net/http"
+	"time"
+)
+
+// How many reversals are claimed on every run
+const retryBatchSize = 50
+
+// How long a claimed reversal is left alone, an attempt that takes longer can be claimed again
+const retryLease = time.Minute
+
+type Service interface {
+	RetryDueReversals(ctx *d.ContextInformation) apierrors.ApiError
+	GetReversals(ctx *d.ContextInformation, status string, failing bool) (response.Response, apierrors.ApiError)
+	RetryReversal(ctx *d.ContextInformation, id uint64) (response.Response, apierrors.ApiError)
+}
+
+type service struct {
+	banks              bank.Registry
+	reversalRepository Repository
+}
+
+func NewService(banks bank.Registry, reversalRepository Repository) Service {
+	return &service{
+		banks:              banks,
+		reversalRepository: reversalRepository,
+	}
+}
+
+// New returns the reversal to be queued after the first attempt failed
+func New(payment *dbd.Payment, operationID string, err error) *dbd.Reversal {
+	now := time.Now().UTC()
+	next := now.Add(Backoff(1))
+	return &dbd.Reversal{
+		PaymentID:     payment.ID,
+		BankID:        payment.BankID,
+		OperationID:   operationID,
+		Status:        defines.REVERSAL_PENDING,
+		Attempts:      1,
+		NextAttemptAt: &next,
+		LastError:     err.Error(),
+	}
+}
+
+// RetryDueReversals retries every queued reversal whose next attempt is due
+func (s *service) RetryDueReversals(ctx *d.ContextInformation) apierrors.ApiError {
+	reversals, apierr := s.reversalRepository.ClaimDueReversals(ctx, time.Now().UTC(), retryLease, retryBatchSize)
+	if apierr != nil {
+		return apierr
+	}
+
+	for i := range *reversals {
+		// One failed update shouldn't stop the rest, the lease will expire and it'll be retried
+		_ = s.attempt(ctx, &(*reversals)[i])
+	}
+
+	return nil
+}
+
+func (s *service) GetReversals(ctx *d.ContextInformation, status string, failing bool) (response.Response, apierrors.ApiError) {
+	switch status {
+	case "", defines.REVERSAL_PENDING, defines.REVERSAL_CONFIRMED:
+	default:
+		apierr := apierrors.NewBadRequestApiError(fmt.Sprintf("invalid reversal status %s", status))
+		logger.Error(apierr.Message(), "reversal-service-get-reversals", apierr, ctx, map[string]any{"status": status})
+		return nil, apierr
+	}
+
+	// The failing ones are the pending reversals that have been retried too many times, they need a human
+	minAttempts := 0
+	if failing {
+		status = defines.REVERSAL_PENDING
+		minAttempts = viper.GetInt("REVERSAL_ALERT_ATTEMPTS")
+	}
+
+	reversals, apierr := s.reversalRepository.GetReversals(ctx, status, minAttempts)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	return response.New(http.StatusOK, reversals), nil
+}
+
+// RetryReversal retries a pending reversal right away
+func (s *service) RetryReversal(ctx *d.ContextInformation, id uint64) (response.Response, apierrors.ApiError) {
+	reversal, apierr := s.reversalRepository.GetReversalByID(ctx, id)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	if reversal.Status != defines.REVERSAL_PENDING {
+		apierr = apierrors.NewApiError("the reversal was already confirmed", "reversal_already_confirmed", http.StatusConflict, nil)
+		logger.Error(apierr.Message(), "reversal-service-retry-reversal", apierr, ctx, map[string]any{"reversal_id": id})
+		return nil, apierr
+	}
+
+	// It's leased like the retrier does, so they never ask the bank for the same reversal at the same time
+	reversal, apierr = s.reversalRepository.ClaimReversal(ctx, id, time.Now().UTC(), retryLease)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	if reversal == nil {
+		apierr = apierrors.NewApiError("the reversal is being retried, try again later", "reversal_in_progress", http.StatusConflict, nil)
+		logger.Error(apierr.Message(), "reversal-service-retry-reversal", apierr, ctx, map[string]any{"reversal_id": id})
+		return nil, apierr
+	}
+
+	if apierr = s.attempt(ctx, reversal); apierr != nil {
+		return nil, apierr
+	}
+
+	return response.New(http.StatusOK, reversal), nil
+}
+
+// attempt asks the bank for the reversal again, there's no limit of attempts since the customer money is captured
+// until the bank confirms it
+func (s *service) attempt(ctx *d.ContextInformation, reversal *dbd.Reversal) apierrors.ApiError {
+	now := time.Now().UTC()
+	reversal.Attempts++
+
+	connector, apierr := s.banks.Get(ctx, reversal.BankID)
+	if apierr == nil {
+		apierr = connector.ReverseOperation(ctx, reversal.OperationID)
+	}
+	if apierr == nil {
+		reversal.Status = defines.REVERSAL_CONFIRMED
+		reversal.NextAttemptAt = nil
+		reversal.LastError = ""
+		reversal.ConfirmedAt = &now
+		return s.reversalRepository.ConfirmReversal(ctx, reversal)
+	}
+
+	logger.Error("reversal retry failed", "reversal-retry", apierr, ctx, map[string]any{"reversal_id": reversal.ID, "payment_id": reversal.PaymentID, "attempts": reversal.Attempts})
+	next := now.Add(Backoff(reversal.Attempts))
+	reversal.NextAttemptAt = &next
+	reversal.LastError = apierr.Error()
+	return s.reversalRepository.UpdateReversal(ctx, reversal)
+}
+
+// Backoff returns how long to wait before the next attempt, it doubles on every failed one up to REVERSAL_BACKOFF_MAX
+func Backoff(attempts int) time.Duration {
+	base := viper.GetDuration("REVERSAL_BACKOFF_BASE")
+	if base <= 0 {
+		base = 10 * time.Second
+	}
+
+	maxBackoff := viper.GetDuration("REVERSAL_BACKOFF_MAX")
+	if maxBackoff <= 0 {
+		maxBackoff = time.Hour
+	}
+
+	backoff := base
+	for i := 1; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxBackoff)
+}
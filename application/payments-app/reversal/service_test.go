@@ -0,0 +1,148 @@
+package reversal
+
+import (
+	"github.com/negarciacamilo/deuna_challenge/application/apierrors"
+	d "github.com/negarciacamilo/deuna_challenge/application/domain"
+	"github.com/negarciacamilo/deuna_challenge/application/domain/database"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/bank"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/defines"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryDueReversals(t *testing.T) {
+	tests := []struct {
+		name           string
+		bankErr        apierrors.ApiError
+		expectedStatus string
+		expectedMethod string
+	}{
+		{
+			name:           "The bank confirms the reversal",
+			expectedStatus: defines.REVERSAL_CONFIRMED,
+			expectedMethod: "ConfirmReversal",
+		},
+		{
+			name:           "The bank fails again",
+			bankErr:        apierrors.NewInternalServerApiError("something happened reversing", nil),
+			expectedStatus: defines.REVERSAL_PENDING,
+			expectedMethod: "UpdateReversal",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reversal := database.Reversal{PaymentID: 1, OperationID: "op", Status: defines.REVERSAL_PENDING, Attempts: 3}
+
+			repoMock := new(RepositoryMock)
+			bankMock := new(bank.ConnectorMock)
+			repoMock.On("ClaimDueReversals", mock.Anything, mock.Anything, mock.Anything, retryBatchSize).Return(&[]database.Reversal{reversal}, nil)
+			bankMock.On("ReverseOperation", mock.Anything, "op").Return(tt.bankErr)
+
+			var updated *database.Reversal
+			repoMock.On(tt.expectedMethod, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+				updated = args.Get(1).(*database.Reversal)
+			}).Return(nil)
+
+			apierr := NewService(&bank.RegistryMock{Connector: bankMock}, repoMock).RetryDueReversals(d.BackgroundContext())
+			require.Nil(t, apierr)
+
+			require.NotNil(t, updated)
+			require.Equal(t, tt.expectedStatus, updated.Status)
+			require.Equal(t, 4, updated.Attempts)
+			if tt.bankErr != nil {
+				require.NotNil(t, updated.NextAttemptAt)
+				require.NotEmpty(t, updated.LastError)
+			} else {
+				require.Nil(t, updated.NextAttemptAt)
+				require.NotNil(t, updated.ConfirmedAt)
+			}
+		})
+	}
+}
+
+func TestRetryReversal(t *testing.T) {
+	tests := []struct {
+		name           string
+		stored         database.Reversal
+		claimed        bool
+		expectedStatus int
+	}{
+		{
+			name:           "It's retried right away",
+			stored:         database.Reversal{Base: database.Base{ID: 1}, OperationID: "op", Status: defines.REVERSAL_PENDING},
+			claimed:        true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "The retrier is retrying it",
+			stored:         database.Reversal{Base: database.Base{ID: 1}, OperationID: "op", Status: defines.REVERSAL_PENDING},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "It was already confirmed",
+			stored:         database.Reversal{Base: database.Base{ID: 1}, OperationID: "op", Status: defines.REVERSAL_CONFIRMED},
+			expectedStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repoMock := new(RepositoryMock)
+			bankMock := new(bank.ConnectorMock)
+			repoMock.On("GetReversalByID", mock.Anything, uint64(1)).Return(&tt.stored, nil)
+			if tt.stored.Status == defines.REVERSAL_PENDING {
+				var claimed *database.Reversal
+				if tt.claimed {
+					claimed = &tt.stored
+				}
+				repoMock.On("ClaimReversal", mock.Anything, uint64(1), mock.Anything, retryLease).Return(claimed, nil)
+			}
+			if tt.claimed {
+				bankMock.On("ReverseOperation", mock.Anything, "op").Return(nil)
+				repoMock.On("ConfirmReversal", mock.Anything, mock.Anything).Return(nil)
+			}
+
+			res, apierr := NewService(&bank.RegistryMock{Connector: bankMock}, repoMock).RetryReversal(d.BackgroundContext(), 1)
+			repoMock.AssertExpectations(t)
+			bankMock.AssertExpectations(t)
+			if tt.expectedStatus != http.StatusOK {
+				require.Equal(t, tt.expectedStatus, apierr.Status())
+				return
+			}
+
+			require.Nil(t, apierr)
+			require.Equal(t, defines.REVERSAL_CONFIRMED, res.Response().(*database.Reversal).Status)
+		})
+	}
+}
+
+func TestGetFailingReversals(t *testing.T) {
+	viper.Set("REVERSAL_ALERT_ATTEMPTS", 5)
+
+	repoMock := new(RepositoryMock)
+	repoMock.On("GetReversals", mock.Anything, defines.REVERSAL_PENDING, 5).Return(&[]database.Reversal{}, nil)
+
+	res, apierr := NewService(nil, repoMock).GetReversals(d.BackgroundContext(), "", true)
+	require.Nil(t, apierr)
+	require.Equal(t, http.StatusOK, res.Status())
+	repoMock.AssertExpectations(t)
+
+	_, apierr = NewService(nil, repoMock).GetReversals(d.BackgroundContext(), "unknown", false)
+	require.Equal(t, http.StatusBadRequest, apierr.Status())
+}
+
+func TestBackoff(t *testing.T) {
+	viper.Set("REVERSAL_BACKOFF_BASE", "10s")
+	viper.Set("REVERSAL_BACKOFF_MAX", "1m")
+
+	require.Equal(t, 10*time.Second, Backoff(1))
+	require.Equal(t, 20*time.Second, Backoff(2))
+	require.Equal(t, 40*time.Second, Backoff(3))
+	require.Equal(t, time.Minute, Backoff(4))
+	require.Equal(t, time.Minute, Backoff(100))
+}
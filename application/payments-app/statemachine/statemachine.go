@@ -0,0 +1,106 @@
+package statemachine
+
+import (
+	"fmt"
+	"github.com/negarciacamilo/deuna_challenge/application/apierrors"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/defines"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+/*
+This is the only place where the payment lifecycle is defined. Every status change has to be validated against it, so
+a final status (rejected, refunded, reversed or cancelled) can't be overwritten
+*/
+
+// initialStatuses are the statuses a payment can be created with
+var initialStatuses = map[int]bool{
+	defines.PENDING_STATUS:    true,
+	defines.APPROVED_STATUS:   true,
+	defines.REJECTED_STATUS:   true,
+	defines.AUTHORIZED_STATUS: true,
+}
+
+var transitions = map[int][]int{
+	defines.PENDING_STATUS: {
+		defines.APPROVED_STATUS,
+		defines.REJECTED_STATUS,
+		defines.AUTHORIZED_STATUS,
+		defines.CANCELLED_STATUS,
+		defines.REVERSAL_STATUS,
+	},
+	defines.AUTHORIZED_STATUS: {
+		defines.APPROVED_STATUS,
+		defines.CANCELLED_STATUS,
+		defines.REVERSAL_STATUS,
+	},
+	defines.APPROVED_STATUS: {
+		defines.PARTIALLY_REFUNDED_STATUS,
+		defines.REFUNDED_STATUS,
+		defines.REVERSAL_STATUS,
+	},
+	// Every new partial refund is a transition as well
+	defines.PARTIALLY_REFUNDED_STATUS: {
+		defines.PARTIALLY_REFUNDED_STATUS,
+		defines.REFUNDED_STATUS,
+	},
+}
+
+var names = map[int]string{
+	defines.PENDING_STATUS:            "pending",
+	defines.APPROVED_STATUS:           "approved",
+	defines.CANCELLED_STATUS:          "cancelled",
+	defines.REJECTED_STATUS:           "rejected",
+	defines.REFUNDED_STATUS:           "refunded",
+	defines.REVERSAL_STATUS:           "reversed",
+	defines.PARTIALLY_REFUNDED_STATUS: "partially_refunded",
+	defines.AUTHORIZED_STATUS:         "authorized",
+}
+
+// Name returns the human-readable name of a status
+func Name(status int) string {
+	if name, ok := names[status]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ParseStatus accepts either the name or the number of a status
+func ParseStatus(s string) (int, bool) {
+	for status, name := range names {
+		if strings.EqualFold(name, s) || strconv.Itoa(status) == s {
+			return status, true
+		}
+	}
+	return 0, false
+}
+
+func CanStart(status int) bool {
+	return initialStatuses[status]
+}
+
+func CanTransition(from, to int) bool {
+	for _, status := range transitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateStart returns a conflict error if a payment can't be created with the given status
+func ValidateStart(status int) apierrors.ApiError {
+	if !CanStart(status) {
+		return apierrors.NewApiError(fmt.Sprintf("a payment can't be created as %s", Name(status)), "invalid_status_transition", http.StatusConflict, nil)
+	}
+	return nil
+}
+
+// ValidateTransition returns a conflict error if the transition isn't allowed
+func ValidateTransition(from, to int) apierrors.ApiError {
+	if !CanTransition(from, to) {
+		return apierrors.NewApiError(fmt.Sprintf("a payment can't go from %s to %s", Name(from), Name(to)), "invalid_status_transition", http.StatusConflict, nil)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package statemachine
+
+import (
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/defines"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+func TestValidateTransition(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    int
+		to      int
+		wantErr bool
+	}{
+		{name: "approved can be refunded", from: defines.APPROVED_STATUS, to: defines.REFUNDED_STATUS},
+		{name: "approved can be partially refunded", from: defines.APPROVED_STATUS, to: defines.PARTIALLY_REFUNDED_STATUS},
+		{name: "partially refunded can be refunded again", from: defines.PARTIALLY_REFUNDED_STATUS, to: defines.PARTIALLY_REFUNDED_STATUS},
+		{name: "authorized can be captured", from: defines.AUTHORIZED_STATUS, to: defines.APPROVED_STATUS},
+		{name: "authorized can be voided", from: defines.AUTHORIZED_STATUS, to: defines.CANCELLED_STATUS},
+		{name: "reversed can't be refunded", from: defines.REVERSAL_STATUS, to: defines.REFUNDED_STATUS, wantErr: true},
+		{name: "rejected can't be approved", from: defines.REJECTED_STATUS, to: defines.APPROVED_STATUS, wantErr: true},
+		{name: "refunded can't be reversed", from: defines.REFUNDED_STATUS, to: defines.REVERSAL_STATUS, wantErr: true},
+		{name: "partially refunded can't be reversed", from: defines.PARTIALLY_REFUNDED_STATUS, to: defines.REVERSAL_STATUS, wantErr: true},
+		{name: "approved can't go back to authorized", from: defines.APPROVED_STATUS, to: defines.AUTHORIZED_STATUS, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apierr := ValidateTransition(tt.from, tt.to)
+			if tt.wantErr {
+				require.NotNil(t, apierr)
+				require.Equal(t, http.StatusConflict, apierr.Status())
+			} else {
+				require.Nil(t, apierr)
+			}
+		})
+	}
+}
+
+func TestValidateStart(t *testing.T) {
+	require.Nil(t, ValidateStart(defines.APPROVED_STATUS))
+	require.Nil(t, ValidateStart(defines.AUTHORIZED_STATUS))
+	require.NotNil(t, ValidateStart(defines.REFUNDED_STATUS))
+}
@@ -0,0 +1,17 @@
+package webhook
+
+import (
+	d "github.com/negarciacamilo/deuna_challenge/application/domain"
+	"github.com/negarciacamilo/deuna_challenge/application/logger"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/worker"
+	"time"
+)
+
+// StartDispatcher periodically sends the pending webhook deliveries
+func StartDispatcher(service Service, interval time.Duration) {
+	worker.Every(interval, 5*time.Second, func(ctx *d.ContextInformation) {
+		if apierr := service.DispatchDueDeliveries(ctx); apierr != nil {
+			logger.Error("error dispatching webhooks", "webhook-dispatcher", apierr, ctx)
+		}
+	})
+}
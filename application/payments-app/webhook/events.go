@@ -0,0 +1,86 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/google/uuid"
+	dbd "github.com/negarciacamilo/deuna_challenge/application/domain/database"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/defines"
+	"github.com/uptrace/bun"
+	"time"
+)
+
+// EventForStatus returns the event a merchant is notified with when a payment reaches the given status, statuses
+// without an event return false
+func EventForStatus(status int) (string, bool) {
+	switch status {
+	case defines.APPROVED_STATUS:
+		return defines.PAYMENT_APPROVED_EVENT, true
+	case defines.REJECTED_STATUS:
+		return defines.PAYMENT_REJECTED_EVENT, true
+	case defines.REFUNDED_STATUS, defines.PARTIALLY_REFUNDED_STATUS:
+		return defines.PAYMENT_REFUNDED_EVENT, true
+	case defines.REVERSAL_STATUS:
+		return defines.PAYMENT_REVERSED_EVENT, true
+	case defines.AUTHORIZED_STATUS:
+		return defines.PAYMENT_AUTHORIZED_EVENT, true
+	case defines.CANCELLED_STATUS:
+		return defines.PAYMENT_CANCELLED_EVENT, true
+	}
+	return "", false
+}
+
+// EnqueueDeliveries creates a pending delivery for every endpoint of the merchant subscribed to the payment status
+// event. It must be called within the transaction that changes the status, so a delivery exists if and only if the
+// change was stored
+func EnqueueDeliveries(c context.Context, tx bun.IDB, payment *dbd.Payment) error {
+	eventType, ok := EventForStatus(payment.Status)
+	if !ok {
+		return nil
+	}
+
+	var endpoints []dbd.WebhookEndpoint
+	err := tx.NewSelect().Model(&endpoints).
+		Where("merchant_id = ?", payment.MerchantID).
+		Where("? = ANY(events)", eventType).Scan(c)
+	if err != nil || len(endpoints) == 0 {
+		return err
+	}
+
+	now := time.Now().UTC()
+	event := &dbd.WebhookEvent{
+		ID:        uuid.NewString(),
+		Type:      eventType,
+		CreatedAt: now,
+		Data:      payment,
+	}
+
+	deliveries := make([]dbd.WebhookDelivery, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		deliveries = append(deliveries, dbd.WebhookDelivery{
+			EndpointID:    endpoint.ID,
+			MerchantID:    payment.MerchantID,
+			PaymentID:     payment.ID,
+			Event:         eventType,
+			Payload:       event,
+			Status:        defines.DELIVERY_PENDING,
+			NextAttemptAt: &now,
+		})
+	}
+
+	_, err = tx.NewInsert().Model(&deliveries).Exec(c)
+	return err
+}
+
+// Sign returns the value of the signature header. The merchant can verify it computing the HMAC-SHA256 of
+// "{timestamp}.{body}" with the endpoint secret, the timestamp lets it reject old deliveries being replayed
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	t := timestamp.Unix()
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(fmt.Sprintf("%d.", t)))
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", t, hex.EncodeToString(mac.Sum(nil)))
+}
@@ -0,0 +1,111 @@
+package webhook
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/negarciacamilo/deuna_challenge/application/context"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/domain"
+	"github.com/negarciacamilo/deuna_challenge/application/response"
+)
+
+type Handler interface {
+	CreateEndpoint(c *gin.Context)
+	GetEndpoints(c *gin.Context)
+	DeleteEndpoint(c *gin.Context)
+	GetDeliveries(c *gin.Context)
+	Redeliver(c *gin.Context)
+}
+
+type handler struct {
+	service Service
+}
+
+func NewHandler(service Service) Handler {
+	return &handler{
+		service: service,
+	}
+}
+
+func (h *handler) CreateEndpoint(c *gin.Context) {
+	ctx := context.GetContextInformation(c)
+	merchantID, apierr := context.ParseMerchantParam(ctx, "merchant_id")
+	if apierr != nil {
+		response.Respond(ctx, nil, apierr)
+		return
+	}
+
+	var endpointRequest domain.WebhookEndpointRequest
+	apierr = context.ShouldBindJSON(ctx, &endpointRequest)
+	if apierr != nil {
+		response.Respond(ctx, nil, apierr)
+		return
+	}
+
+	apierr = endpointRequest.Validate(ctx)
+	if apierr != nil {
+		response.Respond(ctx, nil, apierr)
+		return
+	}
+
+	e, apierr := h.service.CreateEndpoint(ctx, merchantID, endpointRequest)
+	response.Respond(ctx, e, apierr)
+}
+
+func (h *handler) GetEndpoints(c *gin.Context) {
+	ctx := context.GetContextInformation(c)
+	merchantID, apierr := context.ParseMerchantParam(ctx, "merchant_id")
+	if apierr != nil {
+		response.Respond(ctx, nil, apierr)
+		return
+	}
+
+	e, apierr := h.service.GetEndpoints(ctx, merchantID)
+	response.Respond(ctx, e, apierr)
+}
+
+func (h *handler) DeleteEndpoint(c *gin.Context) {
+	ctx := context.GetContextInformation(c)
+	merchantID, apierr := context.ParseMerchantParam(ctx, "merchant_id")
+	if apierr != nil {
+		response.Respond(ctx, nil, apierr)
+		return
+	}
+
+	endpointID, apierr := context.ParseParamToUInt(ctx, "webhook_id")
+	if apierr != nil {
+		response.Respond(ctx, nil, apierr)
+		return
+	}
+
+	e, apierr := h.service.DeleteEndpoint(ctx, merchantID, endpointID)
+	response.Respond(ctx, e, apierr)
+}
+
+func (h *handler) GetDeliveries(c *gin.Context) {
+	ctx := context.GetContextInformation(c)
+	merchantID, apierr := context.ParseMerchantParam(ctx, "merchant_id")
+	if apierr != nil {
+		response.Respond(ctx, nil, apierr)
+		return
+	}
+
+	d, apierr := h.service.GetDeliveries(ctx, merchantID, c.Query("status"))
+	response.Respond(ctx, d, apierr)
+}
+
+func (h *handler) Redeliver(c *gin.Context) {
+	ctx := context.GetContextInformation(c)
+	merchantID, apierr := context.ParseMerchantParam(ctx, "merchant_id")
+	if apierr != nil {
+		response.Respond(ctx, nil, apierr)
+		return
+	}
+
+	deliveryID, apierr := context.ParseParamToUInt(ctx, "delivery_id")
+	if apierr != nil {
+		response.Respond(ctx, nil, apierr)
+		return
+	}
+
+	d, apierr := h.service.Redeliver(ctx, merchantID, deliveryID)
+	response.Respond(ctx, d, apierr)
+}
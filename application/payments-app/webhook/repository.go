@@ -0,0 +1,139 @@
+package webhook
+
+import (
+	"github.com/negarciacamilo/deuna_challenge/application/apierrors"
+	d "github.com/negarciacamilo/deuna_challenge/application/domain"
+	dbd "github.com/negarciacamilo/deuna_challenge/application/domain/database"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/database"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/defines"
+	"github.com/uptrace/bun"
+	"time"
+)
+
+type Repository interface {
+	AddEndpoint(ctx *d.ContextInformation, endpoint *dbd.WebhookEndpoint) apierrors.ApiError
+	GetMerchantEndpoints(ctx *d.ContextInformation, merchantID uint64) (*[]dbd.WebhookEndpoint, apierrors.ApiError)
+	DeleteEndpoint(ctx *d.ContextInformation, merchantID, endpointID uint64) apierrors.ApiError
+	GetMerchantDeliveries(ctx *d.ContextInformation, merchantID uint64, status string) (*[]dbd.WebhookDelivery, apierrors.ApiError)
+	GetDelivery(ctx *d.ContextInformation, merchantID, deliveryID uint64) (*dbd.WebhookDelivery, apierrors.ApiError)
+	ClaimDueDeliveries(ctx *d.ContextInformation, now time.Time, lease time.Duration, limit int) (*[]dbd.WebhookDelivery, apierrors.ApiError)
+	UpdateDelivery(ctx *d.ContextInformation, delivery *dbd.WebhookDelivery) apierrors.ApiError
+}
+
+type repository struct {
+	db database.Database
+}
+
+func NewRepository(db database.Database) Repository {
+	return &repository{
+		db: db,
+	}
+}
+
+func (r *repository) AddEndpoint(ctx *d.ContextInformation, endpoint *dbd.WebhookEndpoint) apierrors.ApiError {
+	if _, err := r.db.GetDB().NewInsert().Model(endpoint).Exec(ctx.GetCtx()); err != nil {
+		return r.db.HandleDBError(ctx, "webhook_endpoints", database.Creating, err)
+	}
+
+	return nil
+}
+
+func (r *repository) GetMerchantEndpoints(ctx *d.ContextInformation, merchantID uint64) (*[]dbd.WebhookEndpoint, apierrors.ApiError) {
+	endpoints := make([]dbd.WebhookEndpoint, 0)
+	err := r.db.GetDB().NewSelect().Model(&endpoints).
+		Where("merchant_id = ?", merchantID).
+		Order("id ASC").Scan(ctx.GetCtx())
+	if err != nil {
+		return nil, r.db.HandleDBError(ctx, "webhook_endpoints", database.Fetching, err)
+	}
+
+	return &endpoints, nil
+}
+
+func (r *repository) DeleteEndpoint(ctx *d.ContextInformation, merchantID, endpointID uint64) apierrors.ApiError {
+	res, err := r.db.GetDB().NewDelete().Model((*dbd.WebhookEndpoint)(nil)).
+		Where("id = ?", endpointID).
+		Where("merchant_id = ?", merchantID).Exec(ctx.GetCtx())
+	if err != nil {
+		return r.db.HandleDBError(ctx, "webhook_endpoints", database.Deleting, err)
+	}
+
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return apierrors.NewNotFoundApiError("error, webhook endpoint not found")
+	}
+
+	return nil
+}
+
+func (r *repository) GetMerchantDeliveries(ctx *d.ContextInformation, merchantID uint64, status string) (*[]dbd.WebhookDelivery, apierrors.ApiError) {
+	deliveries := make([]dbd.WebhookDelivery, 0)
+	query := r.db.GetDB().NewSelect().Model(&deliveries).Where("merchant_id = ?", merchantID)
+	if status != "" {
+		query.Where("status = ?", status)
+	}
+
+	if err := query.Order("id DESC").Limit(100).Scan(ctx.GetCtx()); err != nil {
+		return nil, r.db.HandleDBError(ctx, "webhook_deliveries", database.Fetching, err)
+	}
+
+	return &deliveries, nil
+}
+
+func (r *repository) GetDelivery(ctx *d.ContextInformation, merchantID, deliveryID uint64) (*dbd.WebhookDelivery, apierrors.ApiError) {
+	var delivery dbd.WebhookDelivery
+	err := r.db.GetDB().NewSelect().Model(&delivery).
+		Relation("Endpoint").
+		Where("webhook_delivery.id = ?", deliveryID).
+		Where("webhook_delivery.merchant_id = ?", merchantID).Scan(ctx.GetCtx())
+	if err != nil {
+		return nil, r.db.HandleDBError(ctx, "webhook_delivery", database.Fetching, err)
+	}
+
+	return &delivery, nil
+}
+
+// ClaimDueDeliveries leases the pending deliveries whose next attempt is due, pushing their next attempt forward so
+// another dispatcher (or this one on the next tick) doesn't pick them while they are being sent. SKIP LOCKED lets many
+// instances claim at the same time without waiting for each other
+func (r *repository) ClaimDueDeliveries(ctx *d.ContextInformation, now time.Time, lease time.Duration, limit int) (*[]dbd.WebhookDelivery, apierrors.ApiError) {
+	db := r.db.GetDB()
+	due := db.NewSelect().Model((*dbd.WebhookDelivery)(nil)).Column("id").
+		Where("status = ?", defines.DELIVERY_PENDING).
+		Where("next_attempt_at <= ?", now).
+		OrderExpr("next_attempt_at ASC").
+		Limit(limit).For("UPDATE SKIP LOCKED")
+
+	var ids []uint64
+	_, err := db.NewUpdate().Model((*dbd.WebhookDelivery)(nil)).
+		Set("next_attempt_at = ?", now.Add(lease)).
+		Where("id IN (?)", due).
+		Returning("id").Exec(ctx.GetCtx(), &ids)
+	if err != nil {
+		return nil, r.db.HandleDBError(ctx, "webhook_deliveries", database.Updating, err)
+	}
+
+	deliveries := make([]dbd.WebhookDelivery, 0, len(ids))
+	if len(ids) == 0 {
+		return &deliveries, nil
+	}
+
+	err = db.NewSelect().Model(&deliveries).
+		Relation("Endpoint").
+		Where("webhook_delivery.id IN (?)", bun.In(ids)).Scan(ctx.GetCtx())
+	if err != nil {
+		return nil, r.db.HandleDBError(ctx, "webhook_deliveries", database.Fetching, err)
+	}
+
+	return &deliveries, nil
+}
+
+func (r *repository) UpdateDelivery(ctx *d.ContextInformation, delivery *dbd.WebhookDelivery) apierrors.ApiError {
+	_, err := r.db.GetDB().NewUpdate().Model(delivery).
+		Column("status", "attempts", "next_attempt_at", "last_response_status", "last_error", "delivered_at").
+		Where("id = ?", delivery.ID).Exec(ctx.GetCtx())
+	if err != nil {
+		return r.db.HandleDBError(ctx, "webhook_deliveries", database.Updating, err)
+	}
+
+	return nil
+}
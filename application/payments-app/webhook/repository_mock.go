@@ -0,0 +1,76 @@
+package webhook
+
+import (
+	"github.com/negarciacamilo/deuna_challenge/application/apierrors"
+	d "github.com/negarciacamilo/deuna_challenge/application/domain"
+	"github.com/negarciacamilo/deuna_challenge/application/domain/database"
+	"github.com/stretchr/testify/mock"
+	"time"
+)
+
+type RepositoryMock struct {
+	mock.Mock
+}
+
+func (r *RepositoryMock) AddEndpoint(ctx *d.ContextInformation, endpoint *database.WebhookEndpoint) apierrors.ApiError {
+	args := r.Called(ctx, endpoint)
+	err := args.Get(0)
+	if err != nil {
+		return err.(apierrors.ApiError)
+	}
+	return nil
+}
+
+func (r *RepositoryMock) GetMerchantEndpoints(ctx *d.ContextInformation, merchantID uint64) (*[]database.WebhookEndpoint, apierrors.ApiError) {
+	args := r.Called(ctx, merchantID)
+	err := args.Get(1)
+	if err != nil {
+		return nil, err.(apierrors.ApiError)
+	}
+	return args.Get(0).(*[]database.WebhookEndpoint), nil
+}
+
+func (r *RepositoryMock) DeleteEndpoint(ctx *d.ContextInformation, merchantID, endpointID uint64) apierrors.ApiError {
+	args := r.Called(ctx, merchantID, endpointID)
+	err := args.Get(0)
+	if err != nil {
+		return err.(apierrors.ApiError)
+	}
+	return nil
+}
+
+func (r *RepositoryMock) GetMerchantDeliveries(ctx *d.ContextInformation, merchantID uint64, status string) (*[]database.WebhookDelivery, apierrors.ApiError) {
+	args := r.Called(ctx, merchantID, status)
+	err := args.Get(1)
+	if err != nil {
+		return nil, err.(apierrors.ApiError)
+	}
+	return args.Get(0).(*[]database.WebhookDelivery), nil
+}
+
+func (r *RepositoryMock) GetDelivery(ctx *d.ContextInformation, merchantID, deliveryID uint64) (*database.WebhookDelivery, apierrors.ApiError) {
+	args := r.Called(ctx, merchantID, deliveryID)
+	err := args.Get(1)
+	if err != nil {
+		return nil, err.(apierrors.ApiError)
+	}
+	return args.Get(0).(*database.WebhookDelivery), nil
+}
+
+func (r *RepositoryMock) ClaimDueDeliveries(ctx *d.ContextInformation, now time.Time, lease time.Duration, limit int) (*[]database.WebhookDelivery, apierrors.ApiError) {
+	args := r.Called(ctx, now, lease, limit)
+	err := args.Get(1)
+	if err != nil {
+		return nil, err.(apierrors.ApiError)
+	}
+	return args.Get(0).(*[]database.WebhookDelivery), nil
+}
+
+func (r *RepositoryMock) UpdateDelivery(ctx *d.ContextInformation, delivery *database.WebhookDelivery) apierrors.ApiError {
+	args := r.Called(ctx, delivery)
+	err := args.Get(0)
+	if err != nil {
+		return err.(apierrors.ApiError)
+	}
+	return nil
+}
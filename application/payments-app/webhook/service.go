@@ -0,0 +1,228 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/go-resty/resty/v2"
+	"github.com/negarciacamilo/deuna_challenge/application/apierrors"
+	"github.com/negarciacamilo/deuna_challenge/application/defines"
+	d "github.com/negarciacamilo/deuna_challenge/application/domain"
+	dbd "github.com/negarciacamilo/deuna_challenge/application/domain/database"
+	"github.com/negarciacamilo/deuna_challenge/application/logger"
+	pdefines "github.com/negarciacamilo/deuna_challenge/application/payments-app/defines"
+	"github.com/negarciacamilo/deuna_challenge/application/payments-app/domain"
+	"github.com/negarciacamilo/deuna_challenge/application/response"
+	"github.com/spf13/viper"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// How many deliveries are claimed on every dispatch
+const dispatchBatchSize = 50
+
+type Service interface {
+	CreateEndpoint(ctx *d.ContextInformation, merchantID uint64, endpointRequest domain.WebhookEndpointRequest) (response.Response, apierrors.ApiError)
+	GetEndpoints(ctx *d.ContextInformation, merchantID uint64) (response.Response, apierrors.ApiError)
+	DeleteEndpoint(ctx *d.ContextInformation, merchantID, endpointID uint64) (response.Response, apierrors.ApiError)
+	GetDeliveries(ctx *d.ContextInformation, merchantID uint64, status string) (response.Response, apierrors.ApiError)
+	Redeliver(ctx *d.ContextInformation, merchantID, deliveryID uint64) (response.Response, apierrors.ApiError)
+	DispatchDueDeliveries(ctx *d.ContextInformation) apierrors.ApiError
+}
+
+type service struct {
+	httpClient        *resty.Client
+	webhookRepository Repository
+}
+
+func NewService(httpClient *resty.Client, webhookRepository Repository) Service {
+	return &service{
+		httpClient:        httpClient,
+		webhookRepository: webhookRepository,
+	}
+}
+
+func (s *service) CreateEndpoint(ctx *d.ContextInformation, merchantID uint64, endpointRequest domain.WebhookEndpointRequest) (response.Response, apierrors.ApiError) {
+	secret, err := newSecret()
+	if err != nil {
+		apierr := apierrors.NewInternalServerApiError("error generating the webhook secret", err)
+		logger.Error(apierr.Message(), "webhook-service-create-endpoint", err, ctx)
+		return nil, apierr
+	}
+
+	endpoint := &dbd.WebhookEndpoint{
+		MerchantID: merchantID,
+		URL:        endpointRequest.URL,
+		Secret:     secret,
+		Events:     endpointRequest.Events,
+	}
+
+	if apierr := s.webhookRepository.AddEndpoint(ctx, endpoint); apierr != nil {
+		return nil, apierr
+	}
+
+	return response.New(http.StatusCreated, endpoint), nil
+}
+
+func (s *service) GetEndpoints(ctx *d.ContextInformation, merchantID uint64) (response.Response, apierrors.ApiError) {
+	endpoints, apierr := s.webhookRepository.GetMerchantEndpoints(ctx, merchantID)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	// The secret is only shown when the endpoint is created
+	for i := range *endpoints {
+		(*endpoints)[i].Secret = ""
+	}
+
+	return response.New(http.StatusOK, endpoints), nil
+}
+
+func (s *service) DeleteEndpoint(ctx *d.ContextInformation, merchantID, endpointID uint64) (response.Response, apierrors.ApiError) {
+	if apierr := s.webhookRepository.DeleteEndpoint(ctx, merchantID, endpointID); apierr != nil {
+		return nil, apierr
+	}
+
+	return response.New(http.StatusNoContent, nil), nil
+}
+
+func (s *service) GetDeliveries(ctx *d.ContextInformation, merchantID uint64, status string) (response.Response, apierrors.ApiError) {
+	switch status {
+	case "", pdefines.DELIVERY_PENDING, pdefines.DELIVERY_SUCCEEDED, pdefines.DELIVERY_DEAD:
+	default:
+		apierr := apierrors.NewBadRequestApiError(fmt.Sprintf("invalid delivery status %s", status))
+		logger.Error(apierr.Message(), "webhook-service-get-deliveries", apierr, ctx, map[string]any{"status": status})
+		return nil, apierr
+	}
+
+	deliveries, apierr := s.webhookRepository.GetMerchantDeliveries(ctx, merchantID, status)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	return response.New(http.StatusOK, deliveries), nil
+}
+
+// Redeliver sends the delivery right away, whatever its status is. It's meant to be used once the merchant has fixed
+// its endpoint, so a dead delivery that succeeds is marked as succeeded but one that fails again stays dead
+func (s *service) Redeliver(ctx *d.ContextInformation, merchantID, deliveryID uint64) (response.Response, apierrors.ApiError) {
+	delivery, apierr := s.webhookRepository.GetDelivery(ctx, merchantID, deliveryID)
+	if apierr != nil {
+		return nil, apierr
+	}
+
+	if apierr = s.attempt(ctx, delivery); apierr != nil {
+		return nil, apierr
+	}
+
+	return response.New(http.StatusOK, delivery), nil
+}
+
+// DispatchDueDeliveries sends every pending delivery whose next attempt is due
+func (s *service) DispatchDueDeliveries(ctx *d.ContextInformation) apierrors.ApiError {
+	now := time.Now().UTC()
+	deliveries, apierr := s.webhookRepository.ClaimDueDeliveries(ctx, now, viper.GetDuration("WEBHOOK_TIMEOUT")*2, dispatchBatchSize)
+	if apierr != nil {
+		return apierr
+	}
+
+	for i := range *deliveries {
+		// One failed update shouldn't stop the rest, the lease will expire and it'll be picked again
+		_ = s.attempt(ctx, &(*deliveries)[i])
+	}
+
+	return nil
+}
+
+// attempt sends the delivery and stores the result, scheduling the next retry with an exponential backoff or moving
+// it to the dead letter list when it runs out of attempts
+func (s *service) attempt(ctx *d.ContextInformation, delivery *dbd.WebhookDelivery) apierrors.ApiError {
+	now := time.Now().UTC()
+	delivery.Attempts++
+
+	statusCode, err := s.send(delivery, now)
+	delivery.LastResponseStatus = statusCode
+	if err == nil {
+		delivery.Status = pdefines.DELIVERY_SUCCEEDED
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+		delivery.NextAttemptAt = nil
+		return s.webhookRepository.UpdateDelivery(ctx, delivery)
+	}
+
+	delivery.LastError = err.Error()
+	logger.Error("webhook delivery failed", "webhook-delivery", err, ctx, map[string]any{"delivery_id": delivery.ID, "attempts": delivery.Attempts, "status_code": statusCode})
+
+	// A manual redelivery of a succeeded or dead delivery doesn't change its status
+	if delivery.Status != pdefines.DELIVERY_PENDING {
+		return s.webhookRepository.UpdateDelivery(ctx, delivery)
+	}
+
+	if delivery.Attempts < viper.GetInt("WEBHOOK_MAX_ATTEMPTS") && !endpointDeleted(delivery) {
+		next := now.Add(Backoff(viper.GetDuration("WEBHOOK_BACKOFF_BASE"), delivery.Attempts))
+		delivery.NextAttemptAt = &next
+	} else {
+		delivery.Status = pdefines.DELIVERY_DEAD
+		delivery.NextAttemptAt = nil
+	}
+
+	return s.webhookRepository.UpdateDelivery(ctx, delivery)
+}
+
+// send posts the signed event to the endpoint, any response that's not a 2xx is a failure
+func (s *service) send(delivery *dbd.WebhookDelivery, now time.Time) (int, error) {
+	if endpointDeleted(delivery) {
+		return 0, fmt.Errorf("the webhook endpoint was deleted")
+	}
+
+	body, err := json.Marshal(delivery.Payload)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := s.httpClient.R().
+		SetHeader("Content-Type", "application/json").
+		SetHeader(defines.WebhookSignature, Sign(delivery.Endpoint.Secret, now, body)).
+		SetHeader(defines.WebhookEvent, delivery.Event).
+		SetHeader(defines.WebhookDeliveryID, strconv.FormatUint(delivery.ID, 10)).
+		SetBody(body).
+		Post(delivery.Endpoint.URL)
+	if err != nil {
+		return 0, err
+	}
+
+	if res.StatusCode() < 200 || res.StatusCode() > 299 {
+		return res.StatusCode(), fmt.Errorf("the endpoint answered with status %d", res.StatusCode())
+	}
+
+	return res.StatusCode(), nil
+}
+
+// Backoff returns how long to wait before the next attempt, doubling on every failed one
+func Backoff(base time.Duration, attempts int) time.Duration {
+	if base <= 0 {
+		base = 30 * time.Second
+	}
+	if attempts < 1 {
+		attempts = 1
+	}
+	// Bounded so the shift can't overflow
+	if attempts > 20 {
+		attempts = 20
+	}
+	return base << (attempts - 1)
+}
+
+func endpointDeleted(delivery *dbd.WebhookDelivery) bool {
+	return delivery.Endpoint == nil || delivery.Endpoint.DeletedAt != nil
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,174 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/go-resty/resty/v2"
+	"github.com/negarciacamilo/deuna_challenge/application/defines"
+	d "github.com/negarciacamilo/deuna_challenge/application/domain"
+	"github.com/negarciacamilo/deuna_challenge/application/domain/database"
+	pdefines "github.com/negarciacamilo/deuna_challenge/application/payments-app/defines"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"id":"evt"}`)
+	timestamp := time.Unix(1700000000, 0)
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("1700000000." + string(body)))
+	expected := fmt.Sprintf("t=1700000000,v1=%s", hex.EncodeToString(mac.Sum(nil)))
+
+	require.Equal(t, expected, Sign("secret", timestamp, body))
+	require.NotEqual(t, expected, Sign("another-secret", timestamp, body))
+}
+
+func TestBackoff(t *testing.T) {
+	require.Equal(t, 30*time.Second, Backoff(30*time.Second, 1))
+	require.Equal(t, 60*time.Second, Backoff(30*time.Second, 2))
+	require.Equal(t, 240*time.Second, Backoff(30*time.Second, 4))
+	require.Equal(t, 30*time.Second, Backoff(0, 1))
+}
+
+func TestEventForStatus(t *testing.T) {
+	event, ok := EventForStatus(pdefines.PARTIALLY_REFUNDED_STATUS)
+	require.True(t, ok)
+	require.Equal(t, pdefines.PAYMENT_REFUNDED_EVENT, event)
+
+	_, ok = EventForStatus(pdefines.PENDING_STATUS)
+	require.False(t, ok)
+}
+
+func TestDispatchDueDeliveries(t *testing.T) {
+	viper.Set("WEBHOOK_MAX_ATTEMPTS", 3)
+	viper.Set("WEBHOOK_BACKOFF_BASE", "30s")
+
+	tests := []struct {
+		name             string
+		endpointStatus   int
+		attempts         int
+		deletedEndpoint  bool
+		expectedStatus   string
+		expectedAttempts int
+		expectRetry      bool
+	}{
+		{
+			name:             "Delivered",
+			endpointStatus:   http.StatusOK,
+			expectedStatus:   pdefines.DELIVERY_SUCCEEDED,
+			expectedAttempts: 1,
+		},
+		{
+			name:             "Failed, retried later",
+			endpointStatus:   http.StatusInternalServerError,
+			expectedStatus:   pdefines.DELIVERY_PENDING,
+			expectedAttempts: 1,
+			expectRetry:      true,
+		},
+		{
+			name:             "Failed, no attempts left",
+			endpointStatus:   http.StatusInternalServerError,
+			attempts:         2,
+			expectedStatus:   pdefines.DELIVERY_DEAD,
+			expectedAttempts: 3,
+		},
+		{
+			name:             "Endpoint deleted",
+			deletedEndpoint:  true,
+			expectedStatus:   pdefines.DELIVERY_DEAD,
+			expectedAttempts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received *http.Request
+			var receivedBody []byte
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received = r
+				receivedBody, _ = io.ReadAll(r.Body)
+				w.WriteHeader(tt.endpointStatus)
+			}))
+			defer server.Close()
+
+			delivery := database.WebhookDelivery{
+				Base:     database.Base{ID: 7},
+				Event:    pdefines.PAYMENT_APPROVED_EVENT,
+				Payload:  &database.WebhookEvent{ID: "evt", Type: pdefines.PAYMENT_APPROVED_EVENT},
+				Status:   pdefines.DELIVERY_PENDING,
+				Attempts: tt.attempts,
+			}
+			if !tt.deletedEndpoint {
+				delivery.Endpoint = &database.WebhookEndpoint{URL: server.URL, Secret: "secret"}
+			}
+
+			repoMock := new(RepositoryMock)
+			repoMock.On("ClaimDueDeliveries", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&[]database.WebhookDelivery{delivery}, nil)
+			var updated *database.WebhookDelivery
+			repoMock.On("UpdateDelivery", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+				updated = args.Get(1).(*database.WebhookDelivery)
+			}).Return(nil)
+
+			s := NewService(resty.New(), repoMock)
+			apierr := s.DispatchDueDeliveries(d.BackgroundContext())
+			require.Nil(t, apierr)
+
+			require.NotNil(t, updated)
+			require.Equal(t, tt.expectedStatus, updated.Status)
+			require.Equal(t, tt.expectedAttempts, updated.Attempts)
+			require.Equal(t, tt.expectRetry, updated.NextAttemptAt != nil)
+
+			if tt.deletedEndpoint {
+				require.Nil(t, received)
+				return
+			}
+
+			require.NotNil(t, received)
+			require.Equal(t, tt.endpointStatus, updated.LastResponseStatus)
+			require.Equal(t, pdefines.PAYMENT_APPROVED_EVENT, received.Header.Get(defines.WebhookEvent))
+			require.Equal(t, "7", received.Header.Get(defines.WebhookDeliveryID))
+
+			var timestamp int64
+			_, err := fmt.Sscanf(received.Header.Get(defines.WebhookSignature), "t=%d,", &timestamp)
+			require.NoError(t, err)
+			require.Equal(t, Sign("secret", time.Unix(timestamp, 0), receivedBody), received.Header.Get(defines.WebhookSignature))
+		})
+	}
+}
+
+func TestRedeliverDeadDelivery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	delivery := &database.WebhookDelivery{
+		Status:   pdefines.DELIVERY_DEAD,
+		Attempts: 8,
+		Endpoint: &database.WebhookEndpoint{URL: server.URL, Secret: "secret"},
+	}
+
+	repoMock := new(RepositoryMock)
+	repoMock.On("GetDelivery", mock.Anything, uint64(1), uint64(2)).Return(delivery, nil)
+	repoMock.On("UpdateDelivery", mock.Anything, delivery).Return(nil)
+
+	s := NewService(resty.New(), repoMock)
+	res, apierr := s.Redeliver(d.BackgroundContext(), 1, 2)
+	require.Nil(t, apierr)
+	require.Equal(t, http.StatusOK, res.Status())
+
+	// A failed manual redelivery keeps it in the dead letter list
+	require.Equal(t, pdefines.DELIVERY_DEAD, delivery.Status)
+	require.Equal(t, 9, delivery.Attempts)
+	require.Equal(t, http.StatusBadGateway, delivery.LastResponseStatus)
+	require.Nil(t, delivery.NextAttemptAt)
+}
@@ -0,0 +1,31 @@
+package worker
+
+import (
+	d "github.com/negarciacamilo/deuna_challenge/application/domain"
+	"time"
+)
+
+// Every runs fn every interval, or every fallback if the interval isn't configured. Every run gets its own context.
+// It blocks, so it should be run in its own goroutine
+func Every(interval, fallback time.Duration, fn func(ctx *d.ContextInformation)) {
+	Until(nil, interval, fallback, fn)
+}
+
+// Until is like Every, but it returns once done is closed
+func Until(done <-chan struct{}, interval, fallback time.Duration, fn func(ctx *d.ContextInformation)) {
+	if interval <= 0 {
+		interval = fallback
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			fn(d.BackgroundContext())
+		}
+	}
+}